@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sync"
@@ -112,8 +113,12 @@ func (b *AdminBlock) buildPartialHash() (err error) {
 	return
 }
 
-// Add an Admin Block entry to the block
+// Add an Admin Block entry to the block, unless the block is full with
+// MAX_ABLOCK_ENTRIES entries
 func (b *AdminBlock) AddABEntry(e ABEntry) (err error) {
+	if uint32(len(b.ABEntries)) >= MAX_ABLOCK_ENTRIES {
+		return fmt.Errorf("admin block of %v entries is full", len(b.ABEntries))
+	}
 	b.ABEntries = append(b.ABEntries, e)
 	return
 }
@@ -124,9 +129,7 @@ func (b *AdminBlock) AddEndOfMinuteMarker(eomType byte) (err error) {
 		entryType: TYPE_MINUTE_NUM,
 		EOM_Type:  eomType}
 
-	b.AddABEntry(eOMEntry)
-
-	return
+	return b.AddABEntry(eOMEntry)
 }
 
 // Write out the AdminBlock to binary.
@@ -157,11 +160,6 @@ func (b *AdminBlock) MarshalledSize() uint64 {
 }
 
 func (b *AdminBlock) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
 	newData = data
 	h := new(ABlockHeader)
 	newData, err = h.UnmarshalBinaryData(newData)
@@ -170,12 +168,24 @@ func (b *AdminBlock) UnmarshalBinaryData(data []byte) (newData []byte, err error
 	}
 	b.Header = h
 
+	if b.Header.MessageCount > MAX_ABLOCK_ENTRIES {
+		return nil, overLimit("AdminBlock", "MessageCount", uint64(b.Header.MessageCount), uint64(MAX_ABLOCK_ENTRIES))
+	}
+	// Every entry takes at least its type byte
+	if uint64(b.Header.MessageCount) > uint64(len(newData)) {
+		return nil, shortData("AdminBlock", uint64(b.Header.MessageCount), newData)
+	}
 	b.ABEntries = make([]ABEntry, b.Header.MessageCount)
 	for i := uint32(0); i < b.Header.MessageCount; i++ {
+		if len(newData) < 1 {
+			return nil, shortData("AdminBlock", 1, newData)
+		}
 		if newData[0] == TYPE_DB_SIGNATURE {
 			b.ABEntries[i] = new(DBSignatureEntry)
 		} else if newData[0] == TYPE_MINUTE_NUM {
 			b.ABEntries[i] = new(EndOfMinuteEntry)
+		} else {
+			return nil, badData("AdminBlock", "entry %v of unknown type %v", i, newData[0])
 		}
 		newData, err = b.ABEntries[i].UnmarshalBinaryData(newData)
 		if err != nil {
@@ -203,6 +213,46 @@ func (b *AdminBlock) GetDBSignature() ABEntry {
 	return nil
 }
 
+// UnmarshalJSON reads the Admin Block from its JSON, where the Type of each
+// entry tells which kind of ABEntry it is.
+func (b *AdminBlock) UnmarshalJSON(data []byte) error {
+	var ab struct {
+		Header    *ABlockHeader
+		ABEntries []json.RawMessage
+	}
+	if err := json.Unmarshal(data, &ab); err != nil {
+		return err
+	}
+
+	b.Header = ab.Header
+	b.ABEntries = make([]ABEntry, len(ab.ABEntries))
+	for i, p := range ab.ABEntries {
+		var t struct {
+			Type *byte
+		}
+		if err := json.Unmarshal(p, &t); err != nil {
+			return err
+		}
+		if t.Type == nil {
+			return fmt.Errorf("admin block entry %v has no Type", i)
+		}
+		switch *t.Type {
+		case TYPE_DB_SIGNATURE:
+			b.ABEntries[i] = new(DBSignatureEntry)
+		case TYPE_MINUTE_NUM:
+			b.ABEntries[i] = new(EndOfMinuteEntry)
+		default:
+			return fmt.Errorf("admin block entry %v of unknown type %v", i, *t.Type)
+		}
+		if err := json.Unmarshal(p, b.ABEntries[i]); err != nil {
+			return err
+		}
+	}
+	b.fullHash = nil
+	b.partialHash = nil
+	return nil
+}
+
 func (e *AdminBlock) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
@@ -269,7 +319,7 @@ func (b *ABlockHeader) MarshalledSize() uint64 {
 	size += uint64(HASH_LENGTH)                 //PrevFullHash
 	size += 4                                   //DBHeight
 	size += VarIntLength(b.HeaderExpansionSize) //HeaderExpansionSize
-	size += b.HeaderExpansionSize               //HeadderExpansionArea
+	size += uint64(len(b.HeaderExpansionArea))  //HeadderExpansionArea
 	size += 4                                   //MessageCount
 	size += 4                                   //BodySize
 
@@ -277,12 +327,11 @@ func (b *ABlockHeader) MarshalledSize() uint64 {
 }
 
 func (b *ABlockHeader) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
 	newData = data
+	// The fixed fields before the Header Expansion Size
+	if len(newData) < HASH_LENGTH*2+4 {
+		return nil, shortData("ABlockHeader", uint64(HASH_LENGTH*2+4), newData)
+	}
 	b.AdminChainID = new(Hash)
 	newData, err = b.AdminChainID.UnmarshalBinaryData(newData)
 	if err != nil {
@@ -297,7 +346,17 @@ func (b *ABlockHeader) UnmarshalBinaryData(data []byte) (newData []byte, err err
 
 	b.DBHeight, newData = binary.BigEndian.Uint32(newData[0:4]), newData[4:]
 
-	b.HeaderExpansionSize, newData = DecodeVarInt(newData)
+	b.HeaderExpansionSize, newData, err = decodeVarInt("ABlockHeader", newData)
+	if err != nil {
+		return
+	}
+	if b.HeaderExpansionSize > MAX_HEADER_EXPANSION {
+		return nil, overLimit("ABlockHeader", "HeaderExpansionSize", b.HeaderExpansionSize, MAX_HEADER_EXPANSION)
+	}
+	// The Header Expansion Area, MessageCount and BodySize
+	if need := b.HeaderExpansionSize + 8; need > uint64(len(newData)) {
+		return nil, shortData("ABlockHeader", need, newData)
+	}
 	b.HeaderExpansionArea, newData = newData[:b.HeaderExpansionSize], newData[b.HeaderExpansionSize:]
 
 	b.MessageCount, newData = binary.BigEndian.Uint32(newData[0:4]), newData[4:]
@@ -349,6 +408,9 @@ func (s *Sig) UnmarshalText(b []byte) error {
 	if err != nil {
 		return err
 	}
+	if len(p) != len(s) {
+		return fmt.Errorf("signature of %v bytes instead of %v", len(p), len(s))
+	}
 	copy(s[:], p)
 	return nil
 }
@@ -413,12 +475,10 @@ func (e *DBSignatureEntry) MarshalledSize() uint64 {
 }
 
 func (e *DBSignatureEntry) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
 	newData = data
+	if uint64(len(newData)) < e.MarshalledSize() {
+		return nil, shortData("DBSignatureEntry", e.MarshalledSize(), newData)
+	}
 	e.entryType, newData = newData[0], newData[1:]
 
 	e.IdentityAdminChainID = new(Hash)
@@ -444,6 +504,23 @@ func (e *DBSignatureEntry) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+func (e *DBSignatureEntry) MarshalJSON() ([]byte, error) {
+	type entry DBSignatureEntry
+	return json.Marshal(&struct {
+		Type byte
+		*entry
+	}{e.Type(), (*entry)(e)})
+}
+
+func (e *DBSignatureEntry) UnmarshalJSON(data []byte) error {
+	type entry DBSignatureEntry
+	if err := json.Unmarshal(data, (*entry)(e)); err != nil {
+		return err
+	}
+	e.entryType = TYPE_DB_SIGNATURE
+	return nil
+}
+
 func (e *DBSignatureEntry) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
@@ -508,12 +585,10 @@ func (e *EndOfMinuteEntry) MarshalledSize() uint64 {
 }
 
 func (e *EndOfMinuteEntry) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
 	newData = data
+	if uint64(len(newData)) < e.MarshalledSize() {
+		return nil, shortData("EndOfMinuteEntry", e.MarshalledSize(), newData)
+	}
 
 	e.entryType, newData = newData[0], newData[1:]
 	e.EOM_Type, newData = newData[0], newData[1:]
@@ -526,6 +601,23 @@ func (e *EndOfMinuteEntry) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+func (e *EndOfMinuteEntry) MarshalJSON() ([]byte, error) {
+	type entry EndOfMinuteEntry
+	return json.Marshal(&struct {
+		Type byte
+		*entry
+	}{e.Type(), (*entry)(e)})
+}
+
+func (e *EndOfMinuteEntry) UnmarshalJSON(data []byte) error {
+	type entry EndOfMinuteEntry
+	if err := json.Unmarshal(data, (*entry)(e)); err != nil {
+		return err
+	}
+	e.entryType = TYPE_MINUTE_NUM
+	return nil
+}
+
 func (e *EndOfMinuteEntry) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
@@ -17,6 +17,55 @@ type BinaryMarshallable interface {
 	MarshalledSize() uint64
 }
 
+var (
+	// ErrShortData is the Err of a DecodeError for binary data that ends
+	// before the value it holds.
+	ErrShortData = errors.New("data is too short")
+
+	// ErrOverLimit is the Err of a DecodeError for a count or a size over
+	// its limit, like a Directory Block BlockCount over MAX_DBLOCK_ENTRIES.
+	ErrOverLimit = errors.New("over the limit")
+
+	// ErrBadData is the Err of a DecodeError for binary data that is not
+	// the encoding of any value, like an unknown entry type.
+	ErrBadData = errors.New("malformed data")
+)
+
+// DecodeError is the error UnmarshalBinaryData returns for data it cannot
+// decode. Err is ErrShortData, ErrOverLimit or ErrBadData.
+type DecodeError struct {
+	Type    string // the type being decoded, like "DBlockHeader"
+	Err     error
+	Message string
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s: %v: %s", e.Type, e.Err, e.Message)
+}
+
+// shortData returns the DecodeError for data of less than the need bytes
+// the type typ takes.
+func shortData(typ string, need uint64, data []byte) error {
+	return &DecodeError{typ, ErrShortData, fmt.Sprintf("need %v bytes, have %v", need, len(data))}
+}
+
+// overLimit returns the DecodeError for a count or a size n over its limit
+// max.
+func overLimit(typ string, what string, n uint64, max uint64) error {
+	return &DecodeError{typ, ErrOverLimit, fmt.Sprintf("%v of %v, at most %v", what, n, max)}
+}
+
+// shortCount returns the DecodeError for a count n of the elements what that
+// cannot fit in what is left of the data.
+func shortCount(typ string, what string, n uint64, data []byte) error {
+	return &DecodeError{typ, ErrShortData, fmt.Sprintf("%v %v do not fit in %v bytes", n, what, len(data))}
+}
+
+// badData returns the DecodeError for malformed data.
+func badData(typ string, format string, a ...interface{}) error {
+	return &DecodeError{typ, ErrBadData, fmt.Sprintf(format, a...)}
+}
+
 func bigIntMarshalBinary(i *big.Int) (data []byte, err error) {
 	intd, err := i.GobEncode()
 	if err != nil {
@@ -44,6 +93,12 @@ func bigIntMarshalledSize(i *big.Int) uint64 {
 }
 
 func bigIntUnmarshalBinary(data []byte) (retd []byte, i *big.Int, err error) {
+	if len(data) < 1 {
+		return nil, nil, shortData("big.Int", 1, data)
+	}
+	if len(data) < 1+int(data[0]) {
+		return nil, nil, shortData("big.Int", 1+uint64(data[0]), data)
+	}
 	size, data := uint8(data[0]), data[1:]
 
 	i = new(big.Int)
@@ -97,15 +152,16 @@ func (ba ByteArray) MarshalledSize() uint64 {
 }
 
 func (ba ByteArray) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
 	newData = data
+	if len(newData) < 8 {
+		return nil, shortData("ByteArray", 8, newData)
+	}
 	count := binary.BigEndian.Uint64(newData[0:8])
 
 	newData = newData[8:]
+	if count > uint64(len(newData)) {
+		return nil, shortData("ByteArray", 8+count, data)
+	}
 
 	tmp := make([]byte, count)
 
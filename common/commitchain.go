@@ -7,8 +7,8 @@ package common
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
-	"io"
 	"time"
 
 	ed "github.com/FactomProject/ed25519"
@@ -156,11 +156,9 @@ func (c *CommitChain) ECID() byte {
 }
 
 func (c *CommitChain) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
+	if len(data) < CommitChainSize {
+		return nil, shortData("CommitChain", uint64(CommitChainSize), data)
+	}
 	buf := bytes.NewBuffer(data)
 	hash := make([]byte, 32)
 
@@ -173,11 +171,6 @@ func (c *CommitChain) UnmarshalBinaryData(data []byte) (newData []byte, err erro
 		c.Version = uint8(b)
 	}
 
-	if buf.Len() < 6 {
-		err = io.EOF
-		return
-	}
-
 	// 6 byte MilliTime
 	if p = buf.Next(6); p == nil {
 		err = fmt.Errorf("Could not read MilliTime")
@@ -214,11 +207,6 @@ func (c *CommitChain) UnmarshalBinaryData(data []byte) (newData []byte, err erro
 		c.Credits = uint8(b)
 	}
 
-	if buf.Len() < 32 {
-		err = io.EOF
-		return
-	}
-
 	// 32 byte Public Key
 	if p := buf.Next(32); p == nil {
 		err = fmt.Errorf("Could not read ECPubKey")
@@ -227,11 +215,6 @@ func (c *CommitChain) UnmarshalBinaryData(data []byte) (newData []byte, err erro
 		copy(c.ECPubKey[:], p)
 	}
 
-	if buf.Len() < 64 {
-		err = io.EOF
-		return
-	}
-
 	// 64 byte Signature
 	if p := buf.Next(64); p == nil {
 		err = fmt.Errorf("Could not read Sig")
@@ -250,6 +233,14 @@ func (c *CommitChain) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+func (e *CommitChain) MarshalJSON() ([]byte, error) {
+	type entry CommitChain
+	return json.Marshal(&struct {
+		ECID byte
+		*entry
+	}{e.ECID(), (*entry)(e)})
+}
+
 func (e *CommitChain) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
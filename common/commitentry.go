@@ -7,8 +7,8 @@ package common
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
-	"io"
 	"time"
 
 	ed "github.com/FactomProject/ed25519"
@@ -145,6 +145,9 @@ func (c *CommitEntry) ECID() byte {
 }
 
 func (c *CommitEntry) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	if len(data) < CommitEntrySize {
+		return nil, shortData("CommitEntry", uint64(CommitEntrySize), data)
+	}
 	buf := bytes.NewBuffer(data)
 	hash := make([]byte, 32)
 
@@ -157,11 +160,6 @@ func (c *CommitEntry) UnmarshalBinaryData(data []byte) (newData []byte, err erro
 		c.Version = uint8(b)
 	}
 
-	if buf.Len() < 6 {
-		err = io.EOF
-		return
-	}
-
 	// 6 byte MilliTime
 	if p = buf.Next(6); p == nil {
 		err = fmt.Errorf("Could not read MilliTime")
@@ -184,11 +182,6 @@ func (c *CommitEntry) UnmarshalBinaryData(data []byte) (newData []byte, err erro
 		c.Credits = uint8(b)
 	}
 
-	if buf.Len() < 32 {
-		err = io.EOF
-		return
-	}
-
 	// 32 byte Public Key
 	if p = buf.Next(32); p == nil {
 		err = fmt.Errorf("Could not read ECPubKey")
@@ -197,11 +190,6 @@ func (c *CommitEntry) UnmarshalBinaryData(data []byte) (newData []byte, err erro
 		copy(c.ECPubKey[:], p)
 	}
 
-	if buf.Len() < 64 {
-		err = io.EOF
-		return
-	}
-
 	// 64 byte Signature
 	if p = buf.Next(64); p == nil {
 		err = fmt.Errorf("Could not read Sig")
@@ -220,6 +208,14 @@ func (c *CommitEntry) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+func (e *CommitEntry) MarshalJSON() ([]byte, error) {
+	type entry CommitEntry
+	return json.Marshal(&struct {
+		ECID byte
+		*entry
+	}{e.ECID(), (*entry)(e)})
+}
+
 func (e *CommitEntry) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
@@ -25,6 +25,15 @@ const (
 	MAX_BLK_POOL_SIZE = int(500000)   //Block mem bool size
 	MAX_PLIST_SIZE    = int(150000)   //MY Process List size
 
+	//Limits on the counts and sizes read from binary blocks
+	MAX_DBLOCK_ENTRIES    = uint32(100000)  //Maximum BlockCount of a Directory Block
+	MAX_EBLOCK_ENTRIES    = uint32(100000)  //Maximum EntryCount of an Entry Block, minute markers included
+	MAX_ABLOCK_ENTRIES    = uint32(10000)   //Maximum MessageCount of an Admin Block
+	MAX_ECBLOCK_OBJECTS   = uint64(1000000) //Maximum ObjectCount of an Entry Credit Block
+	MAX_HEADER_EXPANSION  = uint64(1024)    //Maximum Header Expansion Size of the Admin and Entry Credit Blocks
+	MAX_MERKLE_BRANCH     = uint64(64)      //Maximum number of nodes in a Merkle Branch
+	MAX_ECCHAIN_NAME_SIZE = uint64(10240)   //Maximum size of the names of an Entry Credit Chain
+
 	MAX_ENTRY_CREDITS = uint8(10) //Max number of entry credits per entry
 	MAX_CHAIN_CREDITS = uint8(20) //Max number of entry credits per chain
 
@@ -0,0 +1,239 @@
+package common_test
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// decoder decodes binary data into new values of one type.
+type decoder struct {
+	name   string
+	newV   func() encoding.BinaryUnmarshaler
+	sample func() ([]byte, error)
+}
+
+func sampleDBlock() *common.DirectoryBlock {
+	b := common.NewDBlock()
+	b.Header.DBHeight = 9
+	for i := 0; i < 2; i++ {
+		b.DBEntries = append(b.DBEntries, &common.DBEntry{
+			ChainID: common.Sha([]byte(fmt.Sprint("chain ", i))),
+			KeyMR:   common.Sha([]byte(fmt.Sprint("block ", i))),
+		})
+	}
+	b.Header.BlockCount = uint32(len(b.DBEntries))
+	b.Header.BodyMR, _ = b.BuildBodyMR()
+	b.BuildKeyMerkleRoot()
+	return b
+}
+
+func sampleEntry() *common.Entry {
+	e := common.NewEntry()
+	e.ExtIDs = [][]byte{[]byte("one"), []byte("two")}
+	e.ChainID = common.NewChainID(e)
+	e.Content = []byte("content")
+	return e
+}
+
+func sampleEBlock() *common.EBlock {
+	b := common.NewEBlock()
+	b.Header.ChainID = sampleEntry().ChainID
+	b.AddEBEntry(sampleEntry())
+	b.AddEndOfMinuteMarker(1)
+	return b
+}
+
+func sampleABlock() *common.AdminBlock {
+	b, _ := common.CreateAdminBlock(&common.AdminChain{ChainID: common.NewHash()}, nil, 2)
+	b.AddABEntry(common.NewDBSignatureEntry(common.Sha([]byte("identity")), common.Signature{
+		Pub: common.PublicKey{Key: new([32]byte)},
+		Sig: new([64]byte),
+	}))
+	b.AddEndOfMinuteMarker(1)
+	b.Header.HeaderExpansionSize = 2
+	b.Header.HeaderExpansionArea = []byte{1, 2}
+	b.Header.MessageCount = uint32(len(b.ABEntries))
+	return b
+}
+
+func sampleECBlock() *common.ECBlock {
+	b := common.NewECBlock()
+	b.Header.HeaderExpansionArea = []byte{1, 2, 3}
+	b.AddEntry(common.NewServerIndexNumber())
+	b.AddEntry(common.NewCommitChain())
+	b.AddEntry(common.NewCommitEntry())
+	ib := common.NewIncreaseBalance()
+	ib.ECPubKey = new([32]byte)
+	ib.Index = 300
+	ib.NumEC = 1000
+	b.AddEntry(ib)
+	m := common.NewMinuteNumber()
+	m.Number = 1
+	b.AddEntry(m)
+	return b
+}
+
+func sampleMerkleBranch() *common.MerkleBranch {
+	hashes := []*common.Hash{common.Sha([]byte("a")), common.Sha([]byte("b")), common.Sha([]byte("c"))}
+	branch, _ := common.BuildMerkleBranch(hashes, 2)
+	return branch
+}
+
+func decoders() []decoder {
+	return []decoder{
+		{"Hash", func() encoding.BinaryUnmarshaler { return common.NewHash() }, common.Sha([]byte("hash")).MarshalBinary},
+		{"DBEntry", func() encoding.BinaryUnmarshaler { return new(common.DBEntry) }, sampleDBlock().DBEntries[0].MarshalBinary},
+		{"DBlockHeader", func() encoding.BinaryUnmarshaler { return new(common.DBlockHeader) }, sampleDBlock().Header.MarshalBinary},
+		{"DirectoryBlock", func() encoding.BinaryUnmarshaler { return common.NewDBlock() }, sampleDBlock().MarshalBinary},
+		{"DirBlockInfo", func() encoding.BinaryUnmarshaler { return new(common.DirBlockInfo) }, common.NewDirBlockInfoFromDBlock(sampleDBlock()).MarshalBinary},
+		{"ABlockHeader", func() encoding.BinaryUnmarshaler { return new(common.ABlockHeader) }, sampleABlock().Header.MarshalBinary},
+		{"AdminBlock", func() encoding.BinaryUnmarshaler { return new(common.AdminBlock) }, sampleABlock().MarshalBinary},
+		{"DBSignatureEntry", func() encoding.BinaryUnmarshaler { return new(common.DBSignatureEntry) }, sampleABlock().ABEntries[0].MarshalBinary},
+		{"EndOfMinuteEntry", func() encoding.BinaryUnmarshaler { return new(common.EndOfMinuteEntry) }, sampleABlock().ABEntries[1].MarshalBinary},
+		{"EBlock", func() encoding.BinaryUnmarshaler { return common.NewEBlock() }, sampleEBlock().MarshalBinary},
+		{"Entry", func() encoding.BinaryUnmarshaler { return common.NewEntry() }, sampleEntry().MarshalBinary},
+		{"EChain", func() encoding.BinaryUnmarshaler { return common.NewEChain() }, func() ([]byte, error) {
+			c := common.NewEChain()
+			c.FirstEntry = sampleEntry()
+			c.ChainID = c.FirstEntry.ChainID
+			return c.MarshalBinary()
+		}},
+		{"ECChain", func() encoding.BinaryUnmarshaler { return common.NewECChain() }, func() ([]byte, error) {
+			c := common.NewECChain()
+			c.Name = [][]byte{[]byte("entry"), []byte("credits")}
+			return c.MarshalBinary()
+		}},
+		{"ECBlock", func() encoding.BinaryUnmarshaler { return common.NewECBlock() }, sampleECBlock().MarshalBinary},
+		{"CommitChain", func() encoding.BinaryUnmarshaler { return common.NewCommitChain() }, common.NewCommitChain().MarshalBinary},
+		{"CommitEntry", func() encoding.BinaryUnmarshaler { return common.NewCommitEntry() }, common.NewCommitEntry().MarshalBinary},
+		{"IncreaseBalance", func() encoding.BinaryUnmarshaler { return common.NewIncreaseBalance() }, sampleECBlock().Body.Entries[3].MarshalBinary},
+		{"MinuteNumber", func() encoding.BinaryUnmarshaler { return common.NewMinuteNumber() }, common.NewMinuteNumber().MarshalBinary},
+		{"ServerIndexNumber", func() encoding.BinaryUnmarshaler { return common.NewServerIndexNumber() }, common.NewServerIndexNumber().MarshalBinary},
+		{"MerkleBranch", func() encoding.BinaryUnmarshaler { return new(common.MerkleBranch) }, sampleMerkleBranch().MarshalBinary},
+	}
+}
+
+// checkDecode decodes data with d, failing t on a panic or on an error
+// other than a *DecodeError.
+func checkDecode(t *testing.T, d decoder, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.Fatalf("%v panics on %x: %v", d.name, data, r)
+		}
+	}()
+	err = d.newV().UnmarshalBinary(data)
+	if _, ok := err.(*common.DecodeError); err != nil && !ok {
+		t.Errorf("%v returns %T %q on %x, want a *DecodeError", d.name, err, err, data)
+	}
+	return err
+}
+
+// isDecodeError reports whether err is a *DecodeError of the kind target.
+func isDecodeError(err error, target error) bool {
+	e, ok := err.(*common.DecodeError)
+	return ok && e.Err == target
+}
+
+func TestUnmarshalTruncated(t *testing.T) {
+	for _, d := range decoders() {
+		data, err := d.sample()
+		if err != nil {
+			t.Fatalf("%v: %v", d.name, err)
+		}
+		if err := checkDecode(t, d, data); err != nil {
+			t.Errorf("%v does not decode its own encoding: %v", d.name, err)
+		}
+		for n := 0; n < len(data); n++ {
+			checkDecode(t, d, data[:n])
+		}
+	}
+
+	// Fixed size values cut short are always an error
+	for _, d := range decoders()[:9] {
+		data, _ := d.sample()
+		if err := checkDecode(t, d, data[:len(data)-1]); !isDecodeError(err, common.ErrShortData) {
+			t.Errorf("%v of %v bytes cut short: %v", d.name, len(data), err)
+		}
+	}
+}
+
+func TestUnmarshalOverLimit(t *testing.T) {
+	// BlockCount is the last field of the Directory Block Header
+	p, _ := sampleDBlock().MarshalBinary()
+	binary.BigEndian.PutUint32(p[common.DBlockHeaderSize-4:], common.MAX_DBLOCK_ENTRIES+1)
+	if err := common.NewDBlock().UnmarshalBinary(p); !isDecodeError(err, common.ErrOverLimit) {
+		t.Errorf("DirectoryBlock BlockCount over the limit: %v", err)
+	}
+	binary.BigEndian.PutUint32(p[common.DBlockHeaderSize-4:], 3)
+	if err := common.NewDBlock().UnmarshalBinary(p); !isDecodeError(err, common.ErrShortData) {
+		t.Errorf("DirectoryBlock BlockCount over the data: %v", err)
+	}
+
+	// EntryCount is the last field of the Entry Block Header
+	p, _ = sampleEBlock().MarshalBinary()
+	binary.BigEndian.PutUint32(p[common.EBHeaderSize-4:], common.MAX_EBLOCK_ENTRIES+1)
+	if err := common.NewEBlock().UnmarshalBinary(p); !isDecodeError(err, common.ErrOverLimit) {
+		t.Errorf("EBlock EntryCount over the limit: %v", err)
+	}
+
+	e := sampleEntry()
+	e.Content = make([]byte, common.MAX_ENTRY_SIZE)
+	p, _ = e.MarshalBinary()
+	if err := common.NewEntry().UnmarshalBinary(p); !isDecodeError(err, common.ErrOverLimit) {
+		t.Errorf("Entry over MAX_ENTRY_SIZE: %v", err)
+	}
+
+	ab := sampleABlock()
+	ab.Header.HeaderExpansionSize = common.MAX_HEADER_EXPANSION + 1
+	ab.Header.HeaderExpansionArea = make([]byte, common.MAX_HEADER_EXPANSION+1)
+	p, _ = ab.MarshalBinary()
+	if err := new(common.AdminBlock).UnmarshalBinary(p); !isDecodeError(err, common.ErrOverLimit) {
+		t.Errorf("AdminBlock HeaderExpansionSize over the limit: %v", err)
+	}
+
+	// An Admin Block entry of an unknown type
+	ab = sampleABlock()
+	p, _ = ab.MarshalBinary()
+	p[bytes.LastIndex(p, []byte{common.TYPE_MINUTE_NUM, 1})] = 0xff
+	if err := new(common.AdminBlock).UnmarshalBinary(p); !isDecodeError(err, common.ErrBadData) {
+		t.Errorf("AdminBlock entry of an unknown type: %v", err)
+	}
+}
+
+// TestUnmarshalMutated decodes randomly mutated samples of every decoder,
+// with a fixed seed so a failure can be reproduced.
+func TestUnmarshalMutated(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for _, d := range decoders() {
+		sample, err := d.sample()
+		if err != nil {
+			t.Fatalf("%v: %v", d.name, err)
+		}
+		for i := 0; i < 500; i++ {
+			data := append([]byte(nil), sample...)
+			for n := r.Intn(4) + 1; n > 0; n-- {
+				switch {
+				case len(data) == 0:
+					data = append(data, byte(r.Intn(256)))
+				case r.Intn(4) == 0:
+					// Cut the data short
+					data = data[:r.Intn(len(data))]
+				case r.Intn(3) == 0:
+					// Insert a byte
+					at := r.Intn(len(data) + 1)
+					data = append(data[:at], append([]byte{byte(r.Intn(256))}, data[at:]...)...)
+				default:
+					// Overwrite a byte, often a count or a size
+					data[r.Intn(len(data))] = byte(r.Intn(256))
+				}
+			}
+			checkDecode(t, d, data)
+		}
+	}
+}
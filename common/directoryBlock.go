@@ -17,6 +17,13 @@ import (
 
 const DBlockVersion = 0
 
+const (
+	DBlockHeaderSize = 113 // 1+4+32+32+32+4+4+4
+
+	// dirBlockInfoSize is the size of a marshalled DirBlockInfo
+	dirBlockInfoSize = 149 // 32+4+8+32+4+4+32+32+1
+)
+
 type DChain struct {
 	ChainID      *Hash
 	Blocks       []*DirectoryBlock
@@ -40,7 +47,7 @@ type DirectoryBlock struct {
 	DBEntries []*DBEntry
 
 	//Not Marshalized
-	Chain       *DChain
+	Chain       *DChain `json:"-"`
 	IsSealed    bool
 	DBHash      *Hash
 	KeyMR       *Hash
@@ -51,9 +58,8 @@ type DirectoryBlock struct {
 var _ Printable = (*DirectoryBlock)(nil)
 var _ BinaryMarshallable = (*DirectoryBlock)(nil)
 
-func (c *DirectoryBlock) MarshalledSize() uint64 {
-	panic("Function not implemented")
-	return 0
+func (b *DirectoryBlock) MarshalledSize() uint64 {
+	return b.Header.MarshalledSize() + uint64(len(b.DBEntries)*HASH_LENGTH*2)
 }
 
 func NewDirectoryBlock() *DirectoryBlock {
@@ -116,6 +122,11 @@ type DirBlockInfo struct {
 }
 
 var _ Printable = (*DirBlockInfo)(nil)
+var _ BinaryMarshallable = (*DirBlockInfo)(nil)
+
+func (b *DirBlockInfo) MarshalledSize() uint64 {
+	return dirBlockInfoSize
+}
 
 func (e *DirBlockInfo) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
@@ -182,9 +193,8 @@ type DBEntry struct {
 var _ Printable = (*DBEntry)(nil)
 var _ BinaryMarshallable = (*DBEntry)(nil)
 
-func (c *DBEntry) MarshalledSize() uint64 {
-	panic("Function not implemented")
-	return 0
+func (e *DBEntry) MarshalledSize() uint64 {
+	return uint64(HASH_LENGTH * 2)
 }
 
 func NewDBEntry(eb *EBlock) (*DBEntry, error) {
@@ -272,12 +282,10 @@ func (e *DBEntry) MarshalBinary() (data []byte, err error) {
 }
 
 func (e *DBEntry) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
 	newData = data
+	if len(newData) < HASH_LENGTH*2 {
+		return nil, shortData("DBEntry", uint64(HASH_LENGTH*2), newData)
+	}
 	e.ChainID = new(Hash)
 	newData, err = e.ChainID.UnmarshalBinaryData(newData)
 	if err != nil {
@@ -381,12 +389,10 @@ func (b *DBlockHeader) MarshalledSize() uint64 {
 }
 
 func (b *DBlockHeader) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
 	newData = data
+	if len(newData) < DBlockHeaderSize {
+		return nil, shortData("DBlockHeader", DBlockHeaderSize, newData)
+	}
 	b.Version, newData = newData[0], newData[1:]
 
 	b.NetworkID, newData = binary.BigEndian.Uint32(newData[0:4]), newData[4:]
@@ -532,12 +538,15 @@ func (c *DChain) AddFBlockToDBEntry(b block.IFBlock) (err error) {
 	return nil
 }
 
-// Add DBEntry
+// Add DBEntry, unless the block is full with MAX_DBLOCK_ENTRIES entries
 func (c *DChain) AddDBEntry(dbEntry *DBEntry) (err error) {
 
 	c.BlockMutex.Lock()
+	defer c.BlockMutex.Unlock()
+	if uint32(len(c.NextBlock.DBEntries)) >= MAX_DBLOCK_ENTRIES {
+		return fmt.Errorf("directory block of %v entries is full", len(c.NextBlock.DBEntries))
+	}
 	c.NextBlock.DBEntries = append(c.NextBlock.DBEntries, dbEntry)
-	c.BlockMutex.Unlock()
 
 	return nil
 }
@@ -642,12 +651,6 @@ func (b *DirectoryBlock) BuildKeyMerkleRoot() (err error) {
 }
 
 func (b *DirectoryBlock) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
-
 	newData = data
 
 	fbh := new(DBlockHeader)
@@ -658,6 +661,12 @@ func (b *DirectoryBlock) UnmarshalBinaryData(data []byte) (newData []byte, err e
 	b.Header = fbh
 
 	count := b.Header.BlockCount
+	if count > MAX_DBLOCK_ENTRIES {
+		return nil, overLimit("DirectoryBlock", "BlockCount", uint64(count), uint64(MAX_DBLOCK_ENTRIES))
+	}
+	if need := uint64(count) * uint64(HASH_LENGTH*2); need > uint64(len(newData)) {
+		return nil, shortData("DirectoryBlock", need, newData)
+	}
 	b.DBEntries = make([]*DBEntry, count)
 	for i := uint32(0); i < count; i++ {
 		b.DBEntries[i] = new(DBEntry)
@@ -727,13 +736,10 @@ func (b *DirBlockInfo) MarshalBinary() (data []byte, err error) {
 }
 
 func (b *DirBlockInfo) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
-
 	newData = data
+	if len(newData) < dirBlockInfoSize {
+		return nil, shortData("DirBlockInfo", dirBlockInfoSize, newData)
+	}
 
 	b.DBHash = new(Hash)
 	newData, err = b.DBHash.UnmarshalBinaryData(newData)
@@ -7,6 +7,7 @@ package common
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 )
 
 const (
@@ -24,8 +25,8 @@ type EBlock struct {
 var _ Printable = (*EBlock)(nil)
 var _ BinaryMarshallable = (*EBlock)(nil)
 
-func (c *EBlock) MarshalledSize() uint64 {
-	return uint64(EBHeaderSize)
+func (e *EBlock) MarshalledSize() uint64 {
+	return uint64(EBHeaderSize) + uint64(len(e.Body.EBEntries)*HASH_LENGTH)
 }
 
 // MakeEBlock creates a new Entry Block belonging to the provieded Entry Chain.
@@ -61,8 +62,16 @@ func NewEBlock() *EBlock {
 }
 
 // AddEBEntry creates a new Entry Block Entry from the provided Factom Entry
-// and adds it to the Entry Block Body.
+// and adds it to the Entry Block Body. It refuses an Entry over MAX_ENTRY_SIZE
+// and, keeping room for the 10 End of Minute markers, one that would take the
+// Entry Block past MAX_EBLOCK_ENTRIES.
 func (e *EBlock) AddEBEntry(entry *Entry) error {
+	if size := entry.PayloadSize(); size > uint64(MAX_ENTRY_SIZE) {
+		return fmt.Errorf("entry of %v bytes is over the limit of %v", size, MAX_ENTRY_SIZE)
+	}
+	if uint32(len(e.Body.EBEntries)) >= MAX_EBLOCK_ENTRIES-10 {
+		return fmt.Errorf("entry block of %v entries is full", len(e.Body.EBEntries))
+	}
 	e.Body.EBEntries = append(e.Body.EBEntries, entry.Hash())
 	return nil
 }
@@ -102,8 +111,15 @@ func (e *EBlock) Hash() (*Hash, error) {
 // calculated by the func (e *EBlockBody) MR() which is called by the func
 // (e *EBlock) BuildHeader().
 func (e *EBlock) KeyMR() (*Hash, error) {
-	// Sha(Sha(header) + BodyMR)
 	e.BuildHeader()
+	return e.HeaderKeyMR()
+}
+
+// HeaderKeyMR returns the KeyMR from the Entry Block Header as it is, without
+// rebuilding it from the Entry Block Body. It is the KeyMR of a block whose
+// Body is not available, like one read back from a pruned database.
+func (e *EBlock) HeaderKeyMR() (*Hash, error) {
+	// Sha(Sha(header) + BodyMR)
 	header, err := e.marshalHeaderBinary()
 	if err != nil {
 		return nil, err
@@ -157,6 +173,18 @@ func (e *EBlock) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+// MarshalHeaderBinary returns the serialized binary Entry Block Header as it
+// is, without rebuilding it from the Entry Block Body.
+func (e *EBlock) MarshalHeaderBinary() ([]byte, error) {
+	return e.marshalHeaderBinary()
+}
+
+// UnmarshalHeaderBinaryData populates only the Entry Block Header from the
+// serialized binary data.
+func (e *EBlock) UnmarshalHeaderBinaryData(data []byte) (newData []byte, err error) {
+	return e.unmarshalHeaderBinaryData(data)
+}
+
 // marshalBodyBinary returns a serialized binary Entry Block Body
 func (e *EBlock) marshalBodyBinary() ([]byte, error) {
 	buf := new(bytes.Buffer)
@@ -201,6 +229,12 @@ func (e *EBlock) marshalHeaderBinary() ([]byte, error) {
 
 // unmarshalBodyBinary builds the Entry Block Body from the serialized binary.
 func (e *EBlock) unmarshalBodyBinaryData(data []byte) (newData []byte, err error) {
+	if e.Header.EntryCount > MAX_EBLOCK_ENTRIES {
+		return nil, overLimit("EBlock", "EntryCount", uint64(e.Header.EntryCount), uint64(MAX_EBLOCK_ENTRIES))
+	}
+	if need := uint64(e.Header.EntryCount) * uint64(HASH_LENGTH); need > uint64(len(data)) {
+		return nil, shortData("EBlock", need, data)
+	}
 	buf := bytes.NewBuffer(data)
 	hash := make([]byte, 32)
 
@@ -225,6 +259,9 @@ func (e *EBlock) unmarshalBodyBinary(data []byte) (err error) {
 
 // unmarshalHeaderBinary builds the Entry Block Header from the serialized binary.
 func (e *EBlock) unmarshalHeaderBinaryData(data []byte) (newData []byte, err error) {
+	if len(data) < EBHeaderSize {
+		return nil, shortData("EBlockHeader", EBHeaderSize, data)
+	}
 	buf := bytes.NewBuffer(data)
 	hash := make([]byte, 32)
 	newData = data
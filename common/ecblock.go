@@ -7,8 +7,8 @@ package common
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
-	"io"
 )
 
 const (
@@ -30,9 +30,8 @@ type ECBlock struct {
 var _ Printable = (*ECBlock)(nil)
 var _ BinaryMarshallable = (*ECBlock)(nil)
 
-func (c *ECBlock) MarshalledSize() uint64 {
-	panic("Function not implemented")
-	return 0
+func (e *ECBlock) MarshalledSize() uint64 {
+	return e.headerMarshalledSize() + e.bodyMarshalledSize()
 }
 
 func NewECBlock() *ECBlock {
@@ -57,8 +56,14 @@ func NextECBlock(prev *ECBlock) (*ECBlock, error) {
 	return e, nil
 }
 
-func (e *ECBlock) AddEntry(entries ...ECBlockEntry) {
+// AddEntry adds the entries to the body, unless they would take it past
+// MAX_ECBLOCK_OBJECTS.
+func (e *ECBlock) AddEntry(entries ...ECBlockEntry) error {
+	if n := uint64(len(e.Body.Entries) + len(entries)); n > MAX_ECBLOCK_OBJECTS {
+		return fmt.Errorf("entry credit block of %v entries is over the limit of %v", n, MAX_ECBLOCK_OBJECTS)
+	}
 	e.Body.Entries = append(e.Body.Entries, entries...)
+	return nil
 }
 
 func (e *ECBlock) Hash() (*Hash, error) {
@@ -135,6 +140,30 @@ func (e *ECBlock) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+// bodyMarshalledSize is the size of the body, where each entry follows its
+// one byte ECID.
+func (e *ECBlock) bodyMarshalledSize() uint64 {
+	var size uint64 = 0
+	for _, v := range e.Body.Entries {
+		size += 1 + v.MarshalledSize()
+	}
+	return size
+}
+
+func (e *ECBlock) headerMarshalledSize() uint64 {
+	var size uint64 = 0
+	size += uint64(HASH_LENGTH) //ECChainID
+	size += uint64(HASH_LENGTH) //BodyHash
+	size += uint64(HASH_LENGTH) //PrevHeaderHash
+	size += uint64(HASH_LENGTH) //PrevLedgerKeyMR
+	size += 4                   //EBHeight
+	size += VarIntLength(uint64(len(e.Header.HeaderExpansionArea)))
+	size += uint64(len(e.Header.HeaderExpansionArea))
+	size += 8 //ObjectCount
+	size += 8 //BodySize
+	return size
+}
+
 func (e *ECBlock) marshalBodyBinary() ([]byte, error) {
 	buf := new(bytes.Buffer)
 
@@ -193,22 +222,22 @@ func (e *ECBlock) marshalHeaderBinary() ([]byte, error) {
 }
 
 func (e *ECBlock) unmarshalBodyBinaryData(data []byte) (newData []byte, err error) {
+	if e.Header.ObjectCount > MAX_ECBLOCK_OBJECTS {
+		return nil, overLimit("ECBlock", "ObjectCount", e.Header.ObjectCount, MAX_ECBLOCK_OBJECTS)
+	}
 	buf := bytes.NewBuffer(data)
 
 	for i := uint64(0); i < e.Header.ObjectCount; i++ {
 		var id byte
 		id, err = buf.ReadByte()
 		if err != nil {
-			newData = buf.Bytes()
-			return
+			return nil, shortData("ECBlock", 1, buf.Bytes())
 		}
 		switch id {
 		case ECIDServerIndexNumber:
 			s := NewServerIndexNumber()
 			if buf.Len() < ServerIndexNumberSize {
-				err = io.EOF
-				newData = buf.Bytes()
-				return
+				return nil, shortData("ECBlock", uint64(ServerIndexNumberSize), buf.Bytes())
 			}
 			_, err = s.UnmarshalBinaryData(buf.Next(ServerIndexNumberSize))
 			if err != nil {
@@ -219,9 +248,7 @@ func (e *ECBlock) unmarshalBodyBinaryData(data []byte) (newData []byte, err erro
 		case ECIDMinuteNumber:
 			m := NewMinuteNumber()
 			if buf.Len() < MinuteNumberSize {
-				err = io.EOF
-				newData = buf.Bytes()
-				return
+				return nil, shortData("ECBlock", uint64(MinuteNumberSize), buf.Bytes())
 			}
 			_, err = m.UnmarshalBinaryData(buf.Next(MinuteNumberSize))
 			if err != nil {
@@ -231,9 +258,7 @@ func (e *ECBlock) unmarshalBodyBinaryData(data []byte) (newData []byte, err erro
 			e.Body.Entries = append(e.Body.Entries, m)
 		case ECIDChainCommit:
 			if buf.Len() < CommitChainSize {
-				err = io.EOF
-				newData = buf.Bytes()
-				return
+				return nil, shortData("ECBlock", uint64(CommitChainSize), buf.Bytes())
 			}
 			c := NewCommitChain()
 			_, err = c.UnmarshalBinaryData(buf.Next(CommitChainSize))
@@ -243,9 +268,7 @@ func (e *ECBlock) unmarshalBodyBinaryData(data []byte) (newData []byte, err erro
 			e.Body.Entries = append(e.Body.Entries, c)
 		case ECIDEntryCommit:
 			if buf.Len() < CommitEntrySize {
-				err = io.EOF
-				newData = buf.Bytes()
-				return
+				return nil, shortData("ECBlock", uint64(CommitEntrySize), buf.Bytes())
 			}
 			c := NewCommitEntry()
 			_, err = c.UnmarshalBinaryData(buf.Next(CommitEntrySize))
@@ -262,8 +285,7 @@ func (e *ECBlock) unmarshalBodyBinaryData(data []byte) (newData []byte, err erro
 			e.Body.Entries = append(e.Body.Entries, c)
 			buf = bytes.NewBuffer(tmp)
 		default:
-			err = fmt.Errorf("Unsupported ECID: %x\n", id)
-			return
+			return nil, badData("ECBlock", "entry %v of unknown ECID %x", i, id)
 		}
 	}
 
@@ -277,6 +299,10 @@ func (b *ECBlock) unmarshalBodyBinary(data []byte) (err error) {
 }
 
 func (e *ECBlock) unmarshalHeaderBinaryData(data []byte) (newData []byte, err error) {
+	// The fixed fields before the Header Expansion Size
+	if len(data) < HASH_LENGTH*4+4 {
+		return nil, shortData("ECBlockHeader", uint64(HASH_LENGTH*4+4), data)
+	}
 	buf := bytes.NewBuffer(data)
 	hash := make([]byte, 32)
 
@@ -309,7 +335,17 @@ func (e *ECBlock) unmarshalHeaderBinaryData(data []byte) (newData []byte, err er
 	}
 
 	// read the Header Expansion Area
-	hesize, tmp := DecodeVarInt(buf.Bytes())
+	hesize, tmp, err := decodeVarInt("ECBlockHeader", buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	if hesize > MAX_HEADER_EXPANSION {
+		return nil, overLimit("ECBlockHeader", "Header Expansion Size", hesize, MAX_HEADER_EXPANSION)
+	}
+	// The Header Expansion Area, ObjectCount and BodySize
+	if need := hesize + 16; need > uint64(len(tmp)) {
+		return nil, shortData("ECBlockHeader", need, tmp)
+	}
 	buf = bytes.NewBuffer(tmp)
 	e.Header.HeaderExpansionArea = make([]byte, hesize)
 	if _, err = buf.Read(e.Header.HeaderExpansionArea); err != nil {
@@ -361,6 +397,48 @@ func NewECBlockBody() *ECBlockBody {
 	return b
 }
 
+// UnmarshalJSON reads the body from its JSON, where the ECID of each entry
+// tells which kind of ECBlockEntry it is.
+func (e *ECBlockBody) UnmarshalJSON(data []byte) error {
+	var body struct {
+		Entries []json.RawMessage
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return err
+	}
+
+	e.Entries = make([]ECBlockEntry, len(body.Entries))
+	for i, p := range body.Entries {
+		var t struct {
+			ECID *byte
+		}
+		if err := json.Unmarshal(p, &t); err != nil {
+			return err
+		}
+		if t.ECID == nil {
+			return fmt.Errorf("entry credit block entry %v has no ECID", i)
+		}
+		switch *t.ECID {
+		case ECIDServerIndexNumber:
+			e.Entries[i] = NewServerIndexNumber()
+		case ECIDMinuteNumber:
+			e.Entries[i] = NewMinuteNumber()
+		case ECIDChainCommit:
+			e.Entries[i] = NewCommitChain()
+		case ECIDEntryCommit:
+			e.Entries[i] = NewCommitEntry()
+		case ECIDBalanceIncrease:
+			e.Entries[i] = NewIncreaseBalance()
+		default:
+			return fmt.Errorf("entry credit block entry %v of unknown ECID %v", i, *t.ECID)
+		}
+		if err := json.Unmarshal(p, e.Entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *ECBlockBody) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
@@ -383,6 +461,7 @@ type ECBlockEntry interface {
 
 	ECID() byte
 	MarshalBinary() ([]byte, error)
+	MarshalledSize() uint64
 	UnmarshalBinary(data []byte) error
 	Hash() *Hash
 }
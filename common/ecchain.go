@@ -46,6 +46,10 @@ func (c *ECChain) MarshalBinary() ([]byte, error) {
 }
 
 func (c *ECChain) UnmarshalBinary(data []byte) error {
+	// The ChainID and the number of names
+	if len(data) < HASH_LENGTH+8 {
+		return shortData("ECChain", uint64(HASH_LENGTH+8), data)
+	}
 	buf := bytes.NewBuffer(data)
 	hash := make([]byte, 32)
 
@@ -55,21 +59,28 @@ func (c *ECChain) UnmarshalBinary(data []byte) error {
 		return err
 	}
 
-	count := uint64(0)
-	if err := binary.Read(buf, binary.BigEndian, count); err != nil {
+	var count uint64
+	if err := binary.Read(buf, binary.BigEndian, &count); err != nil {
 		return err
 	}
+	// Every name takes at least its 8 byte length
+	if count > uint64(buf.Len())/8 {
+		return shortCount("ECChain", "names", count, buf.Bytes())
+	}
 	c.Name = make([][]byte, count)
 
-	for _, name := range c.Name {
+	for i := range c.Name {
 		var l uint64
 		if err := binary.Read(buf, binary.BigEndian, &l); err != nil {
-			return err
+			return shortData("ECChain", 8, buf.Bytes())
+		}
+		if l > MAX_ECCHAIN_NAME_SIZE {
+			return overLimit("ECChain", "name size", l, MAX_ECCHAIN_NAME_SIZE)
 		}
-		name = make([]byte, l)
-		if _, err := buf.Read(name); err != nil {
-			return err
+		if l > uint64(buf.Len()) {
+			return shortData("ECChain", l, buf.Bytes())
 		}
+		c.Name[i] = append([]byte{}, buf.Next(int(l))...)
 	}
 
 	return nil
@@ -19,9 +19,11 @@ type EChain struct {
 
 var _ BinaryMarshallable = (*EChain)(nil)
 
-func (c *EChain) MarshalledSize() uint64 {
-	panic("Function not implemented")
-	return 0
+func (e *EChain) MarshalledSize() uint64 {
+	if e.FirstEntry == nil {
+		return uint64(HASH_LENGTH)
+	}
+	return uint64(HASH_LENGTH) + e.FirstEntry.MarshalledSize()
 }
 
 func NewEChain() *EChain {
@@ -48,6 +50,9 @@ func (e *EChain) MarshalBinary() ([]byte, error) {
 
 func (e *EChain) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
 	newData = data
+	if len(newData) < HASH_LENGTH {
+		return nil, shortData("EChain", uint64(HASH_LENGTH), newData)
+	}
 	buf := bytes.NewBuffer(newData)
 	hash := make([]byte, 32)
 
@@ -9,9 +9,12 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/binary"
-	"fmt"
 )
 
+// EntryHeaderSize is the size of the Version, the ChainID and the size of the
+// ExtIDs that start a marshalled Entry.
+const EntryHeaderSize = 35 // 1+32+2
+
 // An Entry is the element which carries user data
 // https://github.com/FactomProject/FactomDocs/blob/master/factomDataStructureDetails.md#entry
 type Entry struct {
@@ -24,9 +27,18 @@ type Entry struct {
 var _ Printable = (*Entry)(nil)
 var _ BinaryMarshallable = (*Entry)(nil)
 
-func (c *Entry) MarshalledSize() uint64 {
-	panic("Function not implemented")
-	return 0
+func (e *Entry) MarshalledSize() uint64 {
+	return uint64(EntryHeaderSize) + e.PayloadSize()
+}
+
+// PayloadSize returns the size of the marshalled ExtIDs and Content, the part
+// of the Entry that MAX_ENTRY_SIZE limits and that Entry Credits pay for.
+func (e *Entry) PayloadSize() uint64 {
+	size := uint64(len(e.Content))
+	for _, x := range e.ExtIDs {
+		size += 2 + uint64(len(x))
+	}
+	return size
 }
 
 func NewEntry() *Entry {
@@ -123,6 +135,10 @@ func (e *Entry) MarshalExtIDsBinary() ([]byte, error) {
 }
 
 func (e *Entry) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	// 1 byte Version, 32 byte ChainID and 2 byte size of ExtIDs
+	if len(data) < EntryHeaderSize {
+		return nil, shortData("Entry", EntryHeaderSize, data)
+	}
 	buf := bytes.NewBuffer(data)
 	hash := make([]byte, 32)
 
@@ -147,32 +163,32 @@ func (e *Entry) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
 	if err = binary.Read(buf, binary.BigEndian, &extSize); err != nil {
 		return
 	}
+	if buf.Len() > int(MAX_ENTRY_SIZE) {
+		return nil, overLimit("Entry", "size of the ExtIDs and the Content", uint64(buf.Len()), uint64(MAX_ENTRY_SIZE))
+	}
+	if int(extSize) > buf.Len() {
+		return nil, shortData("Entry", uint64(EntryHeaderSize)+uint64(extSize), data)
+	}
 
 	// ExtIDs
-	for i := int16(extSize); i > 0; {
-		var xsize int16
-		binary.Read(buf, binary.BigEndian, &xsize)
-		i -= 2
-		if i < 0 {
-			err = fmt.Errorf("Error parsing external IDs")
+	for i := int(extSize); i > 0; {
+		if i < 2 {
+			return nil, badData("Entry", "external IDs end within the size of one")
+		}
+		var xsize uint16
+		if err = binary.Read(buf, binary.BigEndian, &xsize); err != nil {
 			return
 		}
+		i -= 2
+		if int(xsize) > i {
+			return nil, badData("Entry", "external ID of %v bytes does not fit in the %v bytes of external IDs", xsize, extSize)
+		}
 		x := make([]byte, xsize)
-		var n int
-		if n, err = buf.Read(x); err != nil {
+		if _, err = buf.Read(x); err != nil {
 			return
-		} else {
-			if c := cap(x); n != c {
-				err = fmt.Errorf("Could not read ExtID: Read %d bytes of %d\n", n, c)
-				return
-			}
-			e.ExtIDs = append(e.ExtIDs, x)
-			i -= int16(n)
-			if i < 0 {
-				err = fmt.Errorf("Error parsing external IDs")
-				return
-			}
 		}
+		e.ExtIDs = append(e.ExtIDs, x)
+		i -= int(xsize)
 	}
 
 	// Content
@@ -32,6 +32,9 @@ func (h *Hash) UnmarshalText(b []byte) error {
 	if err != nil {
 		return err
 	}
+	if len(p) != HASH_LENGTH {
+		return fmt.Errorf("hash of %v bytes instead of %v", len(p), HASH_LENGTH)
+	}
 	copy(h.bytes[:], p)
 	return nil
 }
@@ -66,11 +69,9 @@ func (h *Hash) MarshalBinary() ([]byte, error) {
 }
 
 func (h *Hash) UnmarshalBinaryData(p []byte) (newData []byte, err error) {
-	defer func() {
-		if r := recover(); r != nil {
-			err = fmt.Errorf("Error unmarshalling: %v", r)
-		}
-	}()
+	if len(p) < HASH_LENGTH {
+		return nil, shortData("Hash", uint64(HASH_LENGTH), p)
+	}
 	copy(h.bytes[:], p)
 	newData = p[HASH_LENGTH:]
 	return
@@ -6,6 +6,7 @@ package common
 
 import (
 	"bytes"
+	"encoding/json"
 )
 
 //var IncreaseBalanceSize int = 32 + 4 + 32
@@ -19,13 +20,18 @@ type IncreaseBalance struct {
 
 var _ Printable = (*IncreaseBalance)(nil)
 
-//var _ BinaryMarshallable = (*IncreaseBalance)(nil)
+var _ BinaryMarshallable = (*IncreaseBalance)(nil)
 var _ ShortInterpretable = (*IncreaseBalance)(nil)
 var _ ECBlockEntry = (*IncreaseBalance)(nil)
 
-//func (c *IncreaseBalance) MarshalledSize() uint64 {
-//	return uint64(IncreaseBalanceSize)
-//}
+func (b *IncreaseBalance) MarshalledSize() uint64 {
+	var size uint64 = 0
+	size += 32                  //ECPubKey
+	size += uint64(HASH_LENGTH) //TXID
+	size += VarIntLength(b.Index)
+	size += VarIntLength(b.NumEC)
+	return size
+}
 
 func NewIncreaseBalance() *IncreaseBalance {
 	r := new(IncreaseBalance)
@@ -68,6 +74,10 @@ func (b *IncreaseBalance) MarshalBinary() ([]byte, error) {
 }
 
 func (b *IncreaseBalance) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	// The ECPubKey and the TXID before the Index
+	if len(data) < HASH_LENGTH*2 {
+		return nil, shortData("IncreaseBalance", uint64(HASH_LENGTH*2), data)
+	}
 	buf := bytes.NewBuffer(data)
 	hash := make([]byte, 32)
 
@@ -88,9 +98,15 @@ func (b *IncreaseBalance) UnmarshalBinaryData(data []byte) (newData []byte, err
 	b.TXID.SetBytes(hash)
 
 	tmp := make([]byte, 0)
-	b.Index, tmp = DecodeVarInt(buf.Bytes())
+	b.Index, tmp, err = decodeVarInt("IncreaseBalance", buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
 
-	b.NumEC, tmp = DecodeVarInt(tmp)
+	b.NumEC, tmp, err = decodeVarInt("IncreaseBalance", tmp)
+	if err != nil {
+		return nil, err
+	}
 
 	newData = tmp
 	return
@@ -101,6 +117,14 @@ func (b *IncreaseBalance) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+func (e *IncreaseBalance) MarshalJSON() ([]byte, error) {
+	type entry IncreaseBalance
+	return json.Marshal(&struct {
+		ECID byte
+		*entry
+	}{e.ECID(), (*entry)(e)})
+}
+
 func (e *IncreaseBalance) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
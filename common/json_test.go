@@ -0,0 +1,121 @@
+package common_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// checkJSON decodes the JSON of v into w and checks that w has the same JSON
+// and binary forms as v.
+func checkJSON(t *testing.T, name string, v, w common.BinaryMarshallable) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	if err := json.Unmarshal(p, w); err != nil {
+		t.Fatalf("%v does not decode its own JSON: %v\n%s", name, err, p)
+	}
+	q, err := json.Marshal(w)
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	if !bytes.Equal(p, q) {
+		t.Errorf("%v JSON changes in a round trip\n%s\n%s", name, p, q)
+	}
+
+	p, err = v.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	q, err = w.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%v decoded from JSON: %v", name, err)
+	}
+	if !bytes.Equal(p, q) {
+		t.Errorf("%v binary changes in a JSON round trip\n%x\n%x", name, p, q)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	db := sampleDBlock()
+	db.DBHash = common.Sha([]byte("dblock"))
+	checkJSON(t, "DirectoryBlock", db, common.NewDBlock())
+
+	info := common.NewDirBlockInfoFromDBlock(db)
+	info.BTCTxHash = common.Sha([]byte("tx"))
+	info.BTCBlockHash = common.Sha([]byte("block"))
+	info.BTCTxOffset = 3
+	info.BTCBlockHeight = 370000
+	info.BTCConfirmed = true
+	checkJSON(t, "DirBlockInfo", info, new(common.DirBlockInfo))
+
+	e := sampleEntry()
+	e2 := new(common.Entry)
+	checkJSON(t, "Entry", e, e2)
+	if !e.Hash().IsSameAs(e2.Hash()) {
+		t.Errorf("Entry hash %v is %v after a JSON round trip", e.Hash(), e2.Hash())
+	}
+
+	eb := sampleEBlock()
+	eb2 := new(common.EBlock)
+	checkJSON(t, "EBlock", eb, eb2)
+	k, _ := eb.KeyMR()
+	k2, _ := eb2.KeyMR()
+	if !k.IsSameAs(k2) {
+		t.Errorf("EBlock KeyMR %v is %v after a JSON round trip", k, k2)
+	}
+
+	ecb := sampleECBlock()
+	ecb2 := new(common.ECBlock)
+	checkJSON(t, "ECBlock", ecb, ecb2)
+	for i, entry := range ecb.Body.Entries {
+		if entry.ECID() != ecb2.Body.Entries[i].ECID() {
+			t.Errorf("ECBlock entry %v of ECID %v is %v after a JSON round trip", i, entry.ECID(), ecb2.Body.Entries[i].ECID())
+		}
+	}
+	h, _ := ecb.HeaderHash()
+	h2, _ := ecb2.HeaderHash()
+	if !h.IsSameAs(h2) {
+		t.Errorf("ECBlock header hash %v is %v after a JSON round trip", h, h2)
+	}
+
+	ab := sampleABlock()
+	ab2 := new(common.AdminBlock)
+	checkJSON(t, "AdminBlock", ab, ab2)
+	for i, entry := range ab.ABEntries {
+		if entry.Type() != ab2.ABEntries[i].Type() {
+			t.Errorf("AdminBlock entry %v of type %v is %v after a JSON round trip", i, entry.Type(), ab2.ABEntries[i].Type())
+		}
+	}
+	l, _ := ab.LedgerKeyMR()
+	l2, _ := ab2.LedgerKeyMR()
+	if !l.IsSameAs(l2) {
+		t.Errorf("AdminBlock LedgerKeyMR %v is %v after a JSON round trip", l, l2)
+	}
+}
+
+func TestJSONInvalid(t *testing.T) {
+	p, _ := json.Marshal(sampleECBlock())
+	for _, s := range []string{
+		strings.Replace(string(p), `"ECID":0,`, ``, 1),
+		strings.Replace(string(p), `"ECID":0,`, `"ECID":9,`, 1),
+	} {
+		if err := json.Unmarshal([]byte(s), new(common.ECBlock)); err == nil {
+			t.Errorf("ECBlock entry without a known ECID decodes\n%s", s)
+		}
+	}
+
+	p, _ = json.Marshal(sampleABlock())
+	s := strings.Replace(string(p), `"Type":0,`, `"Type":9,`, 1)
+	if err := json.Unmarshal([]byte(s), new(common.AdminBlock)); err == nil {
+		t.Errorf("AdminBlock entry of an unknown type decodes\n%s", s)
+	}
+
+	if err := json.Unmarshal([]byte(`{"ChainID":"0a0b"}`), new(common.Entry)); err == nil {
+		t.Errorf("Entry with a ChainID of 2 bytes decodes")
+	}
+}
@@ -58,6 +58,9 @@ func (pk *PublicKey) UnmarshalText(b []byte) error {
 	if err != nil {
 		return err
 	}
+	if len(p) != ed25519.PublicKeySize {
+		return errors.New("Invalid public key length!")
+	}
 	pk.Key = new([32]byte)
 	copy(pk.Key[:], p)
 	return nil
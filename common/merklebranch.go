@@ -0,0 +1,291 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MerkleNode is one step of a MerkleBranch: the hash the running hash is
+// paired with on the way up to the root. Left tells that Hash is the left
+// side of the pair.
+type MerkleNode struct {
+	Hash *Hash `json:"hash"`
+	Left bool  `json:"left,omitempty"`
+}
+
+// MerkleBranch proves that Leaf is in the merkle tree with Root. Hashing
+// Leaf with each of the Nodes in turn, as built by BuildMerkleTreeStore,
+// gives Root. Branches that meet, where the root of one is the leaf of the
+// next, are joined with Append to prove a leaf all the way up to the last
+// root.
+//
+// The binary form is Leaf (32 bytes), Root (32 bytes), the number of nodes
+// as a varint, then each node as a byte, 1 for a left one and 0 for a right
+// one, followed by its hash.
+type MerkleBranch struct {
+	Leaf  *Hash         `json:"leaf"`
+	Nodes []*MerkleNode `json:"nodes"`
+	Root  *Hash         `json:"root"`
+}
+
+var _ Printable = (*MerkleBranch)(nil)
+var _ BinaryMarshallable = (*MerkleBranch)(nil)
+
+// BuildMerkleBranch returns the branch of the hash at index in the merkle
+// tree BuildMerkleTreeStore builds from hashes.
+func BuildMerkleBranch(hashes []*Hash, index int) (*MerkleBranch, error) {
+	if index < 0 || index >= len(hashes) {
+		return nil, fmt.Errorf("index %v is not in the %v hashes", index, len(hashes))
+	}
+
+	merkles := BuildMerkleTreeStore(hashes)
+	b := &MerkleBranch{Leaf: hashes[index], Root: merkles[len(merkles)-1]}
+	b.Nodes = make([]*MerkleNode, 0)
+
+	// Each level of the tree takes half as many places as the one below it
+	offset := 0
+	width := nextPowerOfTwo(len(hashes))
+	for ; width > 1; width /= 2 {
+		var node *MerkleNode
+		if index%2 == 0 {
+			// A left child without a right one is hashed with itself
+			sibling := merkles[offset+index+1]
+			if sibling == nil {
+				sibling = merkles[offset+index]
+			}
+			node = &MerkleNode{Hash: sibling}
+		} else {
+			node = &MerkleNode{Hash: merkles[offset+index-1], Left: true}
+		}
+		b.Nodes = append(b.Nodes, node)
+
+		offset += width
+		index /= 2
+	}
+	return b, nil
+}
+
+// Append joins next, which starts at the root of b, to the end of b.
+func (b *MerkleBranch) Append(next *MerkleBranch) (*MerkleBranch, error) {
+	if !b.Root.IsSameAs(next.Leaf) {
+		return nil, fmt.Errorf("merkle branch to %v does not continue with one from %v", b.Root, next.Leaf)
+	}
+	j := &MerkleBranch{Leaf: b.Leaf, Root: next.Root}
+	j.Nodes = make([]*MerkleNode, 0, len(b.Nodes)+len(next.Nodes))
+	j.Nodes = append(j.Nodes, b.Nodes...)
+	j.Nodes = append(j.Nodes, next.Nodes...)
+	return j, nil
+}
+
+// Verify checks that the nodes of the branch lead from the leaf to the root.
+func (b *MerkleBranch) Verify() error {
+	_, err := b.path()
+	return err
+}
+
+// path returns the hashes the branch goes through, from the leaf up to the
+// root, after checking that it does lead to the root.
+func (b *MerkleBranch) path() ([]*Hash, error) {
+	if b.Leaf == nil || b.Root == nil {
+		return nil, fmt.Errorf("merkle branch without a leaf or a root")
+	}
+	path := make([]*Hash, 0, len(b.Nodes)+1)
+	h := b.Leaf
+	path = append(path, h)
+	for i, node := range b.Nodes {
+		if node == nil || node.Hash == nil {
+			return nil, fmt.Errorf("merkle branch node %v has no hash", i)
+		}
+		if node.Left {
+			h = hashMerkleBranches(node.Hash, h)
+		} else {
+			h = hashMerkleBranches(h, node.Hash)
+		}
+		path = append(path, h)
+	}
+	if !h.IsSameAs(b.Root) {
+		return nil, fmt.Errorf("merkle branch leads to %v instead of %v", h, b.Root)
+	}
+	return path, nil
+}
+
+func (b *MerkleBranch) MarshalledSize() uint64 {
+	size := uint64(HASH_LENGTH * 2)
+	size += VarIntLength(uint64(len(b.Nodes)))
+	size += uint64(len(b.Nodes) * (1 + HASH_LENGTH))
+	return size
+}
+
+func (b *MerkleBranch) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+
+	if b.Leaf == nil || b.Root == nil {
+		return nil, fmt.Errorf("merkle branch without a leaf or a root")
+	}
+	buf.Write(b.Leaf.Bytes())
+	buf.Write(b.Root.Bytes())
+	EncodeVarInt(&buf, uint64(len(b.Nodes)))
+	for i, node := range b.Nodes {
+		if node == nil || node.Hash == nil {
+			return nil, fmt.Errorf("merkle branch node %v has no hash", i)
+		}
+		if node.Left {
+			buf.WriteByte(1)
+		} else {
+			buf.WriteByte(0)
+		}
+		buf.Write(node.Hash.Bytes())
+	}
+	return buf.Bytes(), nil
+}
+
+func (b *MerkleBranch) UnmarshalBinaryData(data []byte) (newData []byte, err error) {
+	newData = data
+	if len(newData) < HASH_LENGTH*2+1 {
+		return nil, shortData("MerkleBranch", uint64(HASH_LENGTH*2+1), newData)
+	}
+
+	b.Leaf = NewHash()
+	newData, err = b.Leaf.UnmarshalBinaryData(newData)
+	if err != nil {
+		return
+	}
+	b.Root = NewHash()
+	newData, err = b.Root.UnmarshalBinaryData(newData)
+	if err != nil {
+		return
+	}
+
+	count, newData, err := decodeVarInt("MerkleBranch", newData)
+	if err != nil {
+		return nil, err
+	}
+	if count > MAX_MERKLE_BRANCH {
+		return nil, overLimit("MerkleBranch", "node count", count, MAX_MERKLE_BRANCH)
+	}
+	if count > uint64(len(newData)/(1+HASH_LENGTH)) {
+		return nil, shortCount("MerkleBranch", "nodes", count, newData)
+	}
+	b.Nodes = make([]*MerkleNode, count)
+	for i := range b.Nodes {
+		node := &MerkleNode{Hash: NewHash()}
+		switch newData[0] {
+		case 0:
+		case 1:
+			node.Left = true
+		default:
+			return nil, badData("MerkleBranch", "node %v has side %v", i, newData[0])
+		}
+		newData, err = node.Hash.UnmarshalBinaryData(newData[1:])
+		if err != nil {
+			return
+		}
+		b.Nodes[i] = node
+	}
+	return
+}
+
+func (b *MerkleBranch) UnmarshalBinary(data []byte) (err error) {
+	_, err = b.UnmarshalBinaryData(data)
+	return
+}
+
+func (b *MerkleBranch) JSONByte() ([]byte, error) {
+	return EncodeJSON(b)
+}
+
+func (b *MerkleBranch) JSONString() (string, error) {
+	return EncodeJSONString(b)
+}
+
+func (b *MerkleBranch) JSONBuffer(buf *bytes.Buffer) error {
+	return EncodeJSONToBuffer(b, buf)
+}
+
+func (b *MerkleBranch) Spew() string {
+	return Spew(b)
+}
+
+// EntryMerkleBranch returns the branch of an entry hash up to the body
+// merkle root of the Entry Block, which is the BodyMR of its header.
+func (e *EBlockBody) EntryMerkleBranch(entryHash *Hash) (*MerkleBranch, error) {
+	for i, h := range e.EBEntries {
+		if h.IsSameAs(entryHash) {
+			return BuildMerkleBranch(e.EBEntries, i)
+		}
+	}
+	return nil, fmt.Errorf("entry %v is not in the entry block", entryHash)
+}
+
+// KeyMRMerkleBranch returns the one step branch from the BodyMR of the
+// Entry Block Header up to the KeyMR, through the hash of the header.
+func (e *EBlock) KeyMRMerkleBranch() (*MerkleBranch, error) {
+	keyMR, err := e.KeyMR()
+	if err != nil {
+		return nil, err
+	}
+	header, err := e.marshalHeaderBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &MerkleBranch{
+		Leaf:  e.Header.BodyMR,
+		Nodes: []*MerkleNode{{Hash: Sha(header), Left: true}},
+		Root:  keyMR,
+	}, nil
+}
+
+// EBlockMerkleBranch returns the branch of the block with keyMR listed in
+// the Directory Block up to its body merkle root, the BodyMR of its header.
+// The body is built from the hashes of the ChainID and KeyMR pairs, so the
+// ChainID is the first node.
+func (b *DirectoryBlock) EBlockMerkleBranch(keyMR *Hash) (*MerkleBranch, error) {
+	hashes := make([]*Hash, len(b.DBEntries))
+	index := -1
+	for i, entry := range b.DBEntries {
+		data, err := entry.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		hashes[i] = Sha(data)
+		if index < 0 && entry.KeyMR.IsSameAs(keyMR) {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("block %v is not in the directory block", keyMR)
+	}
+
+	body, err := BuildMerkleBranch(hashes, index)
+	if err != nil {
+		return nil, err
+	}
+	entry := &MerkleBranch{
+		Leaf:  keyMR,
+		Nodes: []*MerkleNode{{Hash: b.DBEntries[index].ChainID, Left: true}},
+		Root:  hashes[index],
+	}
+	return entry.Append(body)
+}
+
+// KeyMRMerkleBranch returns the one step branch from the BodyMR of the
+// Directory Block Header up to the KeyMR, through the hash of the header.
+func (b *DirectoryBlock) KeyMRMerkleBranch() (*MerkleBranch, error) {
+	err := b.BuildKeyMerkleRoot()
+	if err != nil {
+		return nil, err
+	}
+	header, err := b.Header.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	return &MerkleBranch{
+		Leaf:  b.Header.BodyMR,
+		Nodes: []*MerkleNode{{Hash: Sha(header), Left: true}},
+		Root:  b.KeyMR,
+	}, nil
+}
@@ -0,0 +1,138 @@
+package common_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+func TestBuildMerkleBranch(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		hashes := make([]*common.Hash, n)
+		for i := range hashes {
+			hashes[i] = common.Sha([]byte(fmt.Sprint(i)))
+		}
+		merkles := common.BuildMerkleTreeStore(hashes)
+		root := merkles[len(merkles)-1]
+
+		for i := range hashes {
+			b, err := common.BuildMerkleBranch(hashes, i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !b.Leaf.IsSameAs(hashes[i]) || !b.Root.IsSameAs(root) {
+				t.Errorf("branch %v of %v goes from %v to %v", i, n, b.Leaf, b.Root)
+			}
+			if err := b.Verify(); err != nil {
+				t.Errorf("branch %v of %v: %v", i, n, err)
+			}
+
+			b.Leaf = common.Sha([]byte("other"))
+			if err := b.Verify(); err == nil {
+				t.Errorf("branch %v of %v verifies another leaf", i, n)
+			}
+		}
+	}
+
+	if _, err := common.BuildMerkleBranch(nil, 0); err == nil {
+		t.Error("BuildMerkleBranch accepted an index out of range")
+	}
+}
+
+func TestEntryToDBlockBranch(t *testing.T) {
+	eb := common.NewEBlock()
+	eb.Header.ChainID = common.Sha([]byte("chain"))
+	var entries []*common.Hash
+	for i := 0; i < 5; i++ {
+		h := common.Sha([]byte(fmt.Sprint("entry ", i)))
+		entries = append(entries, h)
+		eb.Body.EBEntries = append(eb.Body.EBEntries, h)
+	}
+	eb.AddEndOfMinuteMarker(1)
+	keyMR, _ := eb.KeyMR()
+
+	db := common.NewDBlock()
+	db.Header.DBHeight = 7
+	for i := 0; i < 3; i++ {
+		db.DBEntries = append(db.DBEntries, &common.DBEntry{
+			ChainID: common.Sha([]byte(fmt.Sprint("other chain ", i))),
+			KeyMR:   common.Sha([]byte(fmt.Sprint("other block ", i))),
+		})
+	}
+	dbEntry, _ := common.NewDBEntry(eb)
+	db.DBEntries = append(db.DBEntries, dbEntry)
+	db.Header.BlockCount = uint32(len(db.DBEntries))
+	db.Header.BodyMR, _ = db.BuildBodyMR()
+
+	b, err := eb.Body.EntryMerkleBranch(entries[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ebKeyMR, err := eb.KeyMRMerkleBranch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbBody, err := db.EBlockMerkleBranch(keyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbKeyMR, err := db.KeyMRMerkleBranch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, next := range []*common.MerkleBranch{ebKeyMR, dbBody, dbKeyMR} {
+		if err := next.Verify(); err != nil {
+			t.Error(err)
+		}
+		b, err = b.Append(next)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Verify(); err != nil {
+		t.Error(err)
+	}
+	if !b.Leaf.IsSameAs(entries[3]) || !b.Root.IsSameAs(db.KeyMR) {
+		t.Errorf("branch goes from %v to %v, want %v to %v", b.Leaf, b.Root, entries[3], db.KeyMR)
+	}
+
+	if _, err := dbKeyMR.Append(b); err == nil {
+		t.Error("Append joined branches that do not meet")
+	}
+	if _, err := eb.Body.EntryMerkleBranch(common.Sha([]byte("missing"))); err == nil {
+		t.Error("EntryMerkleBranch of a missing entry")
+	}
+
+	// Binary and JSON round trips
+	p, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uint64(len(p)) != b.MarshalledSize() {
+		t.Errorf("MarshalledSize %v, marshalled %v bytes", b.MarshalledSize(), len(p))
+	}
+	b2 := new(common.MerkleBranch)
+	if err := b2.UnmarshalBinary(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := b2.Verify(); err != nil || len(b2.Nodes) != len(b.Nodes) {
+		t.Errorf("unmarshalled branch of %v nodes: %v", len(b2.Nodes), err)
+	}
+	if err := new(common.MerkleBranch).UnmarshalBinary(p[:len(p)-1]); err == nil {
+		t.Error("UnmarshalBinary accepted a cut short branch")
+	}
+
+	j, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b3 := new(common.MerkleBranch)
+	if err := json.Unmarshal(j, b3); err != nil {
+		t.Fatal(err)
+	}
+	if err := b3.Verify(); err != nil || !b3.Root.IsSameAs(b.Root) {
+		t.Errorf("branch from JSON %s: %v", j, err)
+	}
+}
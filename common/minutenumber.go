@@ -6,6 +6,7 @@ package common
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 )
 
@@ -60,7 +61,7 @@ func (m *MinuteNumber) UnmarshalBinaryData(data []byte) (newData []byte, err err
 	buf := bytes.NewBuffer(data)
 	var c byte
 	if c, err = buf.ReadByte(); err != nil {
-		return
+		return nil, shortData("MinuteNumber", 1, data)
 	} else {
 		m.Number = c
 	}
@@ -73,6 +74,14 @@ func (m *MinuteNumber) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+func (e *MinuteNumber) MarshalJSON() ([]byte, error) {
+	type entry MinuteNumber
+	return json.Marshal(&struct {
+		ECID byte
+		*entry
+	}{e.ECID(), (*entry)(e)})
+}
+
 func (e *MinuteNumber) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
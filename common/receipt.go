@@ -0,0 +1,124 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// Receipt proves that an entry is recorded in a directory block and, once
+// the directory block is anchored, ties it to a Bitcoin transaction. Verify
+// checks a receipt on its own, without a Factom node.
+type Receipt struct {
+	// Entry is the hash of the entry
+	Entry *Hash `json:"entry"`
+
+	// EBlockKeyMR is the key merkle root of the entry block holding the entry
+	EBlockKeyMR *Hash `json:"eblockkeymr"`
+
+	// DBlockHeader is the header of the directory block holding the entry
+	// block, which gives its height
+	DBlockHeader *DBlockHeader `json:"dblockheader"`
+
+	// MerkleBranch leads from the entry up to the KeyMR of the directory
+	// block, through the entry block KeyMR
+	MerkleBranch *MerkleBranch `json:"merklebranch"`
+
+	// Anchor records the Bitcoin transaction anchoring the directory block.
+	// It is nil until the anchor is confirmed.
+	Anchor *DirBlockInfo `json:"anchor,omitempty"`
+}
+
+var _ Printable = (*Receipt)(nil)
+
+// Verify checks that the merkle branch of the receipt leads from the entry,
+// through its entry block and the directory block header, up to the KeyMR
+// of the directory block, and that the anchor is for that KeyMR and height.
+func (r *Receipt) Verify() error {
+	if r.Entry == nil || r.EBlockKeyMR == nil || r.DBlockHeader == nil || r.MerkleBranch == nil {
+		return fmt.Errorf("receipt is incomplete")
+	}
+	b := r.MerkleBranch
+	if !r.Entry.IsSameAs(b.Leaf) {
+		return fmt.Errorf("receipt branch starts at %v instead of entry %v", b.Leaf, r.Entry)
+	}
+	path, err := b.path()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, h := range path {
+		if h.IsSameAs(r.EBlockKeyMR) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("receipt branch does not go through entry block %v", r.EBlockKeyMR)
+	}
+
+	// The last step hashes the directory block header with its BodyMR
+	header, err := r.DBlockHeader.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if len(b.Nodes) == 0 {
+		return fmt.Errorf("receipt branch does not end with the directory block header")
+	}
+	last := b.Nodes[len(b.Nodes)-1]
+	if !last.Left || !last.Hash.IsSameAs(Sha(header)) {
+		return fmt.Errorf("receipt branch does not end with the directory block header")
+	}
+	if !path[len(path)-2].IsSameAs(r.DBlockHeader.BodyMR) {
+		return fmt.Errorf("receipt branch does not go through the directory block BodyMR")
+	}
+
+	if r.Anchor != nil {
+		if !r.Anchor.BTCConfirmed || r.Anchor.BTCTxHash == nil || r.Anchor.BTCBlockHash == nil {
+			return fmt.Errorf("receipt anchor is not confirmed")
+		}
+		if r.Anchor.DBMerkleRoot == nil || !r.Anchor.DBMerkleRoot.IsSameAs(b.Root) {
+			return fmt.Errorf("receipt anchor is for %v instead of %v", r.Anchor.DBMerkleRoot, b.Root)
+		}
+		if r.Anchor.DBHeight != r.DBlockHeader.DBHeight {
+			return fmt.Errorf("receipt anchor is at height %v instead of %v", r.Anchor.DBHeight, r.DBlockHeader.DBHeight)
+		}
+	}
+	return nil
+}
+
+// AnchorData returns the data the OP_RETURN output of the anchoring Bitcoin
+// transaction carries, as the anchor package writes it: "Fa", the directory
+// block height in 6 bytes and the directory block KeyMR. Verify does not
+// reach Bitcoin; comparing AnchorData with the output of the transaction
+// Anchor.BTCTxHash in block Anchor.BTCBlockHash completes the proof.
+func (r *Receipt) AnchorData() []byte {
+	height := make([]byte, 8)
+	binary.BigEndian.PutUint64(height, uint64(r.DBlockHeader.DBHeight))
+
+	data := []byte{'F', 'a'}
+	data = append(data, height[2:]...)
+	data = append(data, r.MerkleBranch.Root.Bytes()...)
+	return data
+}
+
+func (r *Receipt) JSONByte() ([]byte, error) {
+	return EncodeJSON(r)
+}
+
+func (r *Receipt) JSONString() (string, error) {
+	return EncodeJSONString(r)
+}
+
+func (r *Receipt) JSONBuffer(b *bytes.Buffer) error {
+	return EncodeJSONToBuffer(r, b)
+}
+
+func (r *Receipt) Spew() string {
+	return Spew(r)
+}
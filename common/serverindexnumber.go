@@ -6,6 +6,7 @@ package common
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 )
 
@@ -60,7 +61,7 @@ func (s *ServerIndexNumber) UnmarshalBinaryData(data []byte) (newData []byte, er
 	buf := bytes.NewBuffer(data)
 	var c byte
 	if c, err = buf.ReadByte(); err != nil {
-		return
+		return nil, shortData("ServerIndexNumber", 1, data)
 	} else {
 		s.Number = c
 	}
@@ -73,6 +74,14 @@ func (s *ServerIndexNumber) UnmarshalBinary(data []byte) (err error) {
 	return
 }
 
+func (e *ServerIndexNumber) MarshalJSON() ([]byte, error) {
+	type entry ServerIndexNumber
+	return json.Marshal(&struct {
+		ECID byte
+		*entry
+	}{e.ECID(), (*entry)(e)})
+}
+
 func (e *ServerIndexNumber) JSONByte() ([]byte, error) {
 	return EncodeJSON(e)
 }
@@ -0,0 +1,113 @@
+package common_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+func checkSize(t *testing.T, name string, v common.BinaryMarshallable) {
+	p, err := v.MarshalBinary()
+	if err != nil {
+		t.Fatalf("%v: %v", name, err)
+	}
+	if size := v.MarshalledSize(); size != uint64(len(p)) {
+		t.Errorf("%v MarshalledSize is %v, marshals to %v bytes", name, size, len(p))
+	}
+}
+
+func TestMarshalledSize(t *testing.T) {
+	// Every type with a sample, as decoded from it
+	for _, d := range decoders() {
+		data, err := d.sample()
+		if err != nil {
+			t.Fatalf("%v: %v", d.name, err)
+		}
+		v, ok := d.newV().(common.BinaryMarshallable)
+		if !ok {
+			continue
+		}
+		if err := v.UnmarshalBinary(data); err != nil {
+			t.Fatalf("%v: %v", d.name, err)
+		}
+		if size := v.MarshalledSize(); size != uint64(len(data)) {
+			t.Errorf("%v MarshalledSize is %v, decoded from %v bytes", d.name, size, len(data))
+		}
+	}
+
+	// Empty values
+	checkSize(t, "empty Entry", common.NewEntry())
+	checkSize(t, "empty ECBlock", common.NewECBlock())
+	checkSize(t, "empty DirectoryBlock", common.NewDBlock())
+	checkSize(t, "empty EChain", common.NewEChain())
+	checkSize(t, "empty MerkleBranch", &common.MerkleBranch{Leaf: common.NewHash(), Root: common.NewHash()})
+
+	// Variable integers of every length
+	for shift := uint(0); shift < 64; shift += 7 {
+		ib := common.NewIncreaseBalance()
+		ib.ECPubKey = new([32]byte)
+		ib.Index = 1 << shift
+		ib.NumEC = 1<<shift - 1
+		checkSize(t, "IncreaseBalance", ib)
+
+		b := sampleECBlock()
+		b.Header.HeaderExpansionArea = make([]byte, shift)
+		b.AddEntry(ib)
+		checkSize(t, "ECBlock", b)
+	}
+
+	e := sampleEntry()
+	e.ExtIDs = append(e.ExtIDs, []byte{}, make([]byte, 300))
+	e.Content = make([]byte, common.MAX_ENTRY_SIZE)
+	checkSize(t, "large Entry", e)
+	c := common.NewEChain()
+	c.FirstEntry = e
+	checkSize(t, "EChain", c)
+	c.FirstEntry = nil
+	if size := c.MarshalledSize(); size != uint64(common.HASH_LENGTH) {
+		t.Errorf("EChain without a FirstEntry MarshalledSize is %v", size)
+	}
+
+	ab := sampleABlock()
+	ab.Header.HeaderExpansionSize = 200
+	ab.Header.HeaderExpansionArea = make([]byte, 200)
+	checkSize(t, "AdminBlock", ab)
+}
+
+func TestBuilderLimits(t *testing.T) {
+	eb := common.NewEBlock()
+	e := sampleEntry()
+	e.Content = nil
+	e.Content = make([]byte, int(common.MAX_ENTRY_SIZE)-int(e.PayloadSize()))
+	if err := eb.AddEBEntry(e); err != nil {
+		t.Errorf("Entry of MAX_ENTRY_SIZE: %v", err)
+	}
+	e.Content = append(e.Content, 0)
+	if err := eb.AddEBEntry(e); err == nil {
+		t.Errorf("Entry over MAX_ENTRY_SIZE added to the EBlock")
+	}
+	eb.Body.EBEntries = make([]*common.Hash, common.MAX_EBLOCK_ENTRIES-10)
+	if err := eb.AddEBEntry(sampleEntry()); err == nil {
+		t.Errorf("Entry added to a full EBlock")
+	}
+
+	ecb := common.NewECBlock()
+	if err := ecb.AddEntry(make([]common.ECBlockEntry, common.MAX_ECBLOCK_OBJECTS+1)...); err == nil {
+		t.Errorf("ECBlock over MAX_ECBLOCK_OBJECTS")
+	}
+	if n := len(ecb.Body.Entries); n != 0 {
+		t.Errorf("ECBlock over the limit holds %v entries", n)
+	}
+
+	ab := sampleABlock()
+	ab.ABEntries = make([]common.ABEntry, common.MAX_ABLOCK_ENTRIES)
+	if err := ab.AddEndOfMinuteMarker(1); err == nil {
+		t.Errorf("entry added to a full AdminBlock")
+	}
+
+	dc := common.NewDChain()
+	dc.NextBlock.DBEntries = make([]*common.DBEntry, common.MAX_DBLOCK_ENTRIES)
+	if err := dc.AddDBEntry(&common.DBEntry{}); err == nil {
+		t.Errorf("entry added to a full DirectoryBlock")
+	}
+}
@@ -16,6 +16,9 @@ func DecodeVarInt(data []byte) (uint64, []byte) {
 		cnt int
 		b   byte
 	)
+	if len(data) == 0 {
+		return 0, data
+	}
 
 	for cnt, b = range data {
 		v = v << 7
@@ -28,6 +31,22 @@ func DecodeVarInt(data []byte) (uint64, []byte) {
 	return v, data[cnt+1:]
 }
 
+// decodeVarInt is DecodeVarInt for the binary decoders of type typ. It
+// returns a DecodeError for data that ends within the variable integer or
+// for one of more than 10 bytes, which cannot hold a uint64.
+func decodeVarInt(typ string, data []byte) (uint64, []byte, error) {
+	for i := 0; i < len(data) && i < 10; i++ {
+		if data[i] < 0x80 {
+			v, rest := DecodeVarInt(data)
+			return v, rest, nil
+		}
+	}
+	if len(data) < 10 {
+		return 0, nil, shortData(typ, uint64(len(data)+1), data)
+	}
+	return 0, nil, badData(typ, "variable integer of more than 10 bytes")
+}
+
 // Encode an integer as a variable int into the given data buffer.
 func EncodeVarInt(out *bytes.Buffer, v uint64) error {
 	if v == 0 {
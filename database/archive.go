@@ -0,0 +1,369 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/factoid/block"
+)
+
+// An archive holds a range of directory block heights, so a node can be
+// seeded offline. It starts with archiveMagic and is followed by one record
+// per height:
+//
+//	height (4 bytes) | payload length (4 bytes) | payload | sha256 of payload (32 bytes)
+//
+// The payload is the blocks and entries of the height, each as
+//
+//	type (1 byte) | length (4 bytes) | MarshalBinary of the block or entry
+//
+// starting with the directory block. All integers are big endian.
+var archiveMagic = []byte("FactomArchive\x01")
+
+// The types of the blocks and entries in an archive payload
+const (
+	archiveDBlock byte = iota + 1
+	archiveABlock
+	archiveECBlock
+	archiveFBlock
+	archiveEBlock
+	archiveEntry
+)
+
+// maxArchivePayload bounds the payload of one height, so a corrupt length
+// cannot make ReadHeight allocate without limit.
+const maxArchivePayload = 1 << 30
+
+// ArchiveHeight is everything recorded at one directory block height.
+type ArchiveHeight struct {
+	DBlock  *common.DirectoryBlock
+	ABlock  *common.AdminBlock
+	ECBlock *common.ECBlock
+	FBlock  block.IFBlock
+	EBlocks []*common.EBlock
+	Entries []*common.Entry
+}
+
+// FetchArchiveHeight gets the directory block at height with every block
+// and entry it lists.
+func FetchArchiveHeight(db Db, height uint32) (*ArchiveHeight, error) {
+	dBlock, err := db.FetchDBlockByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	if dBlock == nil {
+		return nil, fmt.Errorf("no directory block at height %v", height)
+	}
+
+	h := &ArchiveHeight{DBlock: dBlock}
+	for _, dbEntry := range dBlock.DBEntries {
+		chainID := dbEntry.ChainID.Bytes()
+		switch {
+		case bytes.Equal(chainID, common.ADMIN_CHAINID):
+			h.ABlock, err = db.FetchABlockByHash(dbEntry.KeyMR)
+			if err == nil && h.ABlock == nil {
+				err = fmt.Errorf("admin block %v is missing", dbEntry.KeyMR)
+			}
+		case bytes.Equal(chainID, common.EC_CHAINID):
+			h.ECBlock, err = db.FetchECBlockByHash(dbEntry.KeyMR)
+			if err == nil && h.ECBlock == nil {
+				err = fmt.Errorf("entry credit block %v is missing", dbEntry.KeyMR)
+			}
+		case bytes.Equal(chainID, common.FACTOID_CHAINID):
+			h.FBlock, err = db.FetchFBlockByHash(dbEntry.KeyMR)
+			if err == nil && h.FBlock == nil {
+				err = fmt.Errorf("factoid block %v is missing", dbEntry.KeyMR)
+			}
+		default:
+			err = h.fetchEBlock(db, dbEntry.KeyMR)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("height %v: %v", height, err)
+		}
+	}
+	return h, nil
+}
+
+// fetchEBlock adds the entry block with keyMR and its entries to h.
+func (h *ArchiveHeight) fetchEBlock(db Db, keyMR *common.Hash) error {
+	eBlock, err := db.FetchEBlockByMR(keyMR)
+	if err != nil {
+		return err
+	}
+	if eBlock == nil {
+		return fmt.Errorf("entry block %v is missing", keyMR)
+	}
+	h.EBlocks = append(h.EBlocks, eBlock)
+
+	for _, ebEntry := range eBlock.Body.EBEntries {
+		if ebEntry.IsMinuteMarker() {
+			continue
+		}
+		entry, err := db.FetchEntryByHash(ebEntry)
+		if err != nil {
+			return err
+		}
+		if entry == nil {
+			return fmt.Errorf("entry %v of entry block %v is missing", ebEntry, keyMR)
+		}
+		h.Entries = append(h.Entries, entry)
+	}
+	return nil
+}
+
+// StoreArchiveHeight writes the blocks and entries of h in one batch, the
+// way the processor stores a new height.
+func StoreArchiveHeight(db Db, h *ArchiveHeight) error {
+	db.StartBatch()
+
+	var err error
+	for _, entry := range h.Entries {
+		if err == nil {
+			err = db.InsertEntryMultiBatch(entry)
+		}
+	}
+	if err == nil && h.ECBlock != nil {
+		err = db.ProcessECBlockMultiBatch(h.ECBlock)
+	}
+	if err == nil && h.ABlock != nil {
+		err = db.ProcessABlockMultiBatch(h.ABlock)
+	}
+	if err == nil && h.FBlock != nil {
+		err = db.ProcessFBlockMultiBatch(h.FBlock)
+	}
+	for _, eBlock := range h.EBlocks {
+		if err == nil {
+			err = db.ProcessEBlockMultiBatch(eBlock)
+		}
+	}
+	if err == nil {
+		err = db.ProcessDBlockMultiBatch(h.DBlock)
+	}
+	if err == nil {
+		err = db.InsertDirBlockInfoMultiBatch(common.NewDirBlockInfoFromDBlock(h.DBlock))
+	}
+	if err != nil {
+		db.CancelBatch()
+		return err
+	}
+
+	return db.EndBatch()
+}
+
+// ArchiveWriter writes heights to an archive.
+type ArchiveWriter struct {
+	w io.Writer
+}
+
+// NewArchiveWriter starts an archive on w.
+func NewArchiveWriter(w io.Writer) (*ArchiveWriter, error) {
+	_, err := w.Write(archiveMagic)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveWriter{w: w}, nil
+}
+
+// WriteHeight appends h to the archive.
+func (a *ArchiveWriter) WriteHeight(h *ArchiveHeight) error {
+	var payload bytes.Buffer
+
+	err := writeArchiveRecord(&payload, archiveDBlock, h.DBlock)
+	if err == nil && h.ABlock != nil {
+		err = writeArchiveRecord(&payload, archiveABlock, h.ABlock)
+	}
+	if err == nil && h.ECBlock != nil {
+		err = writeArchiveRecord(&payload, archiveECBlock, h.ECBlock)
+	}
+	if err == nil && h.FBlock != nil {
+		err = writeArchiveRecord(&payload, archiveFBlock, h.FBlock)
+	}
+	for _, eBlock := range h.EBlocks {
+		if err == nil {
+			err = writeArchiveRecord(&payload, archiveEBlock, eBlock)
+		}
+	}
+	for _, entry := range h.Entries {
+		if err == nil {
+			err = writeArchiveRecord(&payload, archiveEntry, entry)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	if payload.Len() > maxArchivePayload {
+		return fmt.Errorf("height %v is too large to archive (%v bytes)", h.DBlock.Header.DBHeight, payload.Len())
+	}
+
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint32(header[:4], h.DBlock.Header.DBHeight)
+	binary.BigEndian.PutUint32(header[4:], uint32(payload.Len()))
+	checksum := sha256.Sum256(payload.Bytes())
+
+	for _, data := range [][]byte{header, payload.Bytes(), checksum[:]} {
+		_, err = a.w.Write(data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeArchiveRecord(buf *bytes.Buffer, recordType byte, m interface {
+	MarshalBinary() ([]byte, error)
+}) error {
+	data, err := m.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	buf.WriteByte(recordType)
+	binary.Write(buf, binary.BigEndian, uint32(len(data)))
+	buf.Write(data)
+	return nil
+}
+
+// ArchiveReader reads the heights of an archive.
+type ArchiveReader struct {
+	r io.Reader
+}
+
+// NewArchiveReader checks that r starts an archive.
+func NewArchiveReader(r io.Reader) (*ArchiveReader, error) {
+	magic := make([]byte, len(archiveMagic))
+	_, err := io.ReadFull(r, magic)
+	if err != nil || !bytes.Equal(magic, archiveMagic) {
+		return nil, fmt.Errorf("not a factom archive")
+	}
+	return &ArchiveReader{r: r}, nil
+}
+
+// ReadHeight reads the next height of the archive. It returns io.EOF after
+// the last height, and an error for a truncated or corrupted height.
+func (a *ArchiveReader) ReadHeight() (*ArchiveHeight, error) {
+	header := make([]byte, 8)
+	_, err := io.ReadFull(a.r, header)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("truncated archive: %v", err)
+	}
+	height := binary.BigEndian.Uint32(header[:4])
+	size := binary.BigEndian.Uint32(header[4:])
+	if size > maxArchivePayload {
+		return nil, fmt.Errorf("height %v: payload of %v bytes is too large", height, size)
+	}
+
+	payload := make([]byte, int(size)+sha256.Size)
+	_, err = io.ReadFull(a.r, payload)
+	if err != nil {
+		return nil, fmt.Errorf("height %v: truncated archive: %v", height, err)
+	}
+	checksum := sha256.Sum256(payload[:size])
+	if !bytes.Equal(checksum[:], payload[size:]) {
+		return nil, fmt.Errorf("height %v: checksum mismatch", height)
+	}
+
+	h, err := parseArchivePayload(payload[:size])
+	if err != nil {
+		return nil, fmt.Errorf("height %v: %v", height, err)
+	}
+	if h.DBlock.Header.DBHeight != height {
+		return nil, fmt.Errorf("height %v holds the directory block of height %v", height, h.DBlock.Header.DBHeight)
+	}
+	return h, nil
+}
+
+// parseArchivePayload unmarshals the blocks and entries of a height.
+func parseArchivePayload(payload []byte) (*ArchiveHeight, error) {
+	h := new(ArchiveHeight)
+	for len(payload) > 0 {
+		if len(payload) < 5 {
+			return nil, fmt.Errorf("truncated record")
+		}
+		recordType := payload[0]
+		size := binary.BigEndian.Uint32(payload[1:5])
+		if uint64(size) > uint64(len(payload)-5) {
+			return nil, fmt.Errorf("truncated record")
+		}
+		data := payload[5 : 5+size]
+		payload = payload[5+size:]
+
+		if h.DBlock == nil && recordType != archiveDBlock {
+			return nil, fmt.Errorf("record of type %v before the directory block", recordType)
+		}
+
+		var err error
+		switch recordType {
+		case archiveDBlock:
+			if h.DBlock != nil {
+				return nil, fmt.Errorf("more than one directory block")
+			}
+			h.DBlock = common.NewDBlock()
+			_, err = h.DBlock.UnmarshalBinaryData(data)
+			if err == nil {
+				// The hash and key merkle root are not part of the binary block
+				h.DBlock.DBHash = common.Sha(data)
+				err = h.DBlock.BuildKeyMerkleRoot()
+			}
+		case archiveABlock:
+			h.ABlock = new(common.AdminBlock)
+			_, err = h.ABlock.UnmarshalBinaryData(data)
+		case archiveECBlock:
+			h.ECBlock = common.NewECBlock()
+			_, err = h.ECBlock.UnmarshalBinaryData(data)
+		case archiveFBlock:
+			h.FBlock = new(block.FBlock)
+			_, err = h.FBlock.UnmarshalBinaryData(data)
+		case archiveEBlock:
+			eBlock := common.NewEBlock()
+			_, err = eBlock.UnmarshalBinaryData(data)
+			h.EBlocks = append(h.EBlocks, eBlock)
+		case archiveEntry:
+			entry := new(common.Entry)
+			_, err = entry.UnmarshalBinaryData(data)
+			h.Entries = append(h.Entries, entry)
+		default:
+			err = fmt.Errorf("unknown record type %v", recordType)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if h.DBlock == nil {
+		return nil, fmt.Errorf("no directory block")
+	}
+	return h, nil
+}
+
+// ExportArchive writes the heights from through to of db to w as an
+// archive.
+func ExportArchive(db Db, from, to uint32, w io.Writer) error {
+	if from > to {
+		return fmt.Errorf("cannot export from height %v to height %v", from, to)
+	}
+
+	aw, err := NewArchiveWriter(w)
+	if err != nil {
+		return err
+	}
+	for height := uint64(from); height <= uint64(to); height++ {
+		h, err := FetchArchiveHeight(db, uint32(height))
+		if err != nil {
+			return err
+		}
+		err = aw.WriteHeight(h)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package boltdb implements database.Db on a single BoltDB file. Each of the
+// kvdb "tables" (TBL_DB, TBL_EB_MR, TBL_CHAIN_HEAD, TBL_ENTRY, ...) is a
+// bucket named by its one byte prefix, holding the rest of the key, so it
+// stores the same logical data as the LevelDB backend.
+package boltdb
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kvdb"
+	"github.com/boltdb/bolt"
+)
+
+// boltStore is a kvdb.Store backed by a BoltDB file.
+type boltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltDB opens the BoltDB file at dbpath and migrates it to the current
+// schema version. If create is false the file must already exist.
+func OpenBoltDB(dbpath string, create bool) (database.Db, error) {
+	s, err := openStore(dbpath, create)
+	if err != nil {
+		return nil, err
+	}
+	kdb, err := kvdb.Open(s)
+	if err != nil {
+		return nil, err
+	}
+	return kdb, nil
+}
+
+// Open opens the existing BoltDB file at dbpath without migrating it, for
+// the tools that inspect a database as it is.
+func Open(dbpath string) (*kvdb.KVDb, error) {
+	s, err := openStore(dbpath, false)
+	if err != nil {
+		return nil, err
+	}
+	return kvdb.New(s), nil
+}
+
+func openStore(dbpath string, create bool) (*boltStore, error) {
+	if create == true {
+		err := os.MkdirAll(filepath.Dir(dbpath), 0750)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		_, err := os.Stat(dbpath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := bolt.Open(dbpath, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+// splitKey returns the bucket name and the key within the bucket.
+func splitKey(key []byte) ([]byte, []byte) {
+	return key[:1], key[1:]
+}
+
+func (s *boltStore) Get(key []byte) ([]byte, error) {
+	var value []byte
+	err := s.db.View(func(tx *bolt.Tx) error {
+		table, k := splitKey(key)
+		b := tx.Bucket(table)
+		if b == nil {
+			return kvdb.ErrNotFound
+		}
+		data := b.Get(k)
+		if data == nil {
+			return kvdb.ErrNotFound
+		}
+		// data is only valid for the life of the transaction
+		value = make([]byte, len(data))
+		copy(value, data)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (s *boltStore) Iterate(fromkey, tokey []byte, fn func(key, value []byte) error) error {
+	if len(fromkey) == 0 {
+		fromkey = []byte{0}
+	}
+	lastTable := 255
+	if len(tokey) > 0 {
+		lastTable = int(tokey[0])
+	}
+
+	return s.db.View(func(tx *bolt.Tx) error {
+		for t := int(fromkey[0]); t <= lastTable; t++ {
+			b := tx.Bucket([]byte{byte(t)})
+			if b == nil {
+				continue
+			}
+
+			c := b.Cursor()
+			var k, v []byte
+			if t == int(fromkey[0]) {
+				k, v = c.Seek(fromkey[1:])
+			} else {
+				k, v = c.First()
+			}
+			for ; k != nil; k, v = c.Next() {
+				key := append([]byte{byte(t)}, k...)
+				if len(tokey) > 0 && bytes.Compare(key, tokey) >= 0 {
+					return nil
+				}
+				value := make([]byte, len(v))
+				copy(value, v)
+				if err := fn(key, value); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Write(batch *kvdb.Batch) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, op := range batch.Ops {
+			table, k := splitKey(op.Key)
+			b, err := tx.CreateBucketIfNotExists(table)
+			if err != nil {
+				return err
+			}
+			if op.Delete {
+				err = b.Delete(k)
+			} else {
+				err = b.Put(k, op.Value)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *boltStore) Sync() error {
+	return s.db.Sync()
+}
+
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// RollbackClose closes the file. Every Write is already its own committed
+// BoltDB transaction, so as with LevelDB there is nothing to discard.
+func (s *boltStore) RollbackClose() error {
+	return s.db.Close()
+}
@@ -0,0 +1,31 @@
+package boltdb_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/boltdb"
+	"github.com/FactomProject/FactomCode/database/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "boltdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := 0
+	conformance.RunTests(t, func() database.Db {
+		n++
+		db, err := boltdb.OpenBoltDB(filepath.Join(dir, strconv.Itoa(n)+".db"), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
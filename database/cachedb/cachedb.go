@@ -0,0 +1,345 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package cachedb wraps a database.Db with LRU caches of recently fetched
+// directory blocks, entry blocks, entries and chain heads. Every other call
+// goes straight through to the wrapped database.
+//
+// Every caller gets its own copy of a cached block, down to the header and
+// the entry list, so it is free to build the merkle roots. The cached
+// entries are shared by all callers and must be treated as read only.
+package cachedb
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/factoid/block"
+)
+
+// Sizes are the number of objects each cache holds; 0 disables a cache.
+type Sizes struct {
+	DBlocks    int
+	EBlocks    int
+	Entries    int
+	ChainHeads int
+}
+
+// CacheDb is a database.Db that caches reads of the wrapped database.
+type CacheDb struct {
+	database.Db
+
+	dBlocks *lru // by "h"+hash and "m"+KeyMR
+	eBlocks *lru // by "h"+hash and "m"+KeyMR
+	entries *lru // by hash
+	heads   *lru // by chain ID
+
+	// chain heads written by the MultiBatch calls of the open batch
+	pendingLock  sync.Mutex
+	pendingHeads [][]byte
+}
+
+var _ database.Db = (*CacheDb)(nil)
+
+// New returns db wrapped in caches of the given sizes.
+func New(db database.Db, sizes Sizes) *CacheDb {
+	return &CacheDb{
+		Db:      db,
+		dBlocks: newLRU(sizes.DBlocks),
+		eBlocks: newLRU(sizes.EBlocks),
+		entries: newLRU(sizes.Entries),
+		heads:   newLRU(sizes.ChainHeads),
+	}
+}
+
+// Stats returns the counters of every cache by name.
+func (db *CacheDb) Stats() map[string]Stats {
+	return map[string]Stats{
+		"dblocks":    db.dBlocks.stats(),
+		"eblocks":    db.eBlocks.stats(),
+		"entries":    db.entries.stats(),
+		"chainheads": db.heads.stats(),
+	}
+}
+
+// Purge empties all of the caches.
+func (db *CacheDb) Purge() {
+	db.dBlocks.purge()
+	db.eBlocks.purge()
+	db.entries.purge()
+	db.heads.purge()
+}
+
+// FetchDBlockByHash gets a directory block by hash.
+func (db *CacheDb) FetchDBlockByHash(dBlockHash *common.Hash) (*common.DirectoryBlock, error) {
+	v, err := db.dBlocks.get("h"+string(dBlockHash.Bytes()), func() (interface{}, error) {
+		dBlock, err := db.Db.FetchDBlockByHash(dBlockHash)
+		if dBlock == nil {
+			return nil, err
+		}
+		return dBlock, err
+	})
+	if v == nil {
+		return nil, err
+	}
+	return copyDBlock(v.(*common.DirectoryBlock)), err
+}
+
+// FetchDBlockByMR gets a directory block by merkle root.
+func (db *CacheDb) FetchDBlockByMR(dBMR *common.Hash) (*common.DirectoryBlock, error) {
+	v, err := db.dBlocks.get("m"+string(dBMR.Bytes()), func() (interface{}, error) {
+		dBlock, err := db.Db.FetchDBlockByMR(dBMR)
+		if dBlock == nil {
+			return nil, err
+		}
+		return dBlock, err
+	})
+	if v == nil {
+		return nil, err
+	}
+	return copyDBlock(v.(*common.DirectoryBlock)), err
+}
+
+// FetchDBlockByHeight gets a directory block by height. Only the height
+// lookup goes to the database.
+func (db *CacheDb) FetchDBlockByHeight(dBlockHeight uint32) (*common.DirectoryBlock, error) {
+	dBlockHash, err := db.Db.FetchDBHashByHeight(dBlockHeight)
+	if err != nil || dBlockHash == nil {
+		return nil, err
+	}
+	return db.FetchDBlockByHash(dBlockHash)
+}
+
+// FetchDBlockByTime gets the directory block covering timestamp, in minutes
+// since the epoch, reading the blocks through the cache.
+func (db *CacheDb) FetchDBlockByTime(timestamp uint32) (*common.DirectoryBlock, error) {
+	return database.SearchDBlockByTime(db, timestamp)
+}
+
+// FetchEBlockByHash gets an entry block by hash.
+func (db *CacheDb) FetchEBlockByHash(eBlockHash *common.Hash) (*common.EBlock, error) {
+	v, err := db.eBlocks.get("h"+string(eBlockHash.Bytes()), func() (interface{}, error) {
+		eBlock, err := db.Db.FetchEBlockByHash(eBlockHash)
+		if eBlock == nil {
+			return nil, err
+		}
+		return eBlock, err
+	})
+	if v == nil {
+		return nil, err
+	}
+	return copyEBlock(v.(*common.EBlock)), err
+}
+
+// FetchEBlockByMR gets an entry block by merkle root.
+func (db *CacheDb) FetchEBlockByMR(eBMR *common.Hash) (*common.EBlock, error) {
+	v, err := db.eBlocks.get("m"+string(eBMR.Bytes()), func() (interface{}, error) {
+		eBlock, err := db.Db.FetchEBlockByMR(eBMR)
+		if eBlock == nil {
+			return nil, err
+		}
+		return eBlock, err
+	})
+	if v == nil {
+		return nil, err
+	}
+	return copyEBlock(v.(*common.EBlock)), err
+}
+
+// FetchEBlockByHeight gets the entry block of a chain by its sequence
+// number.
+func (db *CacheDb) FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint32) (*common.EBlock, error) {
+	v, err := db.eBlocks.get("s"+string(chainID.Bytes())+fmt.Sprint(eBlockHeight), func() (interface{}, error) {
+		eBlock, err := db.Db.FetchEBlockByHeight(chainID, eBlockHeight)
+		if eBlock == nil {
+			return nil, err
+		}
+		return eBlock, err
+	})
+	if v == nil {
+		return nil, err
+	}
+	return copyEBlock(v.(*common.EBlock)), err
+}
+
+// copyDBlock returns a copy of a cached directory block, with its own
+// header and entry list.
+func copyDBlock(b *common.DirectoryBlock) *common.DirectoryBlock {
+	c := *b
+	if b.Header != nil {
+		header := *b.Header
+		c.Header = &header
+	}
+	c.DBEntries = append([]*common.DBEntry(nil), b.DBEntries...)
+	return &c
+}
+
+// copyEBlock returns a copy of a cached entry block, with its own header
+// and entry list.
+func copyEBlock(b *common.EBlock) *common.EBlock {
+	c := *b
+	if b.Header != nil {
+		header := *b.Header
+		c.Header = &header
+	}
+	if b.Body != nil {
+		c.Body = &common.EBlockBody{EBEntries: append([]*common.Hash(nil), b.Body.EBEntries...)}
+	}
+	return &c
+}
+
+// FetchEntryByHash gets an entry by hash.
+func (db *CacheDb) FetchEntryByHash(entrySha *common.Hash) (*common.Entry, error) {
+	v, err := db.entries.get(string(entrySha.Bytes()), func() (interface{}, error) {
+		entry, err := db.Db.FetchEntryByHash(entrySha)
+		if entry == nil {
+			return nil, err
+		}
+		return entry, err
+	})
+	if v == nil {
+		return nil, err
+	}
+	return v.(*common.Entry), err
+}
+
+// FetchHeadMRByChainID gets the MR of the highest block of a chain.
+func (db *CacheDb) FetchHeadMRByChainID(chainID *common.Hash) (*common.Hash, error) {
+	if chainID == nil {
+		return nil, nil
+	}
+	v, err := db.heads.get(string(chainID.Bytes()), func() (interface{}, error) {
+		blkMR, err := db.Db.FetchHeadMRByChainID(chainID)
+		if blkMR == nil {
+			return nil, err
+		}
+		return blkMR, err
+	})
+	if v == nil {
+		return nil, err
+	}
+	return v.(*common.Hash), err
+}
+
+// invalidateHead drops the cached head of a chain written by a Batch call.
+func (db *CacheDb) invalidateHead(chainID []byte) {
+	db.heads.remove(string(chainID))
+}
+
+// invalidateHeadLater drops the cached head of a chain written by a
+// MultiBatch call now, and again once the batch is written by EndBatch.
+func (db *CacheDb) invalidateHeadLater(chainID []byte) {
+	db.heads.remove(string(chainID))
+
+	db.pendingLock.Lock()
+	db.pendingHeads = append(db.pendingHeads, chainID)
+	db.pendingLock.Unlock()
+}
+
+// EndBatch writes the open batch and drops the chain heads it changed.
+func (db *CacheDb) EndBatch() error {
+	err := db.Db.EndBatch()
+
+	db.pendingLock.Lock()
+	for _, chainID := range db.pendingHeads {
+		db.heads.remove(string(chainID))
+	}
+	db.pendingHeads = nil
+	db.pendingLock.Unlock()
+
+	return err
+}
+
+// CancelBatch discards the open batch. The chain heads it would have changed
+// were dropped already.
+func (db *CacheDb) CancelBatch() {
+	db.Db.CancelBatch()
+
+	db.pendingLock.Lock()
+	db.pendingHeads = nil
+	db.pendingLock.Unlock()
+}
+
+// ProcessDBlockBatch inserts the DBlock and drops the cached directory chain head.
+func (db *CacheDb) ProcessDBlockBatch(dblock *common.DirectoryBlock) error {
+	defer db.invalidateHead(common.D_CHAINID)
+	return db.Db.ProcessDBlockBatch(dblock)
+}
+
+func (db *CacheDb) ProcessDBlockMultiBatch(dblock *common.DirectoryBlock) error {
+	db.invalidateHeadLater(common.D_CHAINID)
+	return db.Db.ProcessDBlockMultiBatch(dblock)
+}
+
+// ProcessEBlockBatch inserts the EBlock and drops the cached head of its chain.
+func (db *CacheDb) ProcessEBlockBatch(eblock *common.EBlock) error {
+	if eblock != nil && eblock.Header.ChainID != nil {
+		defer db.invalidateHead(eblock.Header.ChainID.Bytes())
+	}
+	return db.Db.ProcessEBlockBatch(eblock)
+}
+
+func (db *CacheDb) ProcessEBlockMultiBatch(eblock *common.EBlock) error {
+	if eblock != nil && eblock.Header.ChainID != nil {
+		db.invalidateHeadLater(eblock.Header.ChainID.Bytes())
+	}
+	return db.Db.ProcessEBlockMultiBatch(eblock)
+}
+
+// ProcessABlockBatch inserts the AdminBlock and drops the cached admin chain head.
+func (db *CacheDb) ProcessABlockBatch(block *common.AdminBlock) error {
+	defer db.invalidateHead(common.ADMIN_CHAINID)
+	return db.Db.ProcessABlockBatch(block)
+}
+
+func (db *CacheDb) ProcessABlockMultiBatch(block *common.AdminBlock) error {
+	db.invalidateHeadLater(common.ADMIN_CHAINID)
+	return db.Db.ProcessABlockMultiBatch(block)
+}
+
+// ProcessECBlockBatch inserts the ECBlock and drops the cached entry credit
+// chain head.
+func (db *CacheDb) ProcessECBlockBatch(block *common.ECBlock) error {
+	defer db.invalidateHead(common.EC_CHAINID)
+	return db.Db.ProcessECBlockBatch(block)
+}
+
+func (db *CacheDb) ProcessECBlockMultiBatch(block *common.ECBlock) error {
+	db.invalidateHeadLater(common.EC_CHAINID)
+	return db.Db.ProcessECBlockMultiBatch(block)
+}
+
+// ProcessFBlockBatch inserts the factoid block and drops the cached factoid
+// chain head.
+func (db *CacheDb) ProcessFBlockBatch(fBlock block.IFBlock) error {
+	defer db.invalidateHead(common.FACTOID_CHAINID)
+	return db.Db.ProcessFBlockBatch(fBlock)
+}
+
+func (db *CacheDb) ProcessFBlockMultiBatch(fBlock block.IFBlock) error {
+	db.invalidateHeadLater(common.FACTOID_CHAINID)
+	return db.Db.ProcessFBlockMultiBatch(fBlock)
+}
+
+// RollbackToHeight deletes the blocks above height and empties the caches.
+func (db *CacheDb) RollbackToHeight(height uint32) error {
+	defer db.Purge()
+	return db.Db.RollbackToHeight(height)
+}
+
+// RollbackClose discards the changes since the last Sync and empties the
+// caches.
+func (db *CacheDb) RollbackClose() error {
+	defer db.Purge()
+	return db.Db.RollbackClose()
+}
+
+// PruneBelowHeight prunes the entries and entry blocks below height and
+// empties the caches.
+func (db *CacheDb) PruneBelowHeight(height uint32) (int, error) {
+	defer db.Purge()
+	return db.Db.PruneBelowHeight(height)
+}
@@ -0,0 +1,149 @@
+package cachedb_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/cachedb"
+	"github.com/FactomProject/FactomCode/database/conformance"
+	"github.com/FactomProject/FactomCode/database/memdb"
+)
+
+var sizes = cachedb.Sizes{DBlocks: 2, EBlocks: 2, Entries: 2, ChainHeads: 2}
+
+func TestConformance(t *testing.T) {
+	conformance.RunTests(t, func() database.Db {
+		return cachedb.New(memdb.NewMemDb(), sizes)
+	})
+}
+
+func TestHitsAndMisses(t *testing.T) {
+	db := cachedb.New(memdb.NewMemDb(), sizes)
+
+	entries := make([]*common.Entry, 3)
+	for i, content := range []string{"a", "b", "c"} {
+		entries[i] = conformance.NewTestEntry(content)
+		db.InsertEntry(entries[i])
+	}
+
+	db.FetchEntryByHash(entries[0].Hash())
+	db.FetchEntryByHash(entries[0].Hash())
+	if s := db.Stats()["entries"]; s.Hits != 1 || s.Misses != 1 {
+		t.Errorf("stats after a miss and a hit: %+v", s)
+	}
+
+	// a miss is not cached
+	db.FetchEntryByHash(common.Sha([]byte("missing")))
+	db.FetchEntryByHash(common.Sha([]byte("missing")))
+	if s := db.Stats()["entries"]; s.Misses != 3 || s.Len != 1 {
+		t.Errorf("stats after two misses of a missing entry: %+v", s)
+	}
+
+	// the least recently used entry is evicted
+	db.FetchEntryByHash(entries[1].Hash())
+	db.FetchEntryByHash(entries[2].Hash())
+	db.FetchEntryByHash(entries[0].Hash())
+	if s := db.Stats()["entries"]; s.Len != 2 || s.Hits != 1 {
+		t.Errorf("stats after eviction: %+v", s)
+	}
+}
+
+func TestChainHeadInvalidation(t *testing.T) {
+	db := cachedb.New(memdb.NewMemDb(), sizes)
+
+	var prev *common.EBlock
+	for seq, content := range []string{"first", "second"} {
+		entry := conformance.NewTestEntry(content)
+		eblock := common.NewEBlock()
+		eblock.Header.ChainID = entry.ChainID
+		eblock.Header.EBSequence = uint32(seq)
+		if prev != nil {
+			eblock.Header.PrevKeyMR, _ = prev.KeyMR()
+		}
+		eblock.AddEBEntry(entry)
+
+		if seq == 0 {
+			if err := db.ProcessEBlockBatch(eblock); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			db.StartBatch()
+			if err := db.ProcessEBlockMultiBatch(eblock); err != nil {
+				t.Fatal(err)
+			}
+			if err := db.EndBatch(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		keyMR, _ := eblock.KeyMR()
+		head, err := db.FetchHeadMRByChainID(entry.ChainID)
+		if err != nil || !head.IsSameAs(keyMR) {
+			t.Errorf("stale chain head after block %v: %v %v", seq, head, err)
+		}
+		// cached now
+		db.FetchHeadMRByChainID(entry.ChainID)
+		prev = eblock
+	}
+	if s := db.Stats()["chainheads"]; s.Hits != 2 || s.Misses != 2 {
+		t.Errorf("chain head stats: %+v", s)
+	}
+}
+
+// TestCopies builds the merkle roots of the same cached blocks from two
+// goroutines; run it with -race.
+func TestCopies(t *testing.T) {
+	db := cachedb.New(memdb.NewMemDb(), sizes)
+
+	entry := conformance.NewTestEntry("copies")
+	eblock := common.NewEBlock()
+	eblock.Header.ChainID = entry.ChainID
+	eblock.AddEBEntry(entry)
+	if err := db.ProcessEBlockBatch(eblock); err != nil {
+		t.Fatal(err)
+	}
+	eKeyMR, _ := eblock.KeyMR()
+
+	dblock := common.NewDBlock()
+	dblock.DBHash = nil
+	dblock.KeyMR = nil
+	dbEntry, _ := common.NewDBEntry(eblock)
+	dblock.DBEntries = append(dblock.DBEntries, dbEntry)
+	dblock.Header.BlockCount = 1
+	if err := db.ProcessDBlockBatch(dblock); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d, err := db.FetchDBlockByHeight(0)
+			if err != nil || d == nil {
+				t.Errorf("FetchDBlockByHeight(0) = %v, %v", d, err)
+				return
+			}
+			d.BuildKeyMerkleRoot()
+			d.IsValidated = true
+
+			e, err := db.FetchEBlockByMR(eKeyMR)
+			if err != nil || e == nil {
+				t.Errorf("FetchEBlockByMR(%v) = %v, %v", eKeyMR, e, err)
+				return
+			}
+			if keyMR, err := e.KeyMR(); err != nil || !keyMR.IsSameAs(eKeyMR) {
+				t.Errorf("KeyMR of a cached EBlock = %v, %v", keyMR, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	d1, _ := db.FetchDBlockByHeight(0)
+	d2, _ := db.FetchDBlockByHeight(0)
+	if d1 == d2 || d1.Header == d2.Header {
+		t.Error("the cache returned the same directory block twice")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package cachedb
+
+import (
+	"container/list"
+	"sync"
+)
+
+// Stats are the counters of one cache.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Len    int    `json:"len"`
+	Size   int    `json:"size"`
+}
+
+type lruItem struct {
+	key   string
+	value interface{}
+}
+
+// lru is a fixed size least recently used cache. A size of 0 disables it.
+type lru struct {
+	lock  sync.Mutex
+	size  int
+	items map[string]*list.Element
+	order *list.List // front is the most recently used
+
+	// gen changes on every invalidation, so that a value loaded from the
+	// database before it is not cached after it
+	gen uint64
+
+	hits, misses uint64
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		items: make(map[string]*list.Element),
+		order: list.New(),
+	}
+}
+
+// get returns the cached value of key, or calls load and caches its result
+// if it is not nil.
+func (c *lru) get(key string, load func() (interface{}, error)) (interface{}, error) {
+	if c.size <= 0 {
+		return load()
+	}
+
+	c.lock.Lock()
+	if e, ok := c.items[key]; ok {
+		c.order.MoveToFront(e)
+		c.hits++
+		c.lock.Unlock()
+		return e.Value.(*lruItem).value, nil
+	}
+	c.misses++
+	gen := c.gen
+	c.lock.Unlock()
+
+	value, err := load()
+	if err != nil || value == nil {
+		return value, err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if gen == c.gen {
+		c.add(key, value)
+	}
+	return value, nil
+}
+
+// add caches value under key; the caller holds the lock.
+func (c *lru) add(key string, value interface{}) {
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruItem).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruItem{key, value})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*lruItem).key)
+	}
+}
+
+// remove drops key from the cache.
+func (c *lru) remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.gen++
+	if e, ok := c.items[key]; ok {
+		c.order.Remove(e)
+		delete(c.items, key)
+	}
+}
+
+// purge drops everything from the cache.
+func (c *lru) purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.gen++
+	c.items = make(map[string]*list.Element)
+	c.order.Init()
+}
+
+func (c *lru) stats() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return Stats{Hits: c.hits, Misses: c.misses, Len: c.order.Len(), Size: c.size}
+}
@@ -0,0 +1,174 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// ChainStats sums up an entry chain. It is kept up to date as its entry
+// blocks are processed and rolled back.
+type ChainStats struct {
+	ChainID *common.Hash
+
+	// FirstEntry is the hash of the first entry of the chain, nil if the
+	// first entry block was pruned before the statistics were built
+	FirstEntry *common.Hash
+
+	// FirstEntryExtIDs are the external IDs of the first entry, which
+	// usually name the chain. They are nil if the entry was not in the
+	// database.
+	FirstEntryExtIDs [][]byte
+
+	EBlockCount uint32
+	EntryCount  uint32 // not counting the minute markers
+
+	// TotalBytes is the marshalled size of the entries that were in the
+	// database when their entry blocks were processed
+	TotalBytes uint64
+
+	// FirstHeight and LastHeight are the directory block heights of the
+	// first and the last entry block of the chain
+	FirstHeight uint32
+	LastHeight  uint32
+}
+
+// chainStatsSize is ChainID (32 bytes) + FirstEntry (32 bytes) + EBlockCount
+// (4 bytes) + EntryCount (4 bytes) + TotalBytes (8 bytes) + FirstHeight (4
+// bytes) + LastHeight (4 bytes) + the number of external IDs (2 bytes). Each
+// external ID follows with its 2 byte length.
+const chainStatsSize = 90
+
+func (s *ChainStats) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, chainStatsSize)
+	data = append(data, s.ChainID.Bytes()...)
+	if s.FirstEntry != nil {
+		data = append(data, s.FirstEntry.Bytes()...)
+	} else {
+		data = append(data, make([]byte, common.HASH_LENGTH)...)
+	}
+
+	num := make([]byte, 24)
+	binary.BigEndian.PutUint32(num[0:4], s.EBlockCount)
+	binary.BigEndian.PutUint32(num[4:8], s.EntryCount)
+	binary.BigEndian.PutUint64(num[8:16], s.TotalBytes)
+	binary.BigEndian.PutUint32(num[16:20], s.FirstHeight)
+	binary.BigEndian.PutUint32(num[20:24], s.LastHeight)
+	data = append(data, num...)
+
+	if len(s.FirstEntryExtIDs) > 0xFFFF {
+		return nil, fmt.Errorf("ChainStats: %v external IDs", len(s.FirstEntryExtIDs))
+	}
+	size := make([]byte, 2)
+	binary.BigEndian.PutUint16(size, uint16(len(s.FirstEntryExtIDs)))
+	data = append(data, size...)
+	for _, extID := range s.FirstEntryExtIDs {
+		if len(extID) > 0xFFFF {
+			return nil, fmt.Errorf("ChainStats: external ID of %v bytes", len(extID))
+		}
+		binary.BigEndian.PutUint16(size, uint16(len(extID)))
+		data = append(data, size...)
+		data = append(data, extID...)
+	}
+	return data, nil
+}
+
+func (s *ChainStats) UnmarshalBinary(data []byte) error {
+	if len(data) < chainStatsSize {
+		return fmt.Errorf("ChainStats: %v bytes, expected at least %v", len(data), chainStatsSize)
+	}
+	s.ChainID = common.NewHash()
+	s.ChainID.SetBytes(data[:32])
+	s.FirstEntry = nil
+	if !bytes.Equal(data[32:64], make([]byte, common.HASH_LENGTH)) {
+		s.FirstEntry = common.NewHash()
+		s.FirstEntry.SetBytes(data[32:64])
+	}
+	s.EBlockCount = binary.BigEndian.Uint32(data[64:68])
+	s.EntryCount = binary.BigEndian.Uint32(data[68:72])
+	s.TotalBytes = binary.BigEndian.Uint64(data[72:80])
+	s.FirstHeight = binary.BigEndian.Uint32(data[80:84])
+	s.LastHeight = binary.BigEndian.Uint32(data[84:88])
+
+	n := int(binary.BigEndian.Uint16(data[88:90]))
+	data = data[chainStatsSize:]
+	s.FirstEntryExtIDs = nil
+	for i := 0; i < n; i++ {
+		if len(data) < 2 {
+			return fmt.Errorf("ChainStats: external ID %v is cut short", i)
+		}
+		size := int(binary.BigEndian.Uint16(data[:2]))
+		if len(data) < 2+size {
+			return fmt.Errorf("ChainStats: external ID %v is cut short", i)
+		}
+		s.FirstEntryExtIDs = append(s.FirstEntryExtIDs, append([]byte{}, data[2:2+size]...))
+		data = data[2+size:]
+	}
+	return nil
+}
+
+// Add adds the statistics c of the entry blocks following those of s in
+// the same chain. When s is empty it takes the first entry from c.
+func (s *ChainStats) Add(c *ChainStats) {
+	if s.EBlockCount == 0 {
+		s.FirstEntry = c.FirstEntry
+		s.FirstEntryExtIDs = c.FirstEntryExtIDs
+		s.FirstHeight = c.FirstHeight
+	}
+	s.EBlockCount += c.EBlockCount
+	s.EntryCount += c.EntryCount
+	s.TotalBytes += c.TotalBytes
+	s.LastHeight = c.LastHeight
+}
+
+// Sub takes the statistics c of the last entry blocks of the chain back
+// from s. LastHeight is left for the caller, who knows the new last block.
+func (s *ChainStats) Sub(c *ChainStats) {
+	s.EBlockCount -= c.EBlockCount
+	s.EntryCount -= c.EntryCount
+	s.TotalBytes -= c.TotalBytes
+}
+
+// EBlockChainStats returns the statistics of a chain holding eblock alone.
+// The entries are looked up with fetchEntry, which returns nil for an entry
+// it does not have. A pruned block, with its header only, counts no entries.
+func EBlockChainStats(eblock *common.EBlock, fetchEntry func(entryHash *common.Hash) (*common.Entry, error)) (*ChainStats, error) {
+	s := &ChainStats{
+		ChainID:     eblock.Header.ChainID,
+		EBlockCount: 1,
+		FirstHeight: eblock.Header.EBHeight,
+		LastHeight:  eblock.Header.EBHeight,
+	}
+	for _, ebEntry := range eblock.Body.EBEntries {
+		if ebEntry.IsMinuteMarker() {
+			continue
+		}
+		s.EntryCount++
+
+		entry, err := fetchEntry(ebEntry)
+		if err != nil {
+			return nil, err
+		}
+		if entry != nil {
+			data, err := entry.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			s.TotalBytes += uint64(len(data))
+		}
+
+		if eblock.Header.EBSequence == 0 && s.FirstEntry == nil {
+			s.FirstEntry = ebEntry
+			if entry != nil {
+				s.FirstEntryExtIDs = entry.ExtIDs
+			}
+		}
+	}
+	return s, nil
+}
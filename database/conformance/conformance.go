@@ -0,0 +1,1198 @@
+// Package conformance holds the tests every database.Db backend has to pass.
+// Each backend runs them from its own _test.go file with RunTests.
+package conformance
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// RunTests runs the conformance tests, each against a fresh database
+// returned by open.
+func RunTests(t *testing.T, open func() database.Db) {
+	tests := []func(*testing.T, database.Db){
+		testEntryAndEBlock,
+		testEBlockByHeight,
+		testDBlockHeights,
+		testDBlockByTime,
+		testBatch,
+		testEntriesByChain,
+		testEntryLocation,
+		testRollbackToHeight,
+		testIterate,
+		testECBalances,
+		testECBalanceAtHeight,
+		testExtIDIndex,
+		testPartialHeight,
+		testArchive,
+		testPrune,
+		testChainStats,
+		testReceipt,
+	}
+	for _, test := range tests {
+		db := open()
+		test(t, db)
+		db.Close()
+	}
+}
+
+// NewTestEntry returns an entry in a test chain.
+func NewTestEntry(content string) *common.Entry {
+	entry := common.NewEntry()
+	entry.ExtIDs = append(entry.ExtIDs, []byte("conformance"))
+	entry.ChainID = common.NewChainID(entry)
+	entry.Content = []byte(content)
+	return entry
+}
+
+func newTestDBlock(height uint32) *common.DirectoryBlock {
+	dblock := common.NewDBlock()
+	dblock.Header.DBHeight = height
+	dblock.Header.Timestamp = 1000 + height
+	dblock.DBHash = nil
+	dblock.KeyMR = nil
+	return dblock
+}
+
+func testEntryAndEBlock(t *testing.T, db database.Db) {
+	entry := NewTestEntry("hello")
+	if err := db.InsertEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	got, err := db.FetchEntryByHash(entry.Hash())
+	if err != nil || got == nil {
+		t.Fatalf("FetchEntryByHash: %v %v", got, err)
+	}
+	if string(got.Content) != "hello" {
+		t.Errorf("unexpected content %q", got.Content)
+	}
+
+	missing, err := db.FetchEntryByHash(common.Sha([]byte("missing")))
+	if missing != nil || err != nil {
+		t.Errorf("missing entry should return nil, nil; got %v, %v", missing, err)
+	}
+
+	eblock := common.NewEBlock()
+	eblock.Header.ChainID = entry.ChainID
+	eblock.AddEBEntry(entry)
+	if err := db.ProcessEBlockBatch(eblock); err != nil {
+		t.Fatal(err)
+	}
+
+	keyMR, _ := eblock.KeyMR()
+	head, err := db.FetchHeadMRByChainID(entry.ChainID)
+	if err != nil || !head.IsSameAs(keyMR) {
+		t.Errorf("chain head mismatch: %v %v", head, err)
+	}
+	eb, err := db.FetchEBlockByMR(keyMR)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(eb.Body.EBEntries) != 1 || !eb.Body.EBEntries[0].IsSameAs(entry.Hash()) {
+		t.Errorf("unexpected eblock body")
+	}
+	eblocks, err := db.FetchAllEBlocksByChain(entry.ChainID)
+	if err != nil || len(*eblocks) != 1 {
+		t.Errorf("FetchAllEBlocksByChain: %v %v", eblocks, err)
+	}
+
+	if err := db.ProcessEBlockBatch(common.NewEBlock()); err == nil {
+		t.Errorf("empty eblock should be rejected")
+	}
+}
+
+func testEBlockByHeight(t *testing.T, db database.Db) {
+	var keyMRs []*common.Hash
+	var chainID *common.Hash
+	for seq := uint32(0); seq < 3; seq++ {
+		entry := NewTestEntry(fmt.Sprint("sequence ", seq))
+		db.InsertEntry(entry)
+		chainID = entry.ChainID
+		eblock := common.NewEBlock()
+		eblock.Header.ChainID = entry.ChainID
+		eblock.Header.EBSequence = seq
+		eblock.AddEBEntry(entry)
+		if err := db.ProcessEBlockBatch(eblock); err != nil {
+			t.Fatal(err)
+		}
+		keyMR, _ := eblock.KeyMR()
+		keyMRs = append(keyMRs, keyMR)
+	}
+
+	for seq, keyMR := range keyMRs {
+		eblock, err := db.FetchEBlockByHeight(chainID, uint32(seq))
+		if err != nil || eblock == nil {
+			t.Errorf("FetchEBlockByHeight(%v) = %v, %v", seq, eblock, err)
+			continue
+		}
+		if got, _ := eblock.KeyMR(); !got.IsSameAs(keyMR) {
+			t.Errorf("FetchEBlockByHeight(%v) returned block %v, want %v", seq, got, keyMR)
+		}
+	}
+
+	if eblock, err := db.FetchEBlockByHeight(chainID, 3); err == nil {
+		t.Errorf("FetchEBlockByHeight past the chain head = %v", eblock)
+	}
+	if eblock, err := db.FetchEBlockByHeight(common.Sha([]byte("missing")), 0); err == nil {
+		t.Errorf("FetchEBlockByHeight of a missing chain = %v", eblock)
+	}
+}
+
+func testDBlockHeights(t *testing.T, db database.Db) {
+	if _, h, _ := db.FetchBlockHeightCache(); h != -1 {
+		t.Errorf("empty db height cache = %v", h)
+	}
+
+	for i := uint32(0); i < 3; i++ {
+		if err := db.ProcessDBlockBatch(newTestDBlock(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, h, _ := db.FetchBlockHeightCache(); h != 2 {
+		t.Errorf("height cache = %v, want 2", h)
+	}
+
+	shas, err := db.FetchHeightRange(0, database.AllShas)
+	if err != nil || len(shas) != 3 {
+		t.Errorf("FetchHeightRange(0, AllShas) returned %v shas, err %v", len(shas), err)
+	}
+	shas, _ = db.FetchHeightRange(1, 2)
+	if len(shas) != 1 {
+		t.Errorf("FetchHeightRange(1, 2) returned %v shas", len(shas))
+	}
+
+	dblock, err := db.FetchDBlockByHeight(1)
+	if err != nil || dblock.Header.DBHeight != 1 {
+		t.Errorf("FetchDBlockByHeight: %v", err)
+	}
+	height, _ := db.FetchBlockHeightBySha(&shas[0])
+	if height != 1 {
+		t.Errorf("FetchBlockHeightBySha = %v, want 1", height)
+	}
+
+	if _, err := db.FetchDBlockByHeight(5); err == nil {
+		t.Errorf("expected error for missing height")
+	}
+
+	dblocks, err := db.FetchAllDBlocks()
+	if err != nil || len(dblocks) != 3 {
+		t.Errorf("FetchAllDBlocks returned %v blocks, err %v", len(dblocks), err)
+	}
+}
+
+func testDBlockByTime(t *testing.T, db database.Db) {
+	if dblock, err := db.FetchDBlockByTime(1000); err != nil || dblock != nil {
+		t.Errorf("FetchDBlockByTime on an empty db = %v, %v", dblock, err)
+	}
+
+	// Ten minutes apart, from 1000 up to 1040
+	for i := uint32(0); i < 5; i++ {
+		dblock := newTestDBlock(i)
+		dblock.Header.Timestamp = 1000 + 10*i
+		if err := db.ProcessDBlockBatch(dblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		timestamp uint32
+		height    int64
+	}{
+		{999, -1},
+		{1000, 0},
+		{1009, 0},
+		{1010, 1},
+		{1025, 2},
+		{1039, 3},
+		{1040, 4},
+		{5000, 4},
+	}
+	for _, test := range tests {
+		dblock, err := db.FetchDBlockByTime(test.timestamp)
+		if err != nil {
+			t.Errorf("FetchDBlockByTime(%v): %v", test.timestamp, err)
+			continue
+		}
+		height := int64(-1)
+		if dblock != nil {
+			height = int64(dblock.Header.DBHeight)
+		}
+		if height != test.height {
+			t.Errorf("FetchDBlockByTime(%v) at height %v, want %v", test.timestamp, height, test.height)
+		}
+	}
+}
+
+func testBatch(t *testing.T, db database.Db) {
+	entry := NewTestEntry("batched")
+	if err := db.InsertEntryMultiBatch(entry); err == nil {
+		t.Errorf("MultiBatch outside of a batch should fail")
+	}
+
+	db.StartBatch()
+	if err := db.InsertEntryMultiBatch(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ProcessDBlockMultiBatch(newTestDBlock(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.EndBatch(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := db.FetchEntryByHash(entry.Hash()); got == nil {
+		t.Errorf("entry not written by EndBatch")
+	}
+	if _, err := db.FetchDBHashByHeight(0); err != nil {
+		t.Errorf("dblock not written by EndBatch: %v", err)
+	}
+}
+
+func testEntriesByChain(t *testing.T, db database.Db) {
+	var chainID *common.Hash
+	var prev *common.EBlock
+	contents := [][]string{{"a", "b", "c"}, {"d", "e"}}
+	for seq, page := range contents {
+		eblock := common.NewEBlock()
+		if prev != nil {
+			eblock.Header.PrevKeyMR, _ = prev.KeyMR()
+		}
+		eblock.Header.EBSequence = uint32(seq)
+		for i, content := range page {
+			entry := NewTestEntry(content)
+			chainID = entry.ChainID
+			if err := db.InsertEntry(entry); err != nil {
+				t.Fatal(err)
+			}
+			eblock.AddEBEntry(entry)
+			if i == 0 {
+				eblock.AddEndOfMinuteMarker(1)
+			}
+		}
+		eblock.Header.ChainID = chainID
+		if err := db.ProcessEBlockBatch(eblock); err != nil {
+			t.Fatal(err)
+		}
+		prev = eblock
+	}
+
+	var got []string
+	var cursor uint64
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("FetchEntriesByChain does not terminate")
+		}
+		entries, next, err := db.FetchEntriesByChain(chainID, cursor, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) > 2 {
+			t.Errorf("page of %v entries exceeds the limit", len(entries))
+		}
+		for _, entry := range entries {
+			got = append(got, string(entry.Content))
+		}
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if strings.Join(got, "") != "abcde" {
+		t.Errorf("FetchEntriesByChain returned %v", got)
+	}
+
+	if err := db.ReindexEntriesByChain(); err != nil {
+		t.Fatal(err)
+	}
+	entries, next, err := db.FetchEntriesByChain(chainID, 0, 0)
+	if err != nil || len(entries) != 5 || next != 0 {
+		t.Errorf("after reindex got %v entries, next %v, err %v", len(entries), next, err)
+	}
+}
+
+func testEntryLocation(t *testing.T, db database.Db) {
+	first := NewTestEntry("first")
+	second := NewTestEntry("second")
+	eblock := common.NewEBlock()
+	eblock.Header.ChainID = first.ChainID
+	eblock.Header.EBHeight = 7
+	eblock.AddEBEntry(first)
+	eblock.AddEndOfMinuteMarker(1)
+	eblock.AddEBEntry(second)
+	eblock.AddEndOfMinuteMarker(2)
+	if err := db.ProcessEBlockBatch(eblock); err != nil {
+		t.Fatal(err)
+	}
+	keyMR, _ := eblock.KeyMR()
+
+	location, err := db.FetchEntryLocation(second.Hash())
+	if err != nil || location == nil {
+		t.Fatalf("FetchEntryLocation: %v %v", location, err)
+	}
+	if !location.EBlockKeyMR.IsSameAs(keyMR) || location.DBHeight != 7 || location.Minute != 2 || location.InDBlock {
+		t.Errorf("unexpected location %+v", location)
+	}
+
+	dblock := newTestDBlock(3)
+	dbEntry, _ := common.NewDBEntry(eblock)
+	dblock.DBEntries = append(dblock.DBEntries, dbEntry)
+	dblock.Header.BlockCount = 1
+	if err := db.ProcessDBlockBatch(dblock); err != nil {
+		t.Fatal(err)
+	}
+
+	location, err = db.FetchEntryLocation(first.Hash())
+	if err != nil || location == nil {
+		t.Fatalf("FetchEntryLocation: %v %v", location, err)
+	}
+	if location.DBHeight != 3 || location.Minute != 1 || !location.InDBlock {
+		t.Errorf("unexpected location %+v", location)
+	}
+
+	location, err = db.FetchEntryLocation(common.Sha([]byte("missing")))
+	if location != nil || err != nil {
+		t.Errorf("missing entry should return nil, nil; got %v, %v", location, err)
+	}
+}
+
+func testRollbackToHeight(t *testing.T, db database.Db) {
+	dblocks := make([]*common.DirectoryBlock, 3)
+	for i := range dblocks {
+		dblocks[i] = newTestDBlock(uint32(i))
+	}
+
+	kept := NewTestEntry("kept")
+	dropped := NewTestEntry("dropped")
+	var prev *common.EBlock
+	for seq, entry := range []*common.Entry{kept, dropped} {
+		if err := db.InsertEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+		eblock := common.NewEBlock()
+		eblock.Header.ChainID = entry.ChainID
+		eblock.Header.EBSequence = uint32(seq)
+		eblock.Header.EBHeight = uint32(seq + 1)
+		if prev != nil {
+			eblock.Header.PrevKeyMR, _ = prev.KeyMR()
+		}
+		eblock.AddEBEntry(entry)
+		if err := db.ProcessEBlockBatch(eblock); err != nil {
+			t.Fatal(err)
+		}
+		dbEntry, _ := common.NewDBEntry(eblock)
+		dblocks[seq+1].DBEntries = append(dblocks[seq+1].DBEntries, dbEntry)
+		dblocks[seq+1].Header.BlockCount = 1
+		prev = eblock
+	}
+	for _, dblock := range dblocks {
+		if err := db.ProcessDBlockBatch(dblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.RollbackToHeight(1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, h, _ := db.FetchBlockHeightCache(); h != 1 {
+		t.Errorf("height cache = %v, want 1", h)
+	}
+	if _, err := db.FetchDBHashByHeight(2); err == nil {
+		t.Errorf("directory block above the rollback height survived")
+	}
+	if _, err := db.FetchDBHashByHeight(1); err != nil {
+		t.Errorf("directory block at the rollback height lost: %v", err)
+	}
+	dChainID, _ := common.NewShaHash(common.D_CHAINID)
+	head, err := db.FetchHeadMRByChainID(dChainID)
+	if err != nil || !head.IsSameAs(dblocks[1].KeyMR) {
+		t.Errorf("directory chain head = %v, %v", head, err)
+	}
+
+	keyMR, _ := prev.KeyMR()
+	if eb, _ := db.FetchEBlockByMR(keyMR); eb != nil {
+		t.Errorf("entry block above the rollback height survived")
+	}
+	if got, _ := db.FetchEntryByHash(dropped.Hash()); got != nil {
+		t.Errorf("entry above the rollback height survived")
+	}
+	if got, _ := db.FetchEntryByHash(kept.Hash()); got == nil {
+		t.Errorf("entry below the rollback height lost")
+	}
+	entries, _, err := db.FetchEntriesByChain(kept.ChainID, 0, 0)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("FetchEntriesByChain after rollback: %v entries, err %v", len(entries), err)
+	}
+	if location, _ := db.FetchEntryLocation(dropped.Hash()); location != nil {
+		t.Errorf("location of a removed entry survived")
+	}
+	hashes, _, err := db.FetchEntryHashesByExtID([]byte("conformance"), false, false, nil, nil, 0)
+	if err != nil || len(hashes) != 1 || !hashes[0].IsSameAs(kept.Hash()) {
+		t.Errorf("external IDs of a removed entry survived: %v, %v", hashes, err)
+	}
+}
+
+func testIterate(t *testing.T, db database.Db) {
+	var prev *common.EBlock
+	var chainID *common.Hash
+	for i := uint32(0); i < 3; i++ {
+		if err := db.ProcessDBlockBatch(newTestDBlock(i)); err != nil {
+			t.Fatal(err)
+		}
+
+		ecBlock := common.NewECBlock()
+		ecBlock.Header.EBHeight = i
+		if err := db.ProcessECBlockBatch(ecBlock); err != nil {
+			t.Fatal(err)
+		}
+
+		entry := NewTestEntry(fmt.Sprint(i))
+		chainID = entry.ChainID
+		eblock := common.NewEBlock()
+		eblock.Header.ChainID = chainID
+		eblock.Header.EBSequence = i
+		if prev != nil {
+			eblock.Header.PrevKeyMR, _ = prev.KeyMR()
+		}
+		eblock.AddEBEntry(entry)
+		if err := db.ProcessEBlockBatch(eblock); err != nil {
+			t.Fatal(err)
+		}
+		prev = eblock
+	}
+
+	var heights []uint32
+	err := db.IterateDBlocks(0, database.AllShas, func(dBlock *common.DirectoryBlock) error {
+		heights = append(heights, dBlock.Header.DBHeight)
+		return nil
+	})
+	if err != nil || len(heights) != 3 || heights[0] != 0 || heights[2] != 2 {
+		t.Errorf("IterateDBlocks visited %v, err %v", heights, err)
+	}
+
+	heights = nil
+	err = db.IterateECBlocks(1, database.AllShas, func(ecBlock *common.ECBlock) error {
+		heights = append(heights, ecBlock.Header.EBHeight)
+		return database.ErrStopIteration
+	})
+	if err != nil || len(heights) != 1 || heights[0] != 1 {
+		t.Errorf("IterateECBlocks with early stop visited %v, err %v", heights, err)
+	}
+
+	heights = nil
+	err = db.IterateEBlocksByChain(chainID, 1, 3, func(eBlock *common.EBlock) error {
+		heights = append(heights, eBlock.Header.EBSequence)
+		return nil
+	})
+	if err != nil || len(heights) != 2 || heights[0] != 1 || heights[1] != 2 {
+		t.Errorf("IterateEBlocksByChain visited %v, err %v", heights, err)
+	}
+
+	failed := errors.New("callback failed")
+	err = db.IterateDBlocks(0, database.AllShas, func(dBlock *common.DirectoryBlock) error {
+		return failed
+	})
+	if err != failed {
+		t.Errorf("IterateDBlocks returned %v, want the callback error", err)
+	}
+
+	n := 0
+	err = db.IterateABlocks(0, database.AllShas, func(aBlock *common.AdminBlock) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 0 {
+		t.Errorf("IterateABlocks on an empty table visited %v blocks, err %v", n, err)
+	}
+}
+
+func testECBalances(t *testing.T, db database.Db) {
+	pubKey := new([32]byte)
+	pubKey[0] = 1
+
+	increase := common.NewIncreaseBalance()
+	increase.ECPubKey = pubKey
+	increase.NumEC = 10
+	commit := common.NewCommitEntry()
+	commit.ECPubKey = pubKey
+	commit.Credits = 3
+
+	for i := uint32(0); i < 3; i++ {
+		if err := db.ProcessDBlockBatch(newTestDBlock(i)); err != nil {
+			t.Fatal(err)
+		}
+		ecBlock := common.NewECBlock()
+		ecBlock.Header.EBHeight = i
+		switch i {
+		case 1:
+			ecBlock.AddEntry(increase)
+		case 2:
+			ecBlock.AddEntry(commit)
+		}
+		if err := db.ProcessECBlockBatch(ecBlock); err != nil {
+			t.Fatal(err)
+		}
+		// a block processed again must not count twice
+		if err := db.ProcessECBlockBatch(ecBlock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	balance, err := db.FetchECBalance(pubKey)
+	if err != nil || balance.Balance != 7 || balance.Spent != 3 {
+		t.Errorf("FetchECBalance = %+v, %v, want balance 7 spent 3", balance, err)
+	}
+	balance, err = db.FetchECBalance(new([32]byte))
+	if err != nil || balance.Balance != 0 || balance.Spent != 0 {
+		t.Errorf("FetchECBalance of an unknown key = %+v, %v", balance, err)
+	}
+
+	n := 0
+	err = db.IterateECBalances(func(key *[32]byte, balance *database.ECBalance) error {
+		n++
+		if *key != *pubKey || balance.Balance != 7 {
+			t.Errorf("IterateECBalances visited %x: %+v", key[:], balance)
+		}
+		return nil
+	})
+	if err != nil || n != 1 {
+		t.Errorf("IterateECBalances visited %v balances, err %v", n, err)
+	}
+
+	if err := db.RollbackToHeight(1); err != nil {
+		t.Fatal(err)
+	}
+	balance, err = db.FetchECBalance(pubKey)
+	if err != nil || balance.Balance != 10 || balance.Spent != 0 {
+		t.Errorf("FetchECBalance after rollback = %+v, %v, want balance 10 spent 0", balance, err)
+	}
+}
+
+func testECBalanceAtHeight(t *testing.T, db database.Db) {
+	pubKey := new([32]byte)
+	pubKey[0] = 1
+
+	// every block adds one credit, so the balance at a height is height+1
+	last := uint32(database.ECCheckpointInterval + 2)
+	for i := uint32(0); i <= last; i++ {
+		increase := common.NewIncreaseBalance()
+		increase.ECPubKey = pubKey
+		increase.NumEC = 1
+		increase.Index = uint64(i)
+		ecBlock := common.NewECBlock()
+		ecBlock.Header.EBHeight = i
+		ecBlock.AddEntry(increase)
+		if err := db.ProcessECBlockBatch(ecBlock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, height := range []uint32{0, 5, database.ECCheckpointInterval - 1, database.ECCheckpointInterval, last} {
+		balance, err := db.FetchECBalanceAtHeight(pubKey, height)
+		if err != nil || balance.Balance != int64(height)+1 {
+			t.Errorf("FetchECBalanceAtHeight(%v) = %+v, %v, want %v", height, balance, err, height+1)
+		}
+	}
+	if _, err := db.FetchECBalanceAtHeight(pubKey, last+1); err == nil {
+		t.Errorf("FetchECBalanceAtHeight above the last ECBlock did not fail")
+	}
+
+	if err := db.RollbackToHeight(database.ECCheckpointInterval - 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.FetchECBalanceAtHeight(pubKey, database.ECCheckpointInterval); err == nil {
+		t.Errorf("FetchECBalanceAtHeight at a rolled back height did not fail")
+	}
+	balance, err := db.FetchECBalanceAtHeight(pubKey, database.ECCheckpointInterval-1)
+	if err != nil || balance.Balance != database.ECCheckpointInterval {
+		t.Errorf("FetchECBalanceAtHeight after rollback = %+v, %v", balance, err)
+	}
+}
+
+func testExtIDIndex(t *testing.T, db database.Db) {
+	newEntry := func(chainName string, extIDs ...string) *common.Entry {
+		entry := common.NewEntry()
+		entry.ChainID = common.Sha([]byte(chainName))
+		for _, extID := range extIDs {
+			entry.ExtIDs = append(entry.ExtIDs, []byte(extID))
+		}
+		if err := db.InsertEntry(entry); err != nil {
+			t.Fatal(err)
+		}
+		return entry
+	}
+	e1 := newEntry("x", "doc-1", "a\x00b")
+	e2 := newEntry("y", "doc-12")
+	e3 := newEntry("x", "doc-2")
+	e4 := newEntry("y", "Doc-1")
+
+	tests := []struct {
+		extID      string
+		prefix     bool
+		ignoreCase bool
+		chainID    *common.Hash
+		want       []*common.Entry
+	}{
+		{"doc-1", false, false, nil, []*common.Entry{e1}},
+		{"doc-1", true, false, nil, []*common.Entry{e1, e2}},
+		{"doc-", true, false, e1.ChainID, []*common.Entry{e1, e3}},
+		{"doc-12", false, false, e1.ChainID, nil},
+		{"a\x00b", false, false, nil, []*common.Entry{e1}},
+		{"a", false, false, nil, nil},
+		{"a\x00", true, false, nil, []*common.Entry{e1}},
+		{"Doc-1", false, false, nil, []*common.Entry{e4}},
+		{"DOC-1", false, false, nil, nil},
+		{"DOC-1", false, true, e4.ChainID, []*common.Entry{e4}},
+		{"A\x00", true, true, nil, []*common.Entry{e1}},
+	}
+	for _, test := range tests {
+		hashes, next, err := db.FetchEntryHashesByExtID([]byte(test.extID), test.prefix, test.ignoreCase, test.chainID, nil, 0)
+		if err != nil || next != nil || len(hashes) != len(test.want) {
+			t.Errorf("FetchEntryHashesByExtID(%q, %v, %v) = %v, %x, %v", test.extID, test.prefix, test.ignoreCase, hashes, next, err)
+			continue
+		}
+		for i, entry := range test.want {
+			if !hashes[i].IsSameAs(entry.Hash()) {
+				t.Errorf("FetchEntryHashesByExtID(%q, %v, %v)[%v] = %v, want %v", test.extID, test.prefix, test.ignoreCase, i, hashes[i], entry.Hash())
+			}
+		}
+	}
+	if hashes, _, err := db.FetchEntryHashesByExtID([]byte("doc-1"), false, true, nil, nil, 0); err != nil || len(hashes) != 2 {
+		t.Errorf("FetchEntryHashesByExtID ignoring case = %v, %v, want 2 hashes", hashes, err)
+	}
+
+	var all []*common.Hash
+	var cursor []byte
+	for pages := 0; pages == 0 || cursor != nil; pages++ {
+		if pages > 3 {
+			t.Fatalf("FetchEntryHashesByExtID paging does not end")
+		}
+		hashes, next, err := db.FetchEntryHashesByExtID([]byte("doc-"), true, false, nil, cursor, 2)
+		if err != nil || len(hashes) > 2 {
+			t.Fatalf("FetchEntryHashesByExtID page = %v, %v", hashes, err)
+		}
+		all = append(all, hashes...)
+		cursor = next
+	}
+	if len(all) != 3 {
+		t.Errorf("FetchEntryHashesByExtID paged %v hashes, want 3", len(all))
+	}
+}
+
+func testPartialHeight(t *testing.T, db database.Db) {
+	for i := uint32(0); i < 3; i++ {
+		ecBlock := common.NewECBlock()
+		ecBlock.Header.EBHeight = i
+		if err := db.ProcessECBlockBatch(ecBlock); err != nil {
+			t.Fatal(err)
+		}
+		if i < 2 {
+			if err := db.ProcessDBlockBatch(newTestDBlock(i)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	discarded, err := database.DiscardPartialHeight(db)
+	if err != nil || !discarded {
+		t.Errorf("DiscardPartialHeight = %v, %v, want true", discarded, err)
+	}
+	if ecBlock, _ := db.FetchECBlockByHeight(2); ecBlock != nil {
+		t.Errorf("partially written ECBlock survived")
+	}
+	if ecBlock, _ := db.FetchECBlockByHeight(1); ecBlock == nil {
+		t.Errorf("ECBlock of the last directory block lost")
+	}
+	discarded, err = database.DiscardPartialHeight(db)
+	if err != nil || discarded {
+		t.Errorf("DiscardPartialHeight of a complete height = %v, %v", discarded, err)
+	}
+
+	// A cancelled batch writes nothing and leaves the height cache alone
+	ecBlock := common.NewECBlock()
+	ecBlock.Header.EBHeight = 2
+	db.StartBatch()
+	if err := db.ProcessECBlockMultiBatch(ecBlock); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.ProcessDBlockMultiBatch(newTestDBlock(2)); err != nil {
+		t.Fatal(err)
+	}
+	db.CancelBatch()
+	if ecBlock, _ := db.FetchECBlockByHeight(2); ecBlock != nil {
+		t.Errorf("ECBlock of a cancelled batch was written")
+	}
+	if _, h, _ := db.FetchBlockHeightCache(); h != 1 {
+		t.Errorf("height cache after a cancelled batch = %v, want 1", h)
+	}
+}
+
+func testArchive(t *testing.T, db database.Db) {
+	dblocks := make([]*common.DirectoryBlock, 3)
+	var entries []*common.Entry
+	var prev *common.EBlock
+	for i := range dblocks {
+		dblocks[i] = newTestDBlock(uint32(i))
+		ecBlock := common.NewECBlock()
+		ecBlock.Header.EBHeight = uint32(i)
+		if err := db.ProcessECBlockBatch(ecBlock); err != nil {
+			t.Fatal(err)
+		}
+		dbEntry, _ := common.NewDBEntryFromECBlock(ecBlock)
+		dblocks[i].DBEntries = append(dblocks[i].DBEntries, dbEntry)
+
+		if i > 0 {
+			entry := NewTestEntry(fmt.Sprintf("archived %v", i))
+			if err := db.InsertEntry(entry); err != nil {
+				t.Fatal(err)
+			}
+			eblock := common.NewEBlock()
+			eblock.Header.ChainID = entry.ChainID
+			eblock.Header.EBSequence = uint32(i - 1)
+			eblock.Header.EBHeight = uint32(i)
+			if prev != nil {
+				eblock.Header.PrevKeyMR, _ = prev.KeyMR()
+			}
+			eblock.AddEBEntry(entry)
+			if err := db.ProcessEBlockBatch(eblock); err != nil {
+				t.Fatal(err)
+			}
+			dbEntry, _ := common.NewDBEntry(eblock)
+			dblocks[i].DBEntries = append(dblocks[i].DBEntries, dbEntry)
+			entries = append(entries, entry)
+			prev = eblock
+		}
+		dblocks[i].Header.BlockCount = uint32(len(dblocks[i].DBEntries))
+		if err := db.ProcessDBlockBatch(dblocks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := database.ExportArchive(db, 1, 2, &buf); err != nil {
+		t.Fatal(err)
+	}
+	archive := buf.Bytes()
+
+	// Importing the archive restores the rolled back heights
+	if err := db.RollbackToHeight(0); err != nil {
+		t.Fatal(err)
+	}
+	r, err := database.NewArchiveReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for height := uint32(1); ; height++ {
+		h, err := r.ReadHeight()
+		if err == io.EOF {
+			if height != 3 {
+				t.Errorf("archive ended before height %v", height)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.DBlock.Header.DBHeight != height || h.ECBlock == nil || len(h.EBlocks) != 1 || len(h.Entries) != 1 {
+			t.Errorf("archived height %v = %+v", height, h)
+		}
+		if err := database.StoreArchiveHeight(db, h); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, dblock := range dblocks {
+		hash, err := db.FetchDBHashByHeight(uint32(i))
+		if err != nil || hash == nil || !hash.IsSameAs(dblock.DBHash) {
+			t.Errorf("directory block hash at height %v = %v, %v, want %v", i, hash, err, dblock.DBHash)
+		}
+	}
+	for _, entry := range entries {
+		if got, _ := db.FetchEntryByHash(entry.Hash()); got == nil {
+			t.Errorf("entry %v was not imported", entry.Hash())
+		}
+	}
+	keyMR, _ := prev.KeyMR()
+	if eb, _ := db.FetchEBlockByMR(keyMR); eb == nil {
+		t.Errorf("entry block %v was not imported", keyMR)
+	}
+
+	// A corrupted height is rejected
+	archive[len(archive)-sha256.Size-1] ^= 0xff
+	r, err = database.NewArchiveReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadHeight(); err != nil {
+		t.Errorf("intact height rejected: %v", err)
+	}
+	if _, err := r.ReadHeight(); err == nil || err == io.EOF {
+		t.Errorf("corrupted height accepted: %v", err)
+	}
+	if _, err := database.NewArchiveReader(bytes.NewReader(archive[1:])); err == nil {
+		t.Errorf("NewArchiveReader accepted data without the archive header")
+	}
+}
+
+func testPrune(t *testing.T, db database.Db) {
+	old := NewTestEntry("old")
+	repeated := NewTestEntry("repeated")
+	recent := NewTestEntry("recent")
+	other := NewTestEntry("other chain")
+	other.ExtIDs = [][]byte{[]byte("other")}
+	other.ChainID = common.NewChainID(other)
+
+	// The main chain has an entry block at heights 1 to 3, the other chain
+	// only one at height 1, which is its head
+	heights := [][]*common.Entry{nil, {old, repeated}, nil, {repeated, recent}}
+	var eblocks []*common.EBlock
+	var otherKeyMR *common.Hash
+	for height, entries := range heights {
+		dblock := newTestDBlock(uint32(height))
+		if height > 0 {
+			if height == 2 {
+				entries = []*common.Entry{NewTestEntry("middle")}
+			}
+			eblock := common.NewEBlock()
+			eblock.Header.ChainID = entries[0].ChainID
+			eblock.Header.EBSequence = uint32(len(eblocks))
+			eblock.Header.EBHeight = uint32(height)
+			if len(eblocks) > 0 {
+				eblock.Header.PrevKeyMR, _ = eblocks[len(eblocks)-1].KeyMR()
+			}
+			for _, entry := range entries {
+				if err := db.InsertEntry(entry); err != nil {
+					t.Fatal(err)
+				}
+				eblock.AddEBEntry(entry)
+			}
+			eblock.AddEndOfMinuteMarker(1)
+			ebs := []*common.EBlock{eblock}
+			if height == 1 {
+				otherBlock := common.NewEBlock()
+				otherBlock.Header.ChainID = other.ChainID
+				otherBlock.Header.EBHeight = 1
+				otherBlock.AddEBEntry(other)
+				if err := db.InsertEntry(other); err != nil {
+					t.Fatal(err)
+				}
+				ebs = append(ebs, otherBlock)
+				otherKeyMR, _ = otherBlock.KeyMR()
+			}
+			for _, eb := range ebs {
+				if err := db.ProcessEBlockBatch(eb); err != nil {
+					t.Fatal(err)
+				}
+				dbEntry, _ := common.NewDBEntry(eb)
+				dblock.DBEntries = append(dblock.DBEntries, dbEntry)
+			}
+			eblocks = append(eblocks, eblock)
+		}
+		dblock.Header.BlockCount = uint32(len(dblock.DBEntries))
+		if err := db.ProcessDBlockBatch(dblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pruned, err := db.PruneBelowHeight(3)
+	if err != nil || pruned != 3 {
+		t.Fatalf("PruneBelowHeight(3) = %v, %v, want 3 entry blocks", pruned, err)
+	}
+	if height, err := db.FetchPrunedHeight(); err != nil || height != 3 {
+		t.Errorf("FetchPrunedHeight = %v, %v", height, err)
+	}
+	if pruned, err := db.PruneBelowHeight(3); err != nil || pruned != 0 {
+		t.Errorf("pruning again = %v, %v", pruned, err)
+	}
+
+	for _, entry := range []*common.Entry{old, other} {
+		if got, err := db.FetchEntryByHash(entry.Hash()); got != nil || err != database.ErrPruned {
+			t.Errorf("FetchEntryByHash(%q) of a pruned entry = %v, %v", entry.Content, got, err)
+		}
+	}
+	for _, entry := range []*common.Entry{repeated, recent} {
+		if got, err := db.FetchEntryByHash(entry.Hash()); got == nil || err != nil {
+			t.Errorf("FetchEntryByHash(%q) = %v, %v", entry.Content, got, err)
+		}
+	}
+	if got, err := db.FetchEntryByHash(common.Sha([]byte("missing"))); got != nil || err != nil {
+		t.Errorf("FetchEntryByHash of an unknown entry = %v, %v", got, err)
+	}
+	if location, _ := db.FetchEntryLocation(old.Hash()); location == nil || location.DBHeight != 1 {
+		t.Errorf("location of a pruned entry = %+v", location)
+	}
+
+	// The header of a pruned block is kept
+	keyMR, _ := eblocks[0].KeyMR()
+	eb, err := db.FetchEBlockByMR(keyMR)
+	if err != database.ErrPruned || eb == nil {
+		t.Fatalf("FetchEBlockByMR of a pruned block = %v, %v", eb, err)
+	}
+	if headerKeyMR, _ := eb.HeaderKeyMR(); !headerKeyMR.IsSameAs(keyMR) || len(eb.Body.EBEntries) != 0 {
+		t.Errorf("pruned block has KeyMR %v and %v entries, want %v and none", headerKeyMR, len(eb.Body.EBEntries), keyMR)
+	}
+	prevKeyMR, _ := eblocks[1].KeyMR()
+	if eb, _ := db.FetchEBlockByMR(prevKeyMR); eb == nil || !eb.Header.PrevKeyMR.IsSameAs(keyMR) {
+		t.Errorf("pruned block lost its link to the previous block: %v", eb)
+	}
+	keyMR, _ = eblocks[2].KeyMR()
+	if eb, err := db.FetchEBlockByMR(keyMR); eb == nil || err != nil || len(eb.Body.EBEntries) != 3 {
+		t.Errorf("FetchEBlockByMR of a recent block = %v, %v", eb, err)
+	}
+
+	var seqs []uint32
+	err = db.IterateEBlocksByChain(old.ChainID, 0, database.AllShas, func(eBlock *common.EBlock) error {
+		seqs = append(seqs, eBlock.Header.EBSequence)
+		return nil
+	})
+	if err != nil || len(seqs) != 3 {
+		t.Errorf("IterateEBlocksByChain visited %v, err %v", seqs, err)
+	}
+	entries, _, err := db.FetchEntriesByChain(old.ChainID, 0, 0)
+	if err != nil || len(entries) != 2 {
+		t.Errorf("FetchEntriesByChain after pruning: %v entries, err %v", len(entries), err)
+	}
+	if dblock, err := db.FetchDBlockByHeight(1); dblock == nil || err != nil {
+		t.Errorf("directory block below the pruned height lost: %v", err)
+	}
+	if hashes, _, _ := db.FetchEntryHashesByExtID([]byte("conformance"), false, false, nil, nil, 0); len(hashes) != 2 {
+		t.Errorf("external IDs of the pruned entries are still indexed: %v", hashes)
+	}
+
+	if head, err := db.FetchHeadMRByChainID(other.ChainID); err != nil || !head.IsSameAs(otherKeyMR) {
+		t.Errorf("pruned chain head = %v, %v, want %v", head, err, otherKeyMR)
+	}
+
+	// Rolling back moves the head of the chain to a pruned block
+	if err := db.RollbackToHeight(1); err == nil {
+		t.Errorf("rolled back below the pruned height")
+	}
+	if err := db.RollbackToHeight(2); err != nil {
+		t.Fatalf("RollbackToHeight(2): %v", err)
+	}
+	if head, err := db.FetchHeadMRByChainID(old.ChainID); err != nil || !head.IsSameAs(prevKeyMR) {
+		t.Errorf("chain head after rollback = %v, %v, want %v", head, err, prevKeyMR)
+	}
+}
+
+func testChainStats(t *testing.T, db database.Db) {
+	first := NewTestEntry("first")
+	second := NewTestEntry("second")
+	third := NewTestEntry("third")
+	other := NewTestEntry("other chain")
+	other.ExtIDs = [][]byte{[]byte("other")}
+	other.ChainID = common.NewChainID(other)
+
+	// The main chain has entry blocks at heights 1 and 3, the other chain
+	// one at height 2. The entries of height 3 are inserted in the same
+	// batch as their entry block.
+	heights := [][]*common.Entry{nil, {first, second}, {other}, {third}}
+	size := make(map[*common.Entry]uint64)
+	for height, entries := range heights {
+		var eblock *common.EBlock
+		for _, entry := range entries {
+			data, _ := entry.MarshalBinary()
+			size[entry] = uint64(len(data))
+			if height < 3 {
+				db.InsertEntry(entry)
+			}
+			if eblock == nil {
+				eblock = common.NewEBlock()
+				eblock.Header.ChainID = entry.ChainID
+				eblock.Header.EBHeight = uint32(height)
+				if height == 3 {
+					eblock.Header.EBSequence = 1
+				}
+			}
+			eblock.AddEBEntry(entry)
+		}
+
+		db.StartBatch()
+		var err error
+		if height == 3 {
+			for _, entry := range entries {
+				if err == nil {
+					err = db.InsertEntryMultiBatch(entry)
+				}
+			}
+		}
+		if err == nil && eblock != nil {
+			eblock.AddEndOfMinuteMarker(1)
+			err = db.ProcessEBlockMultiBatch(eblock)
+		}
+		if err == nil {
+			err = db.ProcessDBlockMultiBatch(newTestDBlock(uint32(height)))
+		}
+		if err != nil {
+			db.CancelBatch()
+			t.Fatal(err)
+		}
+		if err := db.EndBatch(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := db.FetchChainStats(first.ChainID)
+	if err != nil || stats == nil {
+		t.Fatalf("FetchChainStats = %v, %v", stats, err)
+	}
+	if !stats.ChainID.IsSameAs(first.ChainID) || !stats.FirstEntry.IsSameAs(first.Hash()) {
+		t.Errorf("chain %v has first entry %v, want %v", stats.ChainID, stats.FirstEntry, first.Hash())
+	}
+	if len(stats.FirstEntryExtIDs) != 1 || string(stats.FirstEntryExtIDs[0]) != "conformance" {
+		t.Errorf("first entry external IDs %q", stats.FirstEntryExtIDs)
+	}
+	if stats.EBlockCount != 2 || stats.EntryCount != 3 || stats.TotalBytes != size[first]+size[second]+size[third] {
+		t.Errorf("stats counted %v EBlocks, %v entries, %v bytes", stats.EBlockCount, stats.EntryCount, stats.TotalBytes)
+	}
+	if stats.FirstHeight != 1 || stats.LastHeight != 3 {
+		t.Errorf("stats heights %v to %v, want 1 to 3", stats.FirstHeight, stats.LastHeight)
+	}
+	if stats, err := db.FetchChainStats(common.Sha([]byte("missing"))); stats != nil || err != nil {
+		t.Errorf("FetchChainStats of an unknown chain = %v, %v", stats, err)
+	}
+
+	// Both chains, one page at a time
+	var got []*database.ChainStats
+	var cursor *common.Hash
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatalf("FetchAllChainStats does not terminate")
+		}
+		page, next, err := db.FetchAllChainStats(cursor, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page) > 1 {
+			t.Errorf("page of %v chains exceeds the limit", len(page))
+		}
+		got = append(got, page...)
+		if next == nil {
+			break
+		}
+		cursor = next
+	}
+	if len(got) != 2 || bytes.Compare(got[0].ChainID.Bytes(), got[1].ChainID.Bytes()) >= 0 {
+		t.Errorf("FetchAllChainStats returned %v chains out of order", len(got))
+	}
+
+	// Rolling back drops the last block of the main chain and the whole
+	// other chain
+	if err := db.RollbackToHeight(1); err != nil {
+		t.Fatal(err)
+	}
+	stats, err = db.FetchChainStats(first.ChainID)
+	if err != nil || stats == nil {
+		t.Fatalf("FetchChainStats after rollback = %v, %v", stats, err)
+	}
+	if stats.EBlockCount != 1 || stats.EntryCount != 2 || stats.TotalBytes != size[first]+size[second] || stats.LastHeight != 1 {
+		t.Errorf("stats after rollback counted %v EBlocks, %v entries, %v bytes up to height %v", stats.EBlockCount, stats.EntryCount, stats.TotalBytes, stats.LastHeight)
+	}
+	if stats, err := db.FetchChainStats(other.ChainID); stats != nil || err != nil {
+		t.Errorf("stats of a rolled back chain = %v, %v", stats, err)
+	}
+}
+
+func testReceipt(t *testing.T, db database.Db) {
+	var entries []*common.Entry
+	eblock := common.NewEBlock()
+	for i := 0; i < 3; i++ {
+		entry := NewTestEntry(fmt.Sprint("receipt ", i))
+		entries = append(entries, entry)
+		db.InsertEntry(entry)
+		eblock.Header.ChainID = entry.ChainID
+		eblock.AddEBEntry(entry)
+	}
+	eblock.AddEndOfMinuteMarker(1)
+	if err := db.ProcessEBlockBatch(eblock); err != nil {
+		t.Fatal(err)
+	}
+
+	// No receipt before the entry block is in a directory block
+	if receipt, err := database.BuildReceipt(db, entries[1].Hash()); receipt != nil || err != nil {
+		t.Errorf("receipt of an entry without a directory block = %v, %v", receipt, err)
+	}
+
+	dblock := newTestDBlock(0)
+	for i := 0; i < 2; i++ {
+		dblock.DBEntries = append(dblock.DBEntries, &common.DBEntry{
+			ChainID: common.Sha([]byte(fmt.Sprint("other chain ", i))),
+			KeyMR:   common.Sha([]byte(fmt.Sprint("other block ", i))),
+		})
+	}
+	dbEntry, _ := common.NewDBEntry(eblock)
+	dblock.DBEntries = append(dblock.DBEntries, dbEntry)
+	dblock.Header.BlockCount = uint32(len(dblock.DBEntries))
+	dblock.Header.BodyMR, _ = dblock.BuildBodyMR()
+	if err := db.ProcessDBlockBatch(dblock); err != nil {
+		t.Fatal(err)
+	}
+	dblock.BuildKeyMerkleRoot()
+
+	receipt, err := database.BuildReceipt(db, entries[1].Hash())
+	if err != nil || receipt == nil {
+		t.Fatalf("BuildReceipt = %v, %v", receipt, err)
+	}
+	if err := receipt.Verify(); err != nil {
+		t.Error(err)
+	}
+	if !receipt.MerkleBranch.Root.IsSameAs(dblock.KeyMR) || receipt.Anchor != nil {
+		t.Errorf("receipt up to %v with anchor %v, want %v without one", receipt.MerkleBranch.Root, receipt.Anchor, dblock.KeyMR)
+	}
+
+	// Once anchored, the receipt carries the anchor
+	info := common.NewDirBlockInfoFromDBlock(dblock)
+	info.BTCTxHash = common.Sha([]byte("tx"))
+	info.BTCBlockHash = common.Sha([]byte("block"))
+	info.BTCConfirmed = true
+	if err := db.InsertDirBlockInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	receipt, err = database.BuildReceipt(db, entries[1].Hash())
+	if err != nil || receipt == nil || receipt.Anchor == nil {
+		t.Fatalf("BuildReceipt of an anchored entry = %v, %v", receipt, err)
+	}
+	if err := receipt.Verify(); err != nil {
+		t.Error(err)
+	}
+	data := receipt.AnchorData()
+	if len(data) != 40 || string(data[:2]) != "Fa" || !bytes.Equal(data[8:], dblock.KeyMR.Bytes()) {
+		t.Errorf("anchor data %x", data)
+	}
+
+	// A receipt read back from JSON verifies on its own
+	j, err := receipt.JSONByte()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(common.Receipt)
+	if err := json.Unmarshal(j, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.Verify(); err != nil {
+		t.Errorf("receipt from JSON %s: %v", j, err)
+	}
+
+	decoded.Anchor.DBHeight++
+	if err := decoded.Verify(); err == nil {
+		t.Error("Verify accepted an anchor at another height")
+	}
+	decoded.Anchor.DBHeight--
+	decoded.Entry = entries[0].Hash()
+	if err := decoded.Verify(); err == nil {
+		t.Error("Verify accepted a receipt for another entry")
+	}
+
+	if receipt, err := database.BuildReceipt(db, common.Sha([]byte("missing"))); receipt != nil || err != nil {
+		t.Errorf("receipt of a missing entry = %v, %v", receipt, err)
+	}
+}
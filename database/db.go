@@ -5,6 +5,8 @@
 package database
 
 import (
+	"errors"
+
 	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/btcd/wire"
 	"github.com/FactomProject/factoid/block"
@@ -14,6 +16,10 @@ import (
 // a range of shas by height to request them all.
 const AllShas = int64(^uint64(0) >> 1)
 
+// ErrStopIteration can be returned by the callback of an Iterate method to
+// stop the iteration early without an error.
+var ErrStopIteration = errors.New("stop iteration")
+
 // Db defines a generic interface that is used to request and insert data into db
 type Db interface {
 	// Close cleanly shuts down the database and syncs all data.
@@ -31,9 +37,23 @@ type Db interface {
 	InsertEntry(entry *common.Entry) (err error)
 	InsertEntryMultiBatch(entry *common.Entry) (err error)
 
-	// FetchEntry gets an entry by hash from the database.
+	// FetchEntry gets an entry by hash from the database. It returns nil
+	// for an unknown entry and ErrPruned for one that has been pruned.
 	FetchEntryByHash(entrySha *common.Hash) (entry *common.Entry, err error)
 
+	// FetchEntriesByChain gets up to limit entries of a chain in the order
+	// they were added, starting at cursor (0 for the first page). The
+	// returned cursor fetches the next page and is 0 when there is none.
+	FetchEntriesByChain(chainID *common.Hash, cursor uint64, limit int) (entries []*common.Entry, next uint64, err error)
+
+	// FetchEntryLocation gets the entry block, directory block height and
+	// minute an entry was recorded in. It returns nil if the entry is unknown.
+	FetchEntryLocation(entryHash *common.Hash) (location *EntryLocation, err error)
+
+	// ReindexEntriesByChain rebuilds the chain entry index from the stored
+	// entry blocks, for databases written before the index existed.
+	ReindexEntriesByChain() error
+
 	// FetchEBEntriesFromQueue gets all of the ebentries that have not been processed
 	//FetchEBEntriesFromQueue(chainID *[]byte, startTime *[]byte) (ebentries []*common.EBEntry, err error)
 
@@ -54,25 +74,39 @@ type Db interface {
 	//FetchAllChains gets all of the chains
 	FetchAllChains() (chains []*common.EChain, err error)
 
+	// FetchChainStats gets the statistics of an entry chain, nil for an
+	// unknown chain.
+	FetchChainStats(chainID *common.Hash) (stats *ChainStats, err error)
+
+	// FetchAllChainStats gets the statistics of up to limit entry chains,
+	// ordered by chain ID and starting at the chain ID cursor (nil for the
+	// first page). The returned cursor fetches the next page and is nil
+	// when there is none; a limit < 1 means no limit.
+	FetchAllChainStats(cursor *common.Hash, limit int) (stats []*ChainStats, next *common.Hash, err error)
+
 	// FetchEntryInfoBranchByHash gets an EntryInfo obj
 	//FetchEntryInfoByHash(entryHash *common.Hash) (entryInfo *common.EntryInfo, err error)
 
 	// FetchEntryInfoBranchByHash gets an EntryInfoBranch obj
 	// FetchEntryInfoBranchByHash(entryHash *common.Hash) (entryInfoBranch *common.EntryInfoBranch, err error)
 
-	// FetchEntryBlock gets an entry by hash from the database.
+	// FetchEntryBlock gets an entry by hash from the database. A pruned
+	// entry block comes back with its header only and ErrPruned, see
+	// UnmarshalStoredEBlock; the other EBlock methods do the same.
 	FetchEBlockByHash(eBlockHash *common.Hash) (eBlock *common.EBlock, err error)
 
 	// FetchEBlockByMR gets an entry block by merkle root from the database.
 	FetchEBlockByMR(eBMR *common.Hash) (eBlock *common.EBlock, err error)
 
-	// FetchEBlockByHeight gets an entry block by height from the database.
-	//FetchEBlockByHeight(chainID * common.Hash, eBlockHeight uint32) (eBlock *common.EBlock, err error)
+	// FetchEBlockByHeight gets the entry block of a chain by its sequence
+	// number, EBSequence, from the database.
+	FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint32) (eBlock *common.EBlock, err error)
 
 	// FetchEBHashByMR gets an entry by hash from the database.
 	FetchEBHashByMR(eBMR *common.Hash) (eBlockHash *common.Hash, err error)
 
 	// FetchAllEBlocksByChain gets all of the blocks by chain id
+	// Deprecated: use IterateEBlocksByChain.
 	FetchAllEBlocksByChain(chainID *common.Hash) (eBlocks *[]common.EBlock, err error)
 
 	// FetchDBlock gets an entry by hash from the database.
@@ -92,6 +126,7 @@ type Db interface {
 	InsertDirBlockInfoMultiBatch(dirBlockInfo *common.DirBlockInfo) (err error)
 
 	// FetchAllDirBlockInfo gets all of the dirBlockInfo
+	// Deprecated: use IterateDirBlockInfo.
 	FetchAllDirBlockInfo() (ddirBlockInfoMap map[string]*common.DirBlockInfo, err error)
 
 	// FetchAllUnconfirmedDirBlockInfo gets all of the dirBlockInfos that have BTC Anchor confirmation
@@ -108,14 +143,40 @@ type Db interface {
 	// more are present, use the special id `AllShas'.
 	FetchHeightRange(startHeight, endHeight int64) (rshalist []wire.ShaHash, err error)
 
+	// IterateDBlocks calls fn with the directory blocks from startHeight up
+	// to, not including, endHeight in height order; use AllShas as endHeight
+	// to get all of them. It stops at the first missing height or when fn
+	// returns an error, which is returned unless it is ErrStopIteration.
+	// The same goes for the other Iterate methods.
+	IterateDBlocks(startHeight, endHeight int64, fn func(dBlock *common.DirectoryBlock) error) error
+
+	// IterateDirBlockInfo calls fn with the dirBlockInfo of the directory
+	// blocks from startHeight up to endHeight, skipping those without one.
+	IterateDirBlockInfo(startHeight, endHeight int64, fn func(dirBlockInfo *common.DirBlockInfo) error) error
+
+	// IterateABlocks calls fn with the admin blocks by directory block height.
+	IterateABlocks(startHeight, endHeight int64, fn func(aBlock *common.AdminBlock) error) error
+
+	// IterateECBlocks calls fn with the entry credit blocks by height.
+	IterateECBlocks(startHeight, endHeight int64, fn func(ecBlock *common.ECBlock) error) error
+
+	// IterateFBlocks calls fn with the factoid blocks by directory block height.
+	IterateFBlocks(startHeight, endHeight int64, fn func(fBlock block.IFBlock) error) error
+
+	// IterateEBlocksByChain calls fn with the entry blocks of a chain from
+	// sequence number startSeq up to endSeq.
+	IterateEBlocksByChain(chainID *common.Hash, startSeq, endSeq int64, fn func(eBlock *common.EBlock) error) error
+
 	// FetchBlockHeightBySha returns the block height for the given hash.  This is
 	// part of the database.Db interface implementation.
 	FetchBlockHeightBySha(sha *wire.ShaHash) (int64, error)
 
 	// FetchAllECBlocks gets all of the entry credit blocks
+	// Deprecated: use IterateECBlocks.
 	FetchAllECBlocks() (cBlocks []common.ECBlock, err error)
 
 	// FetchAllFBInfo gets all of the fbInfo
+	// Deprecated: use IterateDBlocks.
 	FetchAllDBlocks() (fBlocks []common.DirectoryBlock, err error)
 
 	// FetchDBHashByHeight gets a dBlockHash from the database.
@@ -124,6 +185,10 @@ type Db interface {
 	// FetchDBlockByHeight gets an directory block by height from the database.
 	FetchDBlockByHeight(dBlockHeight uint32) (dBlock *common.DirectoryBlock, err error)
 
+	// FetchDBlockByTime gets the directory block covering timestamp, in
+	// minutes since the epoch, see SearchDBlockByTime.
+	FetchDBlockByTime(timestamp uint32) (dBlock *common.DirectoryBlock, err error)
+
 	// ProcessECBlockBatche inserts the ECBlock and update all it's ecbentries in DB
 	ProcessECBlockBatch(block *common.ECBlock) (err error)
 	ProcessECBlockMultiBatch(block *common.ECBlock) (err error)
@@ -134,8 +199,28 @@ type Db interface {
 	// FetchECBlockByHeight gets an Entry Credit block by hash from the database.
 	FetchECBlockByHeight(height uint32) (ecBlock *common.ECBlock, err error)
 
-	// Initialize External ID map for explorer search
-	InitializeExternalIDMap() (extIDMap map[string]bool, err error)
+	// FetchECBalance gets the entry credit balance of a public key as of the
+	// last processed ECBlock. Unknown keys have a zero balance.
+	FetchECBalance(pubKey *[32]byte) (balance *ECBalance, err error)
+
+	// IterateECBalances calls fn with every stored entry credit balance.
+	IterateECBalances(fn func(pubKey *[32]byte, balance *ECBalance) error) error
+
+	// FetchECBalanceAtHeight gets the entry credit balance of a public key as
+	// of the ECBlock at a directory block height.
+	FetchECBalanceAtHeight(pubKey *[32]byte, height uint32) (balance *ECBalance, err error)
+
+	// FetchFactoidBalanceAtHeight gets the factoid balance, in factoshis, of
+	// an address as of the factoid block at a directory block height.
+	FetchFactoidBalanceAtHeight(address *[32]byte, height uint32) (balance uint64, err error)
+
+	// FetchEntryHashesByExtID gets up to limit hashes of the entries with an
+	// external ID equal to extID, or starting with it if prefix is set, in
+	// the chain chainID or in any chain if it is nil. With ignoreCase set
+	// ASCII letters match in either case, like the lowercased external IDs
+	// of the old explorer search. The returned cursor fetches the next page
+	// and is nil when there is none.
+	FetchEntryHashesByExtID(extID []byte, prefix bool, ignoreCase bool, chainID *common.Hash, cursor []byte, limit int) (hashes []*common.Hash, next []byte, err error)
 
 	// ProcessABlockBatch inserts the AdminBlock
 	ProcessABlockBatch(block *common.AdminBlock) error
@@ -148,6 +233,7 @@ type Db interface {
 	FetchABlockByHeight(height uint32) (aBlock *common.AdminBlock, err error)
 
 	// FetchAllABlocks gets all of the admin blocks
+	// Deprecated: use IterateABlocks.
 	FetchAllABlocks() (aBlocks []common.AdminBlock, err error)
 
 	// ProcessABlockBatch inserts the AdminBlock
@@ -161,6 +247,7 @@ type Db interface {
 	FetchFBlockByHeight(height uint32) (block.IFBlock, error)
 
 	// FetchAllABlocks gets all of the admin blocks
+	// Deprecated: use IterateFBlocks.
 	FetchAllFBlocks() ([]block.IFBlock, error)
 
 	// UpdateBlockHeightCache updates the dir block height cache in db
@@ -178,6 +265,23 @@ type Db interface {
 	// FtchHeadMRByChainID gets a MR of the highest block from the database.
 	FetchHeadMRByChainID(chainID *common.Hash) (blkMR *common.Hash, err error)
 
+	// RollbackToHeight deletes every block above the directory block height
+	// and everything indexed from them, and moves the chain heads and the
+	// block height caches back to the blocks at height.
+	RollbackToHeight(height uint32) error
+
+	// PruneBelowHeight deletes the entries and the entry block bodies
+	// recorded below the directory block height and returns the number of
+	// entry blocks pruned. Every block header and cross reference is kept.
+	PruneBelowHeight(height uint32) (pruned int, err error)
+
+	// FetchPrunedHeight returns the height below which the database has
+	// been pruned, 0 if it never was.
+	FetchPrunedHeight() (height uint32, err error)
+
+	// StartBatch opens a batch the MultiBatch methods write into and locks
+	// the database until EndBatch writes it or CancelBatch discards it.
 	StartBatch()
 	EndBatch() error
+	CancelBatch()
 }
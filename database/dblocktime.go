@@ -0,0 +1,44 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// SearchDBlockByTime returns the directory block covering timestamp, in
+// minutes since the epoch like DBlockHeader.Timestamp: the last one stamped
+// at or before it. It returns nil if the database is empty or timestamp is
+// before the genesis block. Directory block timestamps never decrease with
+// the height, so it binary searches the heights and reads about log2 of the
+// chain height blocks.
+func SearchDBlockByTime(db Db, timestamp uint32) (*common.DirectoryBlock, error) {
+	height, err := FetchDChainHeight(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var found *common.DirectoryBlock
+	low, high := int64(0), height
+	for low <= high {
+		mid := low + (high-low)/2
+		dBlock, err := db.FetchDBlockByHeight(uint32(mid))
+		if err != nil {
+			return nil, err
+		}
+		if dBlock == nil {
+			return nil, fmt.Errorf("directory block %v is missing", mid)
+		}
+		if dBlock.Header.Timestamp <= timestamp {
+			found = dBlock
+			low = mid + 1
+		} else {
+			high = mid - 1
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// ECCheckpointInterval is the number of directory block heights between the
+// stored snapshots of all entry credit balances. Balances at a height are
+// computed from the snapshot at or below it.
+const ECCheckpointInterval = 1000
+
+// ECBalance is the entry credit balance of a public key as of the last
+// processed ECBlock. Spent is the total of the credits paid for commits,
+// which the factoid state has to be told about at startup.
+type ECBalance struct {
+	Balance int64
+	Spent   int64
+}
+
+// MarshalBinary encodes the balance as two big endian int64s.
+func (b *ECBalance) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 16)
+	binary.BigEndian.PutUint64(data[:8], uint64(b.Balance))
+	binary.BigEndian.PutUint64(data[8:], uint64(b.Spent))
+	return data, nil
+}
+
+func (b *ECBalance) UnmarshalBinary(data []byte) error {
+	if len(data) != 16 {
+		return fmt.Errorf("entry credit balance is %v bytes, expected 16", len(data))
+	}
+	b.Balance = int64(binary.BigEndian.Uint64(data[:8]))
+	b.Spent = int64(binary.BigEndian.Uint64(data[8:]))
+	return nil
+}
+
+// Add adds the change c to the balance.
+func (b *ECBalance) Add(c *ECBalance) {
+	b.Balance += c.Balance
+	b.Spent += c.Spent
+}
+
+// Sub takes the change c back from the balance.
+func (b *ECBalance) Sub(c *ECBalance) {
+	b.Balance -= c.Balance
+	b.Spent -= c.Spent
+}
+
+// ECBalanceChanges returns how an entry credit block changes the balance of
+// every public key it mentions: commits spend credits and balance increases
+// add them.
+func ECBalanceChanges(block *common.ECBlock) (map[[32]byte]*ECBalance, error) {
+	changes := make(map[[32]byte]*ECBalance)
+	change := func(pubKey *[32]byte) *ECBalance {
+		c, ok := changes[*pubKey]
+		if !ok {
+			c = new(ECBalance)
+			changes[*pubKey] = c
+		}
+		return c
+	}
+
+	for _, entry := range block.Body.Entries {
+		switch entry.ECID() {
+		case common.ECIDChainCommit:
+			e := entry.(*common.CommitChain)
+			c := change(e.ECPubKey)
+			c.Balance -= int64(e.Credits)
+			c.Spent += int64(e.Credits)
+		case common.ECIDEntryCommit:
+			e := entry.(*common.CommitEntry)
+			c := change(e.ECPubKey)
+			c.Balance -= int64(e.Credits)
+			c.Spent += int64(e.Credits)
+		case common.ECIDBalanceIncrease:
+			e := entry.(*common.IncreaseBalance)
+			change(e.ECPubKey).Balance += int64(e.NumEC)
+		case common.ECIDServerIndexNumber:
+		case common.ECIDMinuteNumber:
+		default:
+			return nil, fmt.Errorf("unknown entry type %v in ECBlock %v", entry.ECID(), block.Header.EBHeight)
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"github.com/FactomProject/factoid/block"
+)
+
+// FactoidCheckpointInterval is the number of directory block heights
+// between the stored snapshots of all factoid balances. Balances at a
+// height are computed from the snapshot at or below it.
+const FactoidCheckpointInterval = 1000
+
+// FactoidBalanceChanges returns how a factoid block changes the balance, in
+// factoshis, of every address it mentions: transaction inputs spend from
+// an address and outputs pay to it. Entry credit outputs only change entry
+// credit balances.
+func FactoidBalanceChanges(fBlock block.IFBlock) map[[32]byte]int64 {
+	changes := make(map[[32]byte]int64)
+	for _, t := range fBlock.GetTransactions() {
+		for _, in := range t.GetInputs() {
+			var address [32]byte
+			copy(address[:], in.GetAddress().Bytes())
+			changes[address] -= int64(in.GetAmount())
+		}
+		for _, out := range t.GetOutputs() {
+			var address [32]byte
+			copy(address[:], out.GetAddress().Bytes())
+			changes[address] += int64(out.GetAmount())
+		}
+	}
+	return changes
+}
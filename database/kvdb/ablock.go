@@ -1,19 +1,15 @@
-package ldb
+package kvdb
 
 import (
-	//	"errors"
 	"bytes"
 	"encoding/binary"
 	"fmt"
 
 	"github.com/FactomProject/FactomCode/common"
-	"github.com/FactomProject/goleveldb/leveldb"
-	"github.com/FactomProject/goleveldb/leveldb/iterator"
-	"github.com/FactomProject/goleveldb/leveldb/util"
 )
 
 // ProcessABlockBatch inserts the AdminBlock
-func (db *LevelDb) ProcessABlockBatch(block *common.AdminBlock) error {
+func (db *KVDb) ProcessABlockBatch(block *common.AdminBlock) error {
 	if block == nil {
 		return nil
 	}
@@ -21,7 +17,7 @@ func (db *LevelDb) ProcessABlockBatch(block *common.AdminBlock) error {
 	defer db.dbLock.Unlock()
 
 	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+		db.lbatch = new(Batch)
 	}
 	defer db.lbatch.Reset()
 
@@ -30,15 +26,10 @@ func (db *LevelDb) ProcessABlockBatch(block *common.AdminBlock) error {
 		return err
 	}
 
-	err = db.lDb.Write(db.lbatch, db.wo)
-	if err != nil {
-		fmt.Printf("batch failed %v\n", err)
-		return err
-	}
-	return nil
+	return db.store.Write(db.lbatch)
 }
 
-func (db *LevelDb) ProcessABlockMultiBatch(block *common.AdminBlock) error {
+func (db *KVDb) ProcessABlockMultiBatch(block *common.AdminBlock) error {
 	if block == nil {
 		return nil
 	}
@@ -79,12 +70,11 @@ func (db *LevelDb) ProcessABlockMultiBatch(block *common.AdminBlock) error {
 }
 
 // FetchABlockByHash gets an admin block by hash from the database.
-func (db *LevelDb) FetchABlockByHash(aBlockHash *common.Hash) (aBlock *common.AdminBlock, err error) {
+func (db *KVDb) FetchABlockByHash(aBlockHash *common.Hash) (aBlock *common.AdminBlock, err error) {
 	var key = []byte{byte(TBL_AB)}
 	key = append(key, aBlockHash.Bytes()...)
-	var data []byte
 	db.dbLock.RLock()
-	data, err = db.lDb.Get(key, db.ro)
+	data, _ := db.store.Get(key)
 	db.dbLock.RUnlock()
 
 	if data != nil {
@@ -98,16 +88,15 @@ func (db *LevelDb) FetchABlockByHash(aBlockHash *common.Hash) (aBlock *common.Ad
 }
 
 // FetchABlockByHeight gets an admin block by hash from the database.
-func (db *LevelDb) FetchABlockByHeight(height uint32) (aBlock *common.AdminBlock, err error) {
+func (db *KVDb) FetchABlockByHeight(height uint32) (aBlock *common.AdminBlock, err error) {
 	var key = []byte{byte(TBL_AB_NUM)}
 	var buf bytes.Buffer
 	binary.Write(&buf, binary.BigEndian, height)
 	key = append(key, common.ADMIN_CHAINID...)
 	key = append(key, buf.Bytes()...)
 
-	var data []byte
 	db.dbLock.RLock()
-	data, err = db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
@@ -122,32 +111,31 @@ func (db *LevelDb) FetchABlockByHeight(height uint32) (aBlock *common.AdminBlock
 }
 
 // FetchAllABlocks gets all of the admin blocks
-func (db *LevelDb) FetchAllABlocks() (aBlocks []common.AdminBlock, err error) {
+func (db *KVDb) FetchAllABlocks() (aBlocks []common.AdminBlock, err error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
-	var fromkey = []byte{byte(TBL_AB)}   // Table Name (1 bytes)						// Timestamp  (8 bytes)
+
+	var fromkey = []byte{byte(TBL_AB)}   // Table Name (1 bytes)
 	var tokey = []byte{byte(TBL_AB + 1)} // Table Name (1 bytes)
-	var iter iterator.Iterator
 	aBlockSlice := make([]common.AdminBlock, 0, 10)
-	iter = db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
 
-	for iter.Next() {
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
 		var aBlock common.AdminBlock
-		_, err := aBlock.UnmarshalBinaryData(iter.Value())
+		_, err := aBlock.UnmarshalBinaryData(value)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		//TODO: to be optimized??
 		_, err = aBlock.PartialHash()
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		aBlockSlice = append(aBlockSlice, aBlock)
-
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err = iter.Error()
 
 	return aBlockSlice, nil
 }
@@ -0,0 +1,201 @@
+package kvdb
+
+import (
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// FetchChainStats gets the statistics of an entry chain, nil for an unknown
+// chain.
+func (db *KVDb) FetchChainStats(chainID *common.Hash) (*database.ChainStats, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	return db.fetchChainStats(chainID)
+}
+
+func (db *KVDb) fetchChainStats(chainID *common.Hash) (*database.ChainStats, error) {
+	var key = []byte{byte(TBL_CHAIN_STATS)}
+	key = append(key, chainID.Bytes()...)
+	data, err := db.store.Get(key)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stats := new(database.ChainStats)
+	err = stats.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// FetchAllChainStats gets the statistics of up to limit entry chains,
+// ordered by chain ID and starting at the chain ID cursor (nil for the
+// first page). The returned cursor fetches the next page and is nil when
+// there is none; a limit < 1 means no limit.
+func (db *KVDb) FetchAllChainStats(cursor *common.Hash, limit int) (stats []*database.ChainStats, next *common.Hash, err error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	var fromkey []byte = []byte{byte(TBL_CHAIN_STATS)}
+	if cursor != nil {
+		fromkey = append(fromkey, cursor.Bytes()...)
+	}
+	var tokey []byte = []byte{byte(TBL_CHAIN_STATS + 1)}
+
+	stats = make([]*database.ChainStats, 0, 10)
+
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
+		if limit > 0 && len(stats) == limit {
+			next = common.NewHash()
+			err := next.SetBytes(key[1:])
+			if err != nil {
+				return err
+			}
+			return errPageFull
+		}
+
+		s := new(database.ChainStats)
+		err := s.UnmarshalBinary(value)
+		if err != nil {
+			return err
+		}
+		stats = append(stats, s)
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, nil, err
+	}
+	return stats, next, nil
+}
+
+// updateChainStatsMultiBatch queues the statistics of the chain of a new
+// entry block. The statistics are read from the store, not from the batch,
+// so a batch must not hold more than one entry block of a chain, as is the
+// case for the blocks of a directory block.
+func (db *KVDb) updateChainStatsMultiBatch(eblock *common.EBlock) error {
+	change, err := database.EBlockChainStats(eblock, db.fetchStatsEntry)
+	if err != nil {
+		return err
+	}
+	stats, err := db.fetchChainStats(eblock.Header.ChainID)
+	if err != nil {
+		return err
+	}
+	if stats == nil {
+		stats = &database.ChainStats{ChainID: eblock.Header.ChainID}
+	}
+	stats.Add(change)
+	return db.putChainStatsMultiBatch(stats)
+}
+
+func (db *KVDb) putChainStatsMultiBatch(stats *database.ChainStats) error {
+	binaryStats, err := stats.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var key = []byte{byte(TBL_CHAIN_STATS)}
+	key = append(key, stats.ChainID.Bytes()...)
+	db.lbatch.Put(key, binaryStats)
+	return nil
+}
+
+// fetchStatsEntry gets an entry counted in the chain statistics, from the
+// entries inserted in the open batch or from the store. It returns nil for
+// an entry that is in neither.
+func (db *KVDb) fetchStatsEntry(entryHash *common.Hash) (*common.Entry, error) {
+	if entry, ok := db.batchEntries[*entryHash]; ok {
+		return entry, nil
+	}
+
+	data, err := db.getValue(TBL_ENTRY, entryHash.Bytes())
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entry := new(common.Entry)
+	_, err = entry.UnmarshalBinaryData(data)
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// chainStatsFromEBlocks computes the statistics of every entry chain from
+// the entry blocks in the database. Pruned blocks count no entries.
+func (db *KVDb) chainStatsFromEBlocks() (map[string]*database.ChainStats, error) {
+	all := make(map[string]*database.ChainStats)
+	// The keys are ordered by chain ID and sequence number
+	err := db.forEach(TBL_EB_CHAIN_NUM, func(key, value []byte) error {
+		data, err := db.getValue(TBL_EB, value)
+		if err != nil {
+			return err
+		}
+		eblock, err := database.UnmarshalStoredEBlock(data)
+		if err != nil && err != database.ErrPruned {
+			return err
+		}
+		change, err := database.EBlockChainStats(eblock, db.fetchStatsEntry)
+		if err != nil {
+			return err
+		}
+
+		chainID := string(eblock.Header.ChainID.Bytes())
+		if all[chainID] == nil {
+			all[chainID] = &database.ChainStats{ChainID: eblock.Header.ChainID}
+		}
+		all[chainID].Add(change)
+		return nil
+	})
+	return all, err
+}
+
+// rebuildChainStatsMultiBatch queues a chunk of the statistics of the
+// entry chains computed from the entry blocks in the database: the old
+// statistics are deleted first, then each block adds to the stored ones.
+func (db *KVDb) rebuildChainStatsMultiBatch(cursor []byte) ([]byte, error) {
+	// The statistics changed in this chunk, which the store does not hold
+	// yet
+	all := make(map[string]*database.ChainStats)
+
+	return db.migrateTables(cursor, []uint8{TBL_CHAIN_STATS, TBL_EB_CHAIN_NUM}, func(table uint8, key, value []byte) error {
+		if table == TBL_CHAIN_STATS {
+			db.lbatch.Delete(append([]byte{byte(TBL_CHAIN_STATS)}, key...))
+			return nil
+		}
+
+		data, err := db.getValue(TBL_EB, value)
+		if err != nil {
+			return err
+		}
+		eblock, err := database.UnmarshalStoredEBlock(data)
+		if err != nil && err != database.ErrPruned {
+			return err
+		}
+		change, err := database.EBlockChainStats(eblock, db.fetchStatsEntry)
+		if err != nil {
+			return err
+		}
+
+		chainID := string(eblock.Header.ChainID.Bytes())
+		stats, ok := all[chainID]
+		if !ok {
+			stats, err = db.fetchChainStats(eblock.Header.ChainID)
+			if err != nil {
+				return err
+			}
+			if stats == nil {
+				stats = &database.ChainStats{ChainID: eblock.Header.ChainID}
+			}
+			all[chainID] = stats
+		}
+		stats.Add(change)
+		return db.putChainStatsMultiBatch(stats)
+	})
+}
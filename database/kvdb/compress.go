@@ -0,0 +1,106 @@
+package kvdb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"strings"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/golang/snappy"
+)
+
+// Compression is the codec the values of TBL_ENTRY and TBL_EB are stored
+// with. It only applies to the values written after it is set; each value
+// records its own codec, so values written with any setting stay readable.
+type Compression byte
+
+const (
+	NoCompression Compression = iota
+	SnappyCompression
+)
+
+// ParseCompression returns the Compression named by a config value: NONE,
+// or an empty value, and SNAPPY.
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToUpper(name) {
+	case "", "NONE":
+		return NoCompression, nil
+	case "SNAPPY":
+		return SnappyCompression, nil
+	}
+	return NoCompression, fmt.Errorf("unknown compression %q", name)
+}
+
+// SetCompression sets the codec of the entries and entry blocks written
+// from now on.
+func (db *KVDb) SetCompression(c Compression) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	db.compression = c
+}
+
+// compressedMagic starts a compressed value and is followed by the codec
+// and the compressed bytes. A raw value can start with it too, which is why
+// decodeValue checks the hash of the value against its key first.
+var compressedMagic = []byte{0xFA, 0xC7, 0x0D, 0xE1}
+
+// encodeValue compresses a TBL_ENTRY or TBL_EB value with the configured
+// codec, unless that does not make it smaller.
+func (db *KVDb) encodeValue(value []byte) []byte {
+	switch db.compression {
+	case SnappyCompression:
+		compressed := append(append([]byte{}, compressedMagic...), byte(SnappyCompression))
+		compressed = append(compressed, snappy.Encode(nil, value)...)
+		if len(compressed) < len(value) {
+			return compressed
+		}
+	}
+	return value
+}
+
+// decodeValue returns the raw value of a TBL_ENTRY or TBL_EB record. The
+// key is the hash of the raw value, without the table prefix.
+func decodeValue(table uint8, key []byte, value []byte) ([]byte, error) {
+	if len(value) <= len(compressedMagic) || !bytes.HasPrefix(value, compressedMagic) {
+		return value, nil
+	}
+	if bytes.Equal(rawValueHash(table, value), key) {
+		return value, nil
+	}
+
+	switch Compression(value[len(compressedMagic)]) {
+	case SnappyCompression:
+		raw, err := snappy.Decode(nil, value[len(compressedMagic)+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress %v value %x: %v", tableNames[table], key, err)
+		}
+		return raw, nil
+	}
+	return nil, fmt.Errorf("%v value %x has unknown compression %v", tableNames[table], key, value[len(compressedMagic)])
+}
+
+// rawValueHash returns the hash a raw TBL_ENTRY or TBL_EB value is stored
+// under.
+func rawValueHash(table uint8, value []byte) []byte {
+	if table == TBL_ENTRY {
+		h1 := sha512.Sum512(value)
+		h2 := sha256.Sum256(append(h1[:], value...))
+		return h2[:]
+	}
+	return common.Sha(value).Bytes()
+}
+
+// getValue gets and decodes the TBL_ENTRY or TBL_EB value stored under a
+// hash. The caller holds the lock.
+func (db *KVDb) getValue(table uint8, hash []byte) ([]byte, error) {
+	var key []byte = []byte{byte(table)}
+	key = append(key, hash...)
+	data, err := db.store.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return decodeValue(table, hash, data)
+}
@@ -1,8 +1,4 @@
-// Copyright (c) 2013-2014 Conformal Systems LLC.
-// Use of this source code is governed by an ISC
-// license that can be found in the LICENSE file.
-
-package ldb
+package kvdb
 
 import (
 	"bytes"
@@ -13,51 +9,10 @@ import (
 	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/FactomCode/database"
 	"github.com/FactomProject/btcd/wire"
-	"github.com/FactomProject/goleveldb/leveldb"
-	"github.com/FactomProject/goleveldb/leveldb/util"
 )
 
-// FetchDBEntriesFromQueue gets all of the dbentries that have not been processed
-/*func (db *LevelDb) FetchDBEntriesFromQueue(startTime *[]byte) (dbentries []*common.DBEntry, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
-	var fromkey = []byte{byte(TBL_EB_QUEUE)} // Table Name (1 bytes)
-	fromkey = append(fromkey, *startTime...)        // Timestamp  (8 bytes)
-
-	var tokey = []byte{byte(TBL_EB_QUEUE)} // Table Name (4 bytes)
-	binaryTimestamp := make([]byte, 8)
-	binary.BigEndian.PutUint64(binaryTimestamp, uint64(time.Now().Unix()))
-	tokey = append(tokey, binaryTimestamp...) // Timestamp  (8 bytes)
-
-	fbEntrySlice := make([]*common.DBEntry, 0, 10)
-
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
-
-	for iter.Next() {
-		if bytes.Equal(iter.Value(), []byte{byte(STATUS_IN_QUEUE)}) {
-			key := make([]byte, len(iter.Key()))
-			copy(key, iter.Key())
-			dbEntry := new(common.DBEntry)
-
-			dbEntry.SetTimestamp(key[1:9]) // Timestamp (8 bytes)
-			cid := key[9:41]
-			dbEntry.ChainID = new(common.Hash)
-			dbEntry.ChainID.Bytes = cid // Chain id (32 bytes)
-			dbEntry.SetHash(key[41:73]) // Entry Hash (32 bytes)
-
-			fbEntrySlice = append(fbEntrySlice, dbEntry)
-		}
-	}
-	iter.Release()
-	err = iter.Error()
-
-	return fbEntrySlice, nil
-}
-*/
-
 // ProcessDBlockBatch inserts the DBlock and update all it's dbentries in DB
-func (db *LevelDb) ProcessDBlockBatch(dblock *common.DirectoryBlock) error {
+func (db *KVDb) ProcessDBlockBatch(dblock *common.DirectoryBlock) error {
 	if dblock == nil {
 		return nil
 	}
@@ -65,24 +20,22 @@ func (db *LevelDb) ProcessDBlockBatch(dblock *common.DirectoryBlock) error {
 	defer db.dbLock.Unlock()
 
 	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+		db.lbatch = new(Batch)
 	}
 	defer db.lbatch.Reset()
 
+	db.saveHeightCache()
 	err := db.ProcessDBlockMultiBatch(dblock)
-	if err != nil {
-		return err
+	if err == nil {
+		err = db.store.Write(db.lbatch)
 	}
-
-	err = db.lDb.Write(db.lbatch, db.wo)
 	if err != nil {
-		fmt.Printf("batch failed %v\n", err)
-		return err
+		db.restoreHeightCache()
 	}
-	return nil
+	return err
 }
 
-func (db *LevelDb) ProcessDBlockMultiBatch(dblock *common.DirectoryBlock) error {
+func (db *KVDb) ProcessDBlockMultiBatch(dblock *common.DirectoryBlock) error {
 	if dblock == nil {
 		return nil
 	}
@@ -116,6 +69,9 @@ func (db *LevelDb) ProcessDBlockMultiBatch(dblock *common.DirectoryBlock) error
 	dbNumkey = append(dbNumkey, buf.Bytes()...)
 	db.lbatch.Put(dbNumkey, dblock.DBHash.Bytes())
 
+	// Insert the height cross reference of every block listed in the directory block
+	db.insertDBEntryHeightsMultiBatch(dblock)
+
 	// Insert the directory block merkle root cross reference
 	key = []byte{byte(TBL_DB_MR)}
 	key = append(key, dblock.KeyMR.Bytes()...)
@@ -127,7 +83,8 @@ func (db *LevelDb) ProcessDBlockMultiBatch(dblock *common.DirectoryBlock) error
 	key = append(key, common.D_CHAINID...)
 	db.lbatch.Put(key, dblock.KeyMR.Bytes())
 
-	// Update DirBlock Height cache
+	// Update DirBlock Height cache; the batch puts it back if it is not
+	// written
 	db.lastDirBlkHeight = int64(dblock.Header.DBHeight)
 	db.lastDirBlkSha, _ = wire.NewShaHash(dblock.DBHash.Bytes())
 	db.lastDirBlkShaCached = true
@@ -135,8 +92,20 @@ func (db *LevelDb) ProcessDBlockMultiBatch(dblock *common.DirectoryBlock) error
 	return nil
 }
 
+// insertDBEntryHeightsMultiBatch maps the KeyMR of every block listed in a
+// directory block to the directory block height.
+func (db *KVDb) insertDBEntryHeightsMultiBatch(dblock *common.DirectoryBlock) {
+	height := make([]byte, 4)
+	binary.BigEndian.PutUint32(height, dblock.Header.DBHeight)
+	for _, dbEntry := range dblock.DBEntries {
+		var key = []byte{byte(TBL_DB_ENTRY_HEIGHT)}
+		key = append(key, dbEntry.KeyMR.Bytes()...)
+		db.lbatch.Put(key, height)
+	}
+}
+
 // UpdateBlockHeightCache updates the dir block height cache in db
-func (db *LevelDb) UpdateBlockHeightCache(dirBlkHeigh uint32, dirBlkHash *common.Hash) error {
+func (db *KVDb) UpdateBlockHeightCache(dirBlkHeigh uint32, dirBlkHash *common.Hash) error {
 
 	// Update DirBlock Height cache
 	db.lastDirBlkHeight = int64(dirBlkHeigh)
@@ -146,12 +115,12 @@ func (db *LevelDb) UpdateBlockHeightCache(dirBlkHeigh uint32, dirBlkHash *common
 }
 
 // FetchBlockHeightCache returns the hash and block height of the most recent
-func (db *LevelDb) FetchBlockHeightCache() (sha *wire.ShaHash, height int64, err error) {
+func (db *KVDb) FetchBlockHeightCache() (sha *wire.ShaHash, height int64, err error) {
 	return db.lastDirBlkSha, db.lastDirBlkHeight, nil
 }
 
 // UpdateNextBlockHeightCache updates the next dir block height cache (from server) in db
-func (db *LevelDb) UpdateNextBlockHeightCache(dirBlkHeigh uint32) error {
+func (db *KVDb) UpdateNextBlockHeightCache(dirBlkHeigh uint32) error {
 
 	// Update DirBlock Height cache
 	db.nextDirBlockHeight = int64(dirBlkHeigh)
@@ -159,7 +128,7 @@ func (db *LevelDb) UpdateNextBlockHeightCache(dirBlkHeigh uint32) error {
 }
 
 // FetchNextBlockHeightCache returns the next block height from server
-func (db *LevelDb) FetchNextBlockHeightCache() (height int64) {
+func (db *KVDb) FetchNextBlockHeightCache() (height int64) {
 	return db.nextDirBlockHeight
 }
 
@@ -167,7 +136,7 @@ func (db *LevelDb) FetchNextBlockHeightCache() (height int64) {
 // heights.  Fetch is inclusive of the start height and exclusive of the
 // ending height. To fetch all hashes from the start height until no
 // more are present, use the special id `AllShas'.
-func (db *LevelDb) FetchHeightRange(startHeight, endHeight int64) (rshalist []wire.ShaHash, err error) {
+func (db *KVDb) FetchHeightRange(startHeight, endHeight int64) (rshalist []wire.ShaHash, err error) {
 
 	var endidx int64
 	if endHeight == database.AllShas {
@@ -178,8 +147,6 @@ func (db *LevelDb) FetchHeightRange(startHeight, endHeight int64) (rshalist []wi
 
 	shalist := make([]wire.ShaHash, 0, endidx-startHeight)
 	for height := startHeight; height < endidx; height++ {
-		// TODO(drahn) fix blkFile from height
-
 		dbhash, lerr := db.FetchDBHashByHeight(uint32(height))
 		if lerr != nil || dbhash == nil {
 			break
@@ -189,17 +156,12 @@ func (db *LevelDb) FetchHeightRange(startHeight, endHeight int64) (rshalist []wi
 		shalist = append(shalist, *sha)
 	}
 
-	if err != nil {
-		return
-	}
-	//log.Tracef("FetchIdxRange idx %v %v returned %v shas err %v", startHeight, endHeight, len(shalist), err)
-
 	return shalist, nil
 }
 
 // FetchBlockHeightBySha returns the block height for the given hash.  This is
 // part of the database.Db interface implementation.
-func (db *LevelDb) FetchBlockHeightBySha(sha *wire.ShaHash) (int64, error) {
+func (db *KVDb) FetchBlockHeightBySha(sha *wire.ShaHash) (int64, error) {
 
 	dblk, _ := db.FetchDBlockByHash(sha.ToFactomHash())
 
@@ -212,7 +174,7 @@ func (db *LevelDb) FetchBlockHeightBySha(sha *wire.ShaHash) (int64, error) {
 }
 
 // InsertDirBlockInfo inserts the Directory Block meta data into db
-func (db *LevelDb) InsertDirBlockInfo(dirBlockInfo *common.DirBlockInfo) (err error) {
+func (db *KVDb) InsertDirBlockInfo(dirBlockInfo *common.DirBlockInfo) (err error) {
 	if dirBlockInfo == nil {
 		return nil
 	}
@@ -223,7 +185,7 @@ func (db *LevelDb) InsertDirBlockInfo(dirBlockInfo *common.DirBlockInfo) (err er
 	defer db.dbLock.Unlock()
 
 	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+		db.lbatch = new(Batch)
 	}
 	defer db.lbatch.Reset()
 
@@ -232,15 +194,10 @@ func (db *LevelDb) InsertDirBlockInfo(dirBlockInfo *common.DirBlockInfo) (err er
 		return err
 	}
 
-	err = db.lDb.Write(db.lbatch, db.wo)
-	if err != nil {
-		fmt.Printf("batch failed %v\n", err)
-		return err
-	}
-	return nil
+	return db.store.Write(db.lbatch)
 }
 
-func (db *LevelDb) InsertDirBlockInfoMultiBatch(dirBlockInfo *common.DirBlockInfo) (err error) {
+func (db *KVDb) InsertDirBlockInfoMultiBatch(dirBlockInfo *common.DirBlockInfo) (err error) {
 	if dirBlockInfo == nil {
 		return nil
 	}
@@ -252,11 +209,6 @@ func (db *LevelDb) InsertDirBlockInfoMultiBatch(dirBlockInfo *common.DirBlockInf
 		return fmt.Errorf("db.lbatch == nil")
 	}
 
-	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
-	}
-	defer db.lbatch.Reset()
-
 	var key = []byte{byte(TBL_DB_INFO)} // Table Name (1 bytes)
 	key = append(key, dirBlockInfo.DBHash.Bytes()...)
 	binaryDirBlockInfo, _ := dirBlockInfo.MarshalBinary()
@@ -266,12 +218,12 @@ func (db *LevelDb) InsertDirBlockInfoMultiBatch(dirBlockInfo *common.DirBlockInf
 }
 
 // FetchDirBlockInfoByHash gets an DirBlockInfo obj
-func (db *LevelDb) FetchDirBlockInfoByHash(dbHash *common.Hash) (dirBlockInfo *common.DirBlockInfo, err error) {
+func (db *KVDb) FetchDirBlockInfoByHash(dbHash *common.Hash) (dirBlockInfo *common.DirBlockInfo, err error) {
 
 	var key = []byte{byte(TBL_DB_INFO)}
 	key = append(key, dbHash.Bytes()...)
 	db.dbLock.RLock()
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 
 	if data != nil {
@@ -286,12 +238,12 @@ func (db *LevelDb) FetchDirBlockInfoByHash(dbHash *common.Hash) (dirBlockInfo *c
 }
 
 // FetchDBlockByHash gets an entry by hash from the database.
-func (db *LevelDb) FetchDBlockByHash(dBlockHash *common.Hash) (*common.DirectoryBlock, error) {
+func (db *KVDb) FetchDBlockByHash(dBlockHash *common.Hash) (*common.DirectoryBlock, error) {
 
 	var key = []byte{byte(TBL_DB)}
 	key = append(key, dBlockHash.Bytes()...)
 	db.dbLock.RLock()
-	data, _ := db.lDb.Get(key, db.ro)
+	data, _ := db.store.Get(key)
 	db.dbLock.RUnlock()
 
 	dBlock := common.NewDBlock()
@@ -307,7 +259,7 @@ func (db *LevelDb) FetchDBlockByHash(dBlockHash *common.Hash) (*common.Directory
 }
 
 // FetchDBlockByHeight gets an directory block by height from the database.
-func (db *LevelDb) FetchDBlockByHeight(dBlockHeight uint32) (dBlock *common.DirectoryBlock, err error) {
+func (db *KVDb) FetchDBlockByHeight(dBlockHeight uint32) (dBlock *common.DirectoryBlock, err error) {
 	dBlockHash, err := db.FetchDBHashByHeight(dBlockHeight)
 	if err != nil {
 		return nil, err
@@ -323,14 +275,20 @@ func (db *LevelDb) FetchDBlockByHeight(dBlockHeight uint32) (dBlock *common.Dire
 	return dBlock, nil
 }
 
+// FetchDBlockByTime gets the directory block covering timestamp, in minutes
+// since the epoch.
+func (db *KVDb) FetchDBlockByTime(timestamp uint32) (*common.DirectoryBlock, error) {
+	return database.SearchDBlockByTime(db, timestamp)
+}
+
 // FetchDBHashByHeight gets a dBlockHash from the database.
-func (db *LevelDb) FetchDBHashByHeight(dBlockHeight uint32) (*common.Hash, error) {
+func (db *KVDb) FetchDBHashByHeight(dBlockHeight uint32) (*common.Hash, error) {
 	var key = []byte{byte(TBL_DB_NUM)}
 	var buf bytes.Buffer
 	binary.Write(&buf, binary.BigEndian, dBlockHeight)
 	key = append(key, buf.Bytes()...)
 	db.dbLock.RLock()
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
@@ -346,11 +304,11 @@ func (db *LevelDb) FetchDBHashByHeight(dBlockHeight uint32) (*common.Hash, error
 }
 
 // FetchDBHashByMR gets a DBHash by MR from the database.
-func (db *LevelDb) FetchDBHashByMR(dBMR *common.Hash) (*common.Hash, error) {
+func (db *KVDb) FetchDBHashByMR(dBMR *common.Hash) (*common.Hash, error) {
 	var key = []byte{byte(TBL_DB_MR)}
 	key = append(key, dBMR.Bytes()...)
 	db.dbLock.RLock()
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
@@ -366,7 +324,7 @@ func (db *LevelDb) FetchDBHashByMR(dBMR *common.Hash) (*common.Hash, error) {
 }
 
 // FetchDBlockByMR gets a directory block by merkle root from the database.
-func (db *LevelDb) FetchDBlockByMR(dBMR *common.Hash) (*common.DirectoryBlock, error) {
+func (db *KVDb) FetchDBlockByMR(dBMR *common.Hash) (*common.DirectoryBlock, error) {
 	dBlockHash, err := db.FetchDBHashByMR(dBMR)
 	if err != nil {
 		return nil, err
@@ -381,7 +339,7 @@ func (db *LevelDb) FetchDBlockByMR(dBMR *common.Hash) (*common.DirectoryBlock, e
 }
 
 // FetchHeadMRByChainID gets a MR of the highest block from the database.
-func (db *LevelDb) FetchHeadMRByChainID(chainID *common.Hash) (blkMR *common.Hash, err error) {
+func (db *KVDb) FetchHeadMRByChainID(chainID *common.Hash) (blkMR *common.Hash, err error) {
 	if chainID == nil {
 		return nil, nil
 	}
@@ -389,7 +347,7 @@ func (db *LevelDb) FetchHeadMRByChainID(chainID *common.Hash) (blkMR *common.Has
 	var key = []byte{byte(TBL_CHAIN_HEAD)}
 	key = append(key, chainID.Bytes()...)
 	db.dbLock.RLock()
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
@@ -405,37 +363,35 @@ func (db *LevelDb) FetchHeadMRByChainID(chainID *common.Hash) (blkMR *common.Has
 }
 
 // FetchAllDBlocks gets all of the fbInfo
-func (db *LevelDb) FetchAllDBlocks() (dBlocks []common.DirectoryBlock, err error) {
+func (db *KVDb) FetchAllDBlocks() (dBlocks []common.DirectoryBlock, err error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
 
-	var fromkey = []byte{byte(TBL_DB)}   // Table Name (1 bytes)						// Timestamp  (8 bytes)
+	var fromkey = []byte{byte(TBL_DB)}   // Table Name (1 bytes)
 	var tokey = []byte{byte(TBL_DB + 1)} // Table Name (1 bytes)
 
 	dBlockSlice := make([]common.DirectoryBlock, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
-
-	for iter.Next() {
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
 		var dBlock common.DirectoryBlock
-		_, err := dBlock.UnmarshalBinaryData(iter.Value())
+		_, err := dBlock.UnmarshalBinaryData(value)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		//TODO: to be optimized??
-		dBlock.DBHash = common.Sha(iter.Value())
+		dBlock.DBHash = common.Sha(value)
 
 		dBlockSlice = append(dBlockSlice, dBlock)
-
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err = iter.Error()
 
 	return dBlockSlice, nil
 }
 
 // FetchAllDirBlockInfo gets all of the dirBlockInfo
-func (db *LevelDb) FetchAllDirBlockInfo() (dirBlockInfoMap map[string]*common.DirBlockInfo, err error) {
+func (db *KVDb) FetchAllDirBlockInfo() (dirBlockInfoMap map[string]*common.DirBlockInfo, err error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
 
@@ -444,23 +400,23 @@ func (db *LevelDb) FetchAllDirBlockInfo() (dirBlockInfoMap map[string]*common.Di
 
 	dirBlockInfoMap = make(map[string]*common.DirBlockInfo)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
-
-	for iter.Next() {
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
 		dBInfo := new(common.DirBlockInfo)
-		_, err := dBInfo.UnmarshalBinaryData(iter.Value())
+		_, err := dBInfo.UnmarshalBinaryData(value)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		dirBlockInfoMap[dBInfo.DBMerkleRoot.String()] = dBInfo
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err = iter.Error()
-	return dirBlockInfoMap, err
+	return dirBlockInfoMap, nil
 }
 
 // FetchAllUnconfirmedDirBlockInfo gets all of the dirBlockInfos that have BTC Anchor confirmation
-func (db *LevelDb) FetchAllUnconfirmedDirBlockInfo() (dirBlockInfoMap map[string]*common.DirBlockInfo, err error) {
+func (db *KVDb) FetchAllUnconfirmedDirBlockInfo() (dirBlockInfoMap map[string]*common.DirBlockInfo, err error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
 
@@ -469,21 +425,21 @@ func (db *LevelDb) FetchAllUnconfirmedDirBlockInfo() (dirBlockInfoMap map[string
 
 	dirBlockInfoMap = make(map[string]*common.DirBlockInfo)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
-
-	for iter.Next() {
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
 		dBInfo := new(common.DirBlockInfo)
 
 		// The last byte stores the confirmation flag
-		if iter.Value()[len(iter.Value())-1] == 0 {
-			_, err := dBInfo.UnmarshalBinaryData(iter.Value())
+		if value[len(value)-1] == 0 {
+			_, err := dBInfo.UnmarshalBinaryData(value)
 			if err != nil {
-				return dirBlockInfoMap, err
+				return err
 			}
 			dirBlockInfoMap[dBInfo.DBMerkleRoot.String()] = dBInfo
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err = iter.Error()
-	return dirBlockInfoMap, err
+	return dirBlockInfoMap, nil
 }
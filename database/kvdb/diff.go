@@ -0,0 +1,332 @@
+package kvdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// DiffItem is a single difference between the databases compared by Diff.
+type DiffItem struct {
+	Table   string `json:"table"`
+	Key     string `json:"key"`     // hex, without the table prefix
+	What    string `json:"what"`    // what the key stands for, like "DBlock hash at height 1234"
+	Problem string `json:"problem"` // "missing in A", "missing in B", "differs" or "KeyMR differs"
+	A       string `json:"a,omitempty"`
+	B       string `json:"b,omitempty"`
+}
+
+func (d DiffItem) String() string {
+	s := d.What + " " + d.Problem
+	if d.A != "" || d.B != "" {
+		s += fmt.Sprintf(" (A: %v, B: %v)", d.A, d.B)
+	}
+	return s
+}
+
+// DiffReport is the machine readable result of Diff.
+type DiffReport struct {
+	A           string         `json:"a"`
+	B           string         `json:"b"`
+	Compared    map[string]int `json:"compared"` // number of distinct keys compared per table
+	Differences []DiffItem     `json:"differences"`
+}
+
+func (r *DiffReport) add(table uint8, key []byte, problem string, a []byte, b []byte) {
+	r.Differences = append(r.Differences, DiffItem{
+		Table:   tableName(table),
+		Key:     hex.EncodeToString(key),
+		What:    describeKey(table, key),
+		Problem: problem,
+		A:       describeValue(table, a),
+		B:       describeValue(table, b),
+	})
+}
+
+// Diff compares the databases dbA and dbB, named nameA and nameB in the
+// report, and reports every key that is missing from one of them or holds a
+// different value, decoded by table. Entries and entry blocks are compared
+// uncompressed, so the compression settings of the databases do not matter.
+// Directory blocks are paired by height: a height where the databases store
+// different directory blocks is reported once, as its KeyMR differing.
+func Diff(dbA, dbB *KVDb, nameA, nameB string) (*DiffReport, error) {
+	dbA.dbLock.RLock()
+	defer dbA.dbLock.RUnlock()
+	if dbB != dbA {
+		dbB.dbLock.RLock()
+		defer dbB.dbLock.RUnlock()
+	}
+
+	report := &DiffReport{A: nameA, B: nameB, Compared: make(map[string]int)}
+
+	paired, err := report.pairDBlocks(dbA, dbB)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every key of A, against the same key in B
+	err = dbA.store.Iterate(nil, nil, func(fullKey, valueA []byte) error {
+		if len(fullKey) == 0 {
+			return nil
+		}
+		table, key := fullKey[0], fullKey[1:]
+		report.Compared[tableName(table)]++
+		if paired[string(fullKey)] {
+			return nil
+		}
+
+		valueB, err := dbB.store.Get(fullKey)
+		if err == ErrNotFound {
+			report.add(table, key, "missing in B", valueA, nil)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		valueA, errA := decodeDiffValue(table, key, valueA)
+		valueB, errB := decodeDiffValue(table, key, valueB)
+		if errA != nil || errB != nil || !bytes.Equal(valueA, valueB) {
+			report.add(table, key, "differs", valueA, valueB)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The keys only B has
+	err = dbB.store.Iterate(nil, nil, func(fullKey, valueB []byte) error {
+		if len(fullKey) == 0 {
+			return nil
+		}
+		if paired[string(fullKey)] {
+			return nil
+		}
+		_, err := dbA.store.Get(fullKey)
+		if err == ErrNotFound {
+			table, key := fullKey[0], fullKey[1:]
+			report.Compared[tableName(table)]++
+			report.add(table, key, "missing in A", nil, valueB)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// pairDBlocks reports every height where dbA and dbB store different
+// directory blocks, and returns the keys, in either database, of those
+// blocks and of their height, KeyMR and DirBlockInfo cross references,
+// which are left out of the rest of the report.
+func (r *DiffReport) pairDBlocks(dbA, dbB *KVDb) (map[string]bool, error) {
+	hashesB := make(map[uint32][]byte)
+	err := dbB.forEach(TBL_DB_NUM, func(key, value []byte) error {
+		if len(key) == 4 {
+			hashesB[binary.BigEndian.Uint32(key)] = value
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	paired := make(map[string]bool)
+	err = dbA.forEach(TBL_DB_NUM, func(key, hashA []byte) error {
+		if len(key) != 4 {
+			return nil
+		}
+		hashB, ok := hashesB[binary.BigEndian.Uint32(key)]
+		if !ok || bytes.Equal(hashA, hashB) {
+			return nil
+		}
+		blockA, err := dbA.fetchStoredDBlock(hashA)
+		if err != nil {
+			return err
+		}
+		blockB, err := dbB.fetchStoredDBlock(hashB)
+		if err != nil {
+			return err
+		}
+		if blockA == nil || blockB == nil {
+			// A missing block is reported as such
+			return nil
+		}
+
+		r.Differences = append(r.Differences, DiffItem{
+			Table:   tableName(TBL_DB),
+			Key:     hex.EncodeToString(key),
+			What:    "DBlock height " + keyHeight(key),
+			Problem: "KeyMR differs",
+			A:       blockA.KeyMR.String(),
+			B:       blockB.KeyMR.String(),
+		})
+
+		paired[string(append([]byte{byte(TBL_DB_NUM)}, key...))] = true
+		for _, b := range []*common.DirectoryBlock{blockA, blockB} {
+			paired[string(append([]byte{byte(TBL_DB)}, b.DBHash.Bytes()...))] = true
+			paired[string(append([]byte{byte(TBL_DB_INFO)}, b.DBHash.Bytes()...))] = true
+			paired[string(append([]byte{byte(TBL_DB_MR)}, b.KeyMR.Bytes()...))] = true
+		}
+		return nil
+	})
+	return paired, err
+}
+
+// fetchStoredDBlock gets the directory block with hash, nil if there is
+// none. Unlike FetchDBlockByHash it takes no lock.
+func (db *KVDb) fetchStoredDBlock(hash []byte) (*common.DirectoryBlock, error) {
+	data, err := db.store.Get(append([]byte{byte(TBL_DB)}, hash...))
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	dBlock := common.NewDBlock()
+	_, err = dBlock.UnmarshalBinaryData(data)
+	if err != nil {
+		return nil, err
+	}
+	dBlock.DBHash = new(common.Hash)
+	dBlock.DBHash.SetBytes(hash)
+	err = dBlock.BuildKeyMerkleRoot()
+	if err != nil {
+		return nil, err
+	}
+	return dBlock, nil
+}
+
+func decodeDiffValue(table uint8, key []byte, value []byte) ([]byte, error) {
+	if table == TBL_ENTRY || table == TBL_EB {
+		return decodeValue(table, key, value)
+	}
+	return value, nil
+}
+
+func tableName(table uint8) string {
+	if name, ok := tableNames[table]; ok {
+		return name
+	}
+	return fmt.Sprintf("table %v", table)
+}
+
+// describeKey tells what a key of a table stands for.
+func describeKey(table uint8, key []byte) string {
+	switch table {
+	case TBL_DB:
+		return "DBlock " + hex.EncodeToString(key)
+	case TBL_DB_NUM:
+		return "DBlock hash at height " + keyHeight(key)
+	case TBL_DB_MR:
+		return "DBlock hash of KeyMR " + hex.EncodeToString(key)
+	case TBL_DB_INFO:
+		return "DirBlockInfo of DBlock " + hex.EncodeToString(key)
+	case TBL_AB:
+		return "ABlock " + hex.EncodeToString(key)
+	case TBL_AB_NUM:
+		return "ABlock hash at height " + keyHeight(key)
+	case TBL_SC:
+		return "FBlock " + hex.EncodeToString(key)
+	case TBL_SC_NUM:
+		return "FBlock hash at height " + keyHeight(key)
+	case TBL_CB:
+		return "ECBlock " + hex.EncodeToString(key)
+	case TBL_CB_NUM:
+		return "ECBlock hash at height " + keyHeight(key)
+	case TBL_CB_MR:
+		return "ECBlock hash of KeyMR " + hex.EncodeToString(key)
+	case TBL_CHAIN_HASH:
+		return "chain " + hex.EncodeToString(key)
+	case TBL_CHAIN_HEAD:
+		return "chain " + hex.EncodeToString(key) + " head"
+	case TBL_EB:
+		return "EBlock " + hex.EncodeToString(key)
+	case TBL_EB_CHAIN_NUM:
+		if len(key) == 36 {
+			return fmt.Sprintf("chain %x EBlock %v", key[:32], binary.BigEndian.Uint32(key[32:]))
+		}
+	case TBL_EB_MR:
+		return "EBlock hash of KeyMR " + hex.EncodeToString(key)
+	case TBL_ENTRY:
+		return "entry " + hex.EncodeToString(key)
+	case TBL_CHAIN_ENTRY:
+		if len(key) == 40 {
+			return fmt.Sprintf("chain %x entry %v of EBlock %v", key[:32], binary.BigEndian.Uint32(key[36:]), binary.BigEndian.Uint32(key[32:36]))
+		}
+	case TBL_ENTRY_LOCATION:
+		return "location of entry " + hex.EncodeToString(key)
+	case TBL_DB_ENTRY_HEIGHT:
+		return "DBlock height of block " + hex.EncodeToString(key)
+	case TBL_META:
+		return fmt.Sprintf("metadata %q", key)
+	case TBL_EC_BALANCE:
+		return "EC balance of " + hex.EncodeToString(key)
+	case TBL_EC_CHECKPOINT:
+		if len(key) == 4 {
+			return "EC checkpoint at height " + keyHeight(key)
+		}
+		if len(key) == 36 {
+			return fmt.Sprintf("EC balance of %x at checkpoint %v", key[4:], binary.BigEndian.Uint32(key[:4]))
+		}
+	case TBL_FCT_CHECKPOINT:
+		if len(key) == 4 {
+			return "factoid checkpoint at height " + keyHeight(key)
+		}
+		if len(key) == 36 {
+			return fmt.Sprintf("factoid balance of %x at checkpoint %v", key[4:], binary.BigEndian.Uint32(key[:4]))
+		}
+	case TBL_EXTID, TBL_CHAIN_EXTID:
+		return "external ID index key " + hex.EncodeToString(key)
+	case TBL_CHAIN_STATS:
+		return "statistics of chain " + hex.EncodeToString(key)
+	}
+	return tableName(table) + " key " + hex.EncodeToString(key)
+}
+
+// keyHeight returns the height in the last 4 bytes of a key.
+func keyHeight(key []byte) string {
+	if len(key) < 4 {
+		return hex.EncodeToString(key)
+	}
+	return fmt.Sprint(binary.BigEndian.Uint32(key[len(key)-4:]))
+}
+
+// describeValue formats the value of a key for a report. The blocks and
+// entries themselves are left out, their keys tell them apart.
+func describeValue(table uint8, value []byte) string {
+	switch table {
+	case TBL_DB, TBL_DB_INFO, TBL_AB, TBL_SC, TBL_CB, TBL_CHAIN_HASH, TBL_EB, TBL_ENTRY:
+		return ""
+	case TBL_DB_ENTRY_HEIGHT:
+		if len(value) == 4 {
+			return fmt.Sprint(binary.BigEndian.Uint32(value))
+		}
+	case TBL_EC_BALANCE, TBL_EC_CHECKPOINT:
+		balance := new(database.ECBalance)
+		if balance.UnmarshalBinary(value) == nil {
+			return fmt.Sprintf("balance %v, spent %v", balance.Balance, balance.Spent)
+		}
+	case TBL_FCT_CHECKPOINT:
+		if len(value) == 8 {
+			return fmt.Sprintf("balance %v", binary.BigEndian.Uint64(value))
+		}
+	case TBL_ENTRY_LOCATION:
+		location := new(database.EntryLocation)
+		if location.UnmarshalBinary(value) == nil {
+			return fmt.Sprintf("EBlock %v, height %v, minute %v", location.EBlockKeyMR, location.DBHeight, location.Minute)
+		}
+	case TBL_CHAIN_STATS:
+		stats := new(database.ChainStats)
+		if stats.UnmarshalBinary(value) == nil {
+			return fmt.Sprintf("%v EBlocks, %v entries, %v bytes, heights %v to %v", stats.EBlockCount, stats.EntryCount, stats.TotalBytes, stats.FirstHeight, stats.LastHeight)
+		}
+	}
+	return hex.EncodeToString(value)
+}
@@ -1,17 +1,16 @@
-package ldb
+package kvdb
 
 import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"github.com/FactomProject/FactomCode/common"
-	"github.com/FactomProject/goleveldb/leveldb"
 
-	"github.com/FactomProject/goleveldb/leveldb/util"
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
 )
 
 // ProcessEBlockBatche inserts the EBlock and update all it's ebentries in DB
-func (db *LevelDb) ProcessEBlockBatch(eblock *common.EBlock) error {
+func (db *KVDb) ProcessEBlockBatch(eblock *common.EBlock) error {
 	if eblock == nil {
 		return nil
 	}
@@ -19,7 +18,7 @@ func (db *LevelDb) ProcessEBlockBatch(eblock *common.EBlock) error {
 	defer db.dbLock.Unlock()
 
 	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+		db.lbatch = new(Batch)
 	}
 	defer db.lbatch.Reset()
 
@@ -28,15 +27,10 @@ func (db *LevelDb) ProcessEBlockBatch(eblock *common.EBlock) error {
 		return err
 	}
 
-	err = db.lDb.Write(db.lbatch, db.wo)
-	if err != nil {
-		fmt.Printf("batch failed %v\n", err)
-		return err
-	}
-	return nil
+	return db.store.Write(db.lbatch)
 }
 
-func (db *LevelDb) ProcessEBlockMultiBatch(eblock *common.EBlock) error {
+func (db *KVDb) ProcessEBlockMultiBatch(eblock *common.EBlock) error {
 	if eblock == nil {
 		return nil
 	}
@@ -56,12 +50,12 @@ func (db *LevelDb) ProcessEBlockMultiBatch(eblock *common.EBlock) error {
 
 	// Insert the binary entry block
 	var key []byte = []byte{byte(TBL_EB)}
-	hash, err := eblock.Hash()
+	eBlockHash, err := eblock.Hash()
 	if err != nil {
 		return err
 	}
-	key = append(key, hash.Bytes()...)
-	db.lbatch.Put(key, binaryEblock)
+	key = append(key, eBlockHash.Bytes()...)
+	db.lbatch.Put(key, db.encodeValue(binaryEblock))
 
 	// Insert the entry block merkle root cross reference
 	key = []byte{byte(TBL_EB_MR)}
@@ -70,10 +64,6 @@ func (db *LevelDb) ProcessEBlockMultiBatch(eblock *common.EBlock) error {
 		return err
 	}
 	key = append(key, keyMR.Bytes()...)
-	eBlockHash, err := eblock.Hash()
-	if err != nil {
-		return err
-	}
 	binaryEBHash, err := eBlockHash.MarshalBinary()
 	if err != nil {
 		return err
@@ -88,20 +78,31 @@ func (db *LevelDb) ProcessEBlockMultiBatch(eblock *common.EBlock) error {
 	key = append(key, bytes...)
 	db.lbatch.Put(key, binaryEBHash)
 
-	// Update the chain head reference
-	key = []byte{byte(TBL_CHAIN_HEAD)}
-	key = append(key, eblock.Header.ChainID.Bytes()...)
-	keyMR, err = eblock.KeyMR()
+	// Insert the chain entry cross references
+	db.insertChainEntriesMultiBatch(eblock)
+
+	// Insert the entry location cross references
+	err = db.insertEntryLocationsMultiBatch(eblock)
+	if err != nil {
+		return err
+	}
+
+	// Update the chain statistics
+	err = db.updateChainStatsMultiBatch(eblock)
 	if err != nil {
 		return err
 	}
+
+	// Update the chain head reference
+	key = []byte{byte(TBL_CHAIN_HEAD)}
+	key = append(key, eblock.Header.ChainID.Bytes()...)
 	db.lbatch.Put(key, keyMR.Bytes())
 
 	return nil
 }
 
 // FetchEBlockByMR gets an entry block by merkle root from the database.
-func (db *LevelDb) FetchEBlockByMR(eBMR *common.Hash) (eBlock *common.EBlock, err error) {
+func (db *KVDb) FetchEBlockByMR(eBMR *common.Hash) (eBlock *common.EBlock, err error) {
 	eBlockHash, err := db.FetchEBHashByMR(eBMR)
 	if err != nil {
 		return nil, err
@@ -109,68 +110,56 @@ func (db *LevelDb) FetchEBlockByMR(eBMR *common.Hash) (eBlock *common.EBlock, er
 
 	if eBlockHash != nil {
 		eBlock, err = db.FetchEBlockByHash(eBlockHash)
-		if err != nil {
+		if err != nil && err != database.ErrPruned {
 			return nil, err
 		}
 	}
 
-	return eBlock, nil
+	return eBlock, err
 }
 
 // FetchEntryBlock gets an entry by hash from the database.
-func (db *LevelDb) FetchEBlockByHash(eBlockHash *common.Hash) (*common.EBlock, error) {
-	var key []byte = []byte{byte(TBL_EB)}
-	key = append(key, eBlockHash.Bytes()...)
+func (db *KVDb) FetchEBlockByHash(eBlockHash *common.Hash) (*common.EBlock, error) {
 	db.dbLock.RLock()
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.getValue(TBL_EB, eBlockHash.Bytes())
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
 	}
 
-	eBlock := common.NewEBlock()
-	if data != nil {
-		_, err := eBlock.UnmarshalBinaryData(data)
-		if err != nil {
-			return nil, err
-		}
-	}
-	return eBlock, nil
+	return database.UnmarshalStoredEBlock(data)
 }
 
-// FetchEBlockByHeight gets an entry block by height from the database.
-// Need to rewrite since only the cross ref is stored in db ??
-/*func (db *LevelDb) FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint32) (*common.EBlock, error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
+// FetchEBlockByHeight gets the entry block of a chain by its sequence number
+// from the database.
+func (db *KVDb) FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint32) (*common.EBlock, error) {
 	var key []byte = []byte{byte(TBL_EB_CHAIN_NUM)}
-	key = append(key, chainID.Bytes...)
-	bytes := make([]byte, 4)
-	binary.BigEndian.PutUint32(bytes, eBlockHeight)
-	key = append(key, bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	key = append(key, chainID.Bytes()...)
+	num := make([]byte, 4)
+	binary.BigEndian.PutUint32(num, eBlockHeight)
+	key = append(key, num...)
+	db.dbLock.RLock()
+	data, err := db.store.Get(key)
+	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
 	}
 
-	eBlock := common.NewEBlock()
-	if data != nil {
-		_, err:=eBlock.UnmarshalBinaryData(data)
-		if err!=nil {
-			return nil, err
-		}
+	eBlockHash := common.NewHash()
+	_, err = eBlockHash.UnmarshalBinaryData(data)
+	if err != nil {
+		return nil, err
 	}
-	return eBlock, nil
+
+	return db.FetchEBlockByHash(eBlockHash)
 }
-*/
 
 // FetchEBHashByMR gets an entry by hash from the database.
-func (db *LevelDb) FetchEBHashByMR(eBMR *common.Hash) (*common.Hash, error) {
+func (db *KVDb) FetchEBHashByMR(eBMR *common.Hash) (*common.Hash, error) {
 	var key []byte = []byte{byte(TBL_EB_MR)}
 	key = append(key, eBMR.Bytes()...)
 	db.dbLock.RLock()
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
@@ -186,7 +175,7 @@ func (db *LevelDb) FetchEBHashByMR(eBMR *common.Hash) (*common.Hash, error) {
 }
 
 // InsertChain inserts the newly created chain into db
-func (db *LevelDb) InsertChain(chain *common.EChain) error {
+func (db *KVDb) InsertChain(chain *common.EChain) error {
 	if chain == nil {
 		return nil
 	}
@@ -194,7 +183,7 @@ func (db *LevelDb) InsertChain(chain *common.EChain) error {
 	defer db.dbLock.Unlock()
 
 	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+		db.lbatch = new(Batch)
 	}
 	defer db.lbatch.Reset()
 
@@ -203,15 +192,10 @@ func (db *LevelDb) InsertChain(chain *common.EChain) error {
 		return err
 	}
 
-	err = db.lDb.Write(db.lbatch, db.wo)
-	if err != nil {
-		fmt.Printf("batch failed %v\n", err)
-		return err
-	}
-	return nil
+	return db.store.Write(db.lbatch)
 }
 
-func (db *LevelDb) InsertChainMultiBatch(chain *common.EChain) error {
+func (db *KVDb) InsertChainMultiBatch(chain *common.EChain) error {
 	if chain == nil {
 		return nil
 	}
@@ -234,11 +218,11 @@ func (db *LevelDb) InsertChainMultiBatch(chain *common.EChain) error {
 }
 
 // FetchChainByHash gets a chain by chainID
-func (db *LevelDb) FetchChainByHash(chainID *common.Hash) (*common.EChain, error) {
+func (db *KVDb) FetchChainByHash(chainID *common.Hash) (*common.EChain, error) {
 	var key []byte = []byte{byte(TBL_CHAIN_HASH)}
 	key = append(key, chainID.Bytes()...)
 	db.dbLock.RLock()
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
@@ -255,7 +239,7 @@ func (db *LevelDb) FetchChainByHash(chainID *common.Hash) (*common.EChain, error
 }
 
 // FetchAllChains get all of the cahins
-func (db *LevelDb) FetchAllChains() (chains []*common.EChain, err error) {
+func (db *KVDb) FetchAllChains() (chains []*common.EChain, err error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
 
@@ -264,23 +248,24 @@ func (db *LevelDb) FetchAllChains() (chains []*common.EChain, err error) {
 
 	chainSlice := make([]*common.EChain, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
-	for iter.Next() {
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
 		chain := common.NewEChain()
-		_, err := chain.UnmarshalBinaryData(iter.Value())
+		_, err := chain.UnmarshalBinaryData(value)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		chainSlice = append(chainSlice, chain)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err = iter.Error()
 
-	return chainSlice, err
+	return chainSlice, nil
 }
 
 // FetchAllEBlocksByChain gets all of the blocks by chain id
-func (db *LevelDb) FetchAllEBlocksByChain(chainID *common.Hash) (eBlocks *[]common.EBlock, err error) {
+func (db *KVDb) FetchAllEBlocksByChain(chainID *common.Hash) (eBlocks *[]common.EBlock, err error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
 
@@ -290,49 +275,29 @@ func (db *LevelDb) FetchAllEBlocksByChain(chainID *common.Hash) (eBlocks *[]comm
 
 	eBlockSlice := make([]common.EBlock, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
-
-	for iter.Next() {
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
 		eBlockHash := common.NewHash()
-		_, err := eBlockHash.UnmarshalBinaryData(iter.Value())
+		_, err := eBlockHash.UnmarshalBinaryData(value)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		var key []byte = []byte{byte(TBL_EB)}
-		key = append(key, eBlockHash.Bytes()...)
-		data, err := db.lDb.Get(key, db.ro)
+		data, err := db.getValue(TBL_EB, eBlockHash.Bytes())
 		if err != nil {
-			return nil, err
+			return err
 		}
 
-		eBlock := common.NewEBlock()
-		if data != nil {
-			_, err := eBlock.UnmarshalBinaryData(data)
-			if err != nil {
-				return nil, err
-			}
-			eBlockSlice = append(eBlockSlice, *eBlock)
+		// Pruned blocks are listed with their header only
+		eBlock, err := database.UnmarshalStoredEBlock(data)
+		if err != nil && err != database.ErrPruned {
+			return err
 		}
+		eBlockSlice = append(eBlockSlice, *eBlock)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err = iter.Error()
 
 	return &eBlockSlice, nil
 }
-
-// Internal db use only
-func addOneToByteArray(input []byte) (output []byte) {
-	if input == nil {
-		return []byte{byte(1)}
-	}
-	output = make([]byte, len(input))
-	copy(output, input)
-	for i := len(input); i > 0; i-- {
-		if output[i-1] <= 255 {
-			output[i-1] = output[i-1] + 1
-			break
-		}
-	}
-	return output
-}
@@ -0,0 +1,457 @@
+package kvdb
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// FetchECBalance gets the entry credit balance of a public key as of the
+// last processed ECBlock. Unknown keys have a zero balance.
+func (db *KVDb) FetchECBalance(pubKey *[32]byte) (*database.ECBalance, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	return db.fetchECBalance(pubKey)
+}
+
+func (db *KVDb) fetchECBalance(pubKey *[32]byte) (*database.ECBalance, error) {
+	var key = []byte{byte(TBL_EC_BALANCE)}
+	key = append(key, pubKey[:]...)
+	data, err := db.store.Get(key)
+	if err == ErrNotFound {
+		return new(database.ECBalance), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	balance := new(database.ECBalance)
+	err = balance.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return balance, nil
+}
+
+// IterateECBalances calls fn with every stored entry credit balance. The
+// balances are read first, so fn is free to use the database.
+func (db *KVDb) IterateECBalances(fn func(pubKey *[32]byte, balance *database.ECBalance) error) error {
+	var pubKeys []*[32]byte
+	var balances []*database.ECBalance
+
+	db.dbLock.RLock()
+	err := db.forEach(TBL_EC_BALANCE, func(key, value []byte) error {
+		pubKey := new([32]byte)
+		copy(pubKey[:], key)
+		balance := new(database.ECBalance)
+		err := balance.UnmarshalBinary(value)
+		if err != nil {
+			return err
+		}
+		pubKeys = append(pubKeys, pubKey)
+		balances = append(balances, balance)
+		return nil
+	})
+	db.dbLock.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	for i := range pubKeys {
+		err = fn(pubKeys[i], balances[i])
+		if err == database.ErrStopIteration {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateECBalancesMultiBatch applies balance changes to the stored balances,
+// or takes them back with undo set, and returns the new balances. The
+// balances are read from the store, not from the batch, so a batch must not
+// change the balances more than once.
+func (db *KVDb) updateECBalancesMultiBatch(changes map[[32]byte]*database.ECBalance, undo bool) (map[[32]byte]*database.ECBalance, error) {
+	balances := make(map[[32]byte]*database.ECBalance)
+	for pubKey, change := range changes {
+		pubKey := pubKey
+		balance, err := db.fetchECBalance(&pubKey)
+		if err != nil {
+			return nil, err
+		}
+		if undo {
+			balance.Sub(change)
+		} else {
+			balance.Add(change)
+		}
+
+		var key = []byte{byte(TBL_EC_BALANCE)}
+		key = append(key, pubKey[:]...)
+		binaryBalance, _ := balance.MarshalBinary()
+		db.lbatch.Put(key, binaryBalance)
+		balances[pubKey] = balance
+	}
+	return balances, nil
+}
+
+// rebuildECBalancesMultiBatch queues a chunk of the entry credit balances
+// replayed from the entry credit blocks in the database: the old balances
+// are deleted first, then each block adds its changes to the stored ones.
+func (db *KVDb) rebuildECBalancesMultiBatch(cursor []byte) ([]byte, error) {
+	// The balances changed in this chunk, which the store does not hold yet
+	balances := make(map[[32]byte]*database.ECBalance)
+
+	return db.migrateTables(cursor, []uint8{TBL_EC_BALANCE, TBL_CB_NUM}, func(table uint8, key, value []byte) error {
+		if table == TBL_EC_BALANCE {
+			db.lbatch.Delete(append([]byte{byte(TBL_EC_BALANCE)}, key...))
+			return nil
+		}
+
+		ecBlock, err := db.fetchMigrationECBlock(key, value)
+		if ecBlock == nil || err != nil {
+			return err
+		}
+		changes, err := database.ECBalanceChanges(ecBlock)
+		if err != nil {
+			return err
+		}
+		for pubKey, change := range changes {
+			pubKey := pubKey
+			balance, ok := balances[pubKey]
+			if !ok {
+				balance, err = db.fetchECBalance(&pubKey)
+				if err != nil {
+					return err
+				}
+				balances[pubKey] = balance
+			}
+			balance.Add(change)
+
+			var key = []byte{byte(TBL_EC_BALANCE)}
+			key = append(key, pubKey[:]...)
+			binaryBalance, _ := balance.MarshalBinary()
+			db.lbatch.Put(key, binaryBalance)
+		}
+		return nil
+	})
+}
+
+// fetchMigrationECBlock gets the ECBlock of a TBL_CB_NUM record, nil for a
+// record of another chain.
+func (db *KVDb) fetchMigrationECBlock(key, value []byte) (*common.ECBlock, error) {
+	if len(key) != len(common.EC_CHAINID)+4 || !bytes.HasPrefix(key, common.EC_CHAINID) {
+		return nil, nil
+	}
+	data, err := db.store.Get(append([]byte{byte(TBL_CB)}, value...))
+	if err != nil {
+		return nil, err
+	}
+	ecBlock := common.NewECBlock()
+	_, err = ecBlock.UnmarshalBinaryData(data)
+	if err != nil {
+		return nil, err
+	}
+	return ecBlock, nil
+}
+
+// ecBalanceChangesAbove sums the balance changes of the ECBlocks above height.
+func (db *KVDb) ecBalanceChangesAbove(height int64) (map[[32]byte]*database.ECBalance, error) {
+	var ecBlockHashes [][]byte
+	err := db.forEach(TBL_CB_NUM, func(key, value []byte) error {
+		if len(key) != len(common.EC_CHAINID)+4 || !bytes.HasPrefix(key, common.EC_CHAINID) {
+			return nil
+		}
+		if int64(binary.BigEndian.Uint32(key[len(common.EC_CHAINID):])) <= height {
+			return nil
+		}
+		ecBlockHashes = append(ecBlockHashes, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sum := make(map[[32]byte]*database.ECBalance)
+	for _, hash := range ecBlockHashes {
+		data, err := db.store.Get(append([]byte{byte(TBL_CB)}, hash...))
+		if err != nil {
+			return nil, err
+		}
+		ecBlock := common.NewECBlock()
+		_, err = ecBlock.UnmarshalBinaryData(data)
+		if err != nil {
+			return nil, err
+		}
+		changes, err := database.ECBalanceChanges(ecBlock)
+		if err != nil {
+			return nil, err
+		}
+		for pubKey, change := range changes {
+			if sum[pubKey] == nil {
+				sum[pubKey] = new(database.ECBalance)
+			}
+			sum[pubKey].Add(change)
+		}
+	}
+	return sum, nil
+}
+
+// processECBalancesMultiBatch queues the balance changes of a new ECBlock and,
+// at a checkpoint height, a snapshot of all balances after it.
+func (db *KVDb) processECBalancesMultiBatch(block *common.ECBlock) error {
+	changes, err := database.ECBalanceChanges(block)
+	if err != nil {
+		return err
+	}
+	balances, err := db.updateECBalancesMultiBatch(changes, false)
+	if err != nil {
+		return err
+	}
+	if block.Header.EBHeight%database.ECCheckpointInterval != 0 {
+		return nil
+	}
+
+	// The balances the block does not change are copied as they are
+	n := 0
+	err = db.forEach(TBL_EC_BALANCE, func(key, value []byte) error {
+		pubKey := new([32]byte)
+		copy(pubKey[:], key)
+		if _, ok := balances[*pubKey]; !ok {
+			db.lbatch.Put(ecCheckpointKey(block.Header.EBHeight, pubKey), value)
+			n++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for pubKey, balance := range balances {
+		pubKey := pubKey
+		binaryBalance, _ := balance.MarshalBinary()
+		db.lbatch.Put(ecCheckpointKey(block.Header.EBHeight, &pubKey), binaryBalance)
+		n++
+	}
+	db.lbatch.Put(ecCheckpointKey(block.Header.EBHeight, nil), checkpointCount(n))
+	return nil
+}
+
+// FetchECBalanceAtHeight gets the entry credit balance of a public key as of
+// the ECBlock at a directory block height. The ECBlocks after the nearest
+// checkpoint at or below height are replayed.
+func (db *KVDb) FetchECBalanceAtHeight(pubKey *[32]byte, height uint32) (*database.ECBalance, error) {
+	balance, next, err := db.fetchECCheckpoint(pubKey, height)
+	if err != nil {
+		return nil, err
+	}
+
+	for h := next; h <= height; h++ {
+		ecBlock, err := db.FetchECBlockByHeight(h)
+		if err != nil {
+			return nil, err
+		}
+		changes, err := database.ECBalanceChanges(ecBlock)
+		if err != nil {
+			return nil, err
+		}
+		if change, ok := changes[*pubKey]; ok {
+			balance.Add(change)
+		}
+	}
+	return balance, nil
+}
+
+// fetchECCheckpoint gets the balance of a public key at the highest
+// checkpoint at or below height, and the height of the first ECBlock after
+// it. Without one the balance starts at zero before the first ECBlock.
+func (db *KVDb) fetchECCheckpoint(pubKey *[32]byte, height uint32) (balance *database.ECBalance, next uint32, err error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	for cp := int64(height - height%database.ECCheckpointInterval); cp >= 0; cp -= database.ECCheckpointInterval {
+		_, err = db.store.Get(ecCheckpointKey(uint32(cp), nil))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		balance = new(database.ECBalance)
+		data, err := db.store.Get(ecCheckpointKey(uint32(cp), pubKey))
+		if err == ErrNotFound {
+			return balance, uint32(cp) + 1, nil
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		err = balance.UnmarshalBinary(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		return balance, uint32(cp) + 1, nil
+	}
+	return new(database.ECBalance), 0, nil
+}
+
+// ecCheckpointKey returns the key of a balance in the checkpoint at height,
+// or of the checkpoint itself if pubKey is nil.
+func ecCheckpointKey(height uint32, pubKey *[32]byte) []byte {
+	key := make([]byte, 5, 37)
+	key[0] = byte(TBL_EC_CHECKPOINT)
+	binary.BigEndian.PutUint32(key[1:], height)
+	if pubKey != nil {
+		key = append(key, pubKey[:]...)
+	}
+	return key
+}
+
+// checkpointCount is the value of a checkpoint record, the number of
+// balances in it.
+func checkpointCount(n int) []byte {
+	count := make([]byte, 4)
+	binary.BigEndian.PutUint32(count, uint32(n))
+	return count
+}
+
+// rebuildECCheckpointsMultiBatch queues a chunk of the entry credit
+// balance checkpoints replayed from the entry credit blocks in the
+// database: the old checkpoints are deleted first, then the blocks are
+// replayed from the lowest height. Only a checkpoint writes anything, so a
+// chunk of the blocks always ends after one, and the next chunk picks the
+// balances up from it.
+func (db *KVDb) rebuildECCheckpointsMultiBatch(cursor []byte) ([]byte, error) {
+	var balances map[[32]byte]*database.ECBalance
+
+	return db.migrateTables(cursor, []uint8{TBL_EC_CHECKPOINT, TBL_CB_NUM}, func(table uint8, key, value []byte) error {
+		if table == TBL_EC_CHECKPOINT {
+			db.lbatch.Delete(append([]byte{byte(TBL_EC_CHECKPOINT)}, key...))
+			return nil
+		}
+
+		ecBlock, err := db.fetchMigrationECBlock(key, value)
+		if ecBlock == nil || err != nil {
+			return err
+		}
+		height := binary.BigEndian.Uint32(key[len(common.EC_CHAINID):])
+		if balances == nil {
+			balances, err = db.fetchECCheckpointBelow(height)
+			if err != nil {
+				return err
+			}
+		}
+
+		changes, err := database.ECBalanceChanges(ecBlock)
+		if err != nil {
+			return err
+		}
+		for pubKey, change := range changes {
+			if balances[pubKey] == nil {
+				balances[pubKey] = new(database.ECBalance)
+			}
+			balances[pubKey].Add(change)
+		}
+
+		if height%database.ECCheckpointInterval != 0 {
+			return nil
+		}
+		for pubKey, balance := range balances {
+			pubKey := pubKey
+			binaryBalance, _ := balance.MarshalBinary()
+			db.lbatch.Put(ecCheckpointKey(height, &pubKey), binaryBalance)
+		}
+		db.lbatch.Put(ecCheckpointKey(height, nil), checkpointCount(len(balances)))
+		return nil
+	})
+}
+
+// fetchECCheckpointBelow gets all of the balances of the highest checkpoint
+// below height, or none without one.
+func (db *KVDb) fetchECCheckpointBelow(height uint32) (map[[32]byte]*database.ECBalance, error) {
+	balances := make(map[[32]byte]*database.ECBalance)
+	if height == 0 {
+		return balances, nil
+	}
+
+	for cp := int64(height-1) - int64(height-1)%database.ECCheckpointInterval; cp >= 0; cp -= database.ECCheckpointInterval {
+		_, err := db.store.Get(ecCheckpointKey(uint32(cp), nil))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		prefix := ecCheckpointKey(uint32(cp), nil)
+		err = db.store.Iterate(append(prefix, 0), prefixLimit(prefix), func(key, value []byte) error {
+			balance := new(database.ECBalance)
+			err := balance.UnmarshalBinary(value)
+			if err != nil {
+				return err
+			}
+			var pubKey [32]byte
+			copy(pubKey[:], key[len(prefix):])
+			balances[pubKey] = balance
+			return nil
+		})
+		return balances, err
+	}
+	return balances, nil
+}
+
+// ecCheckpoints returns the TBL_EC_CHECKPOINT records, without the table
+// prefix, replayed from the entry credit blocks in the database.
+func (db *KVDb) ecCheckpoints() (map[string][]byte, error) {
+	var heights []uint32
+	var ecBlockHashes [][]byte
+	err := db.forEach(TBL_CB_NUM, func(key, value []byte) error {
+		if len(key) != len(common.EC_CHAINID)+4 || !bytes.HasPrefix(key, common.EC_CHAINID) {
+			return nil
+		}
+		heights = append(heights, binary.BigEndian.Uint32(key[len(common.EC_CHAINID):]))
+		ecBlockHashes = append(ecBlockHashes, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := make(map[string][]byte)
+	balances := make(map[[32]byte]*database.ECBalance)
+	for i, hash := range ecBlockHashes {
+		data, err := db.store.Get(append([]byte{byte(TBL_CB)}, hash...))
+		if err != nil {
+			return nil, err
+		}
+		ecBlock := common.NewECBlock()
+		_, err = ecBlock.UnmarshalBinaryData(data)
+		if err != nil {
+			return nil, err
+		}
+		changes, err := database.ECBalanceChanges(ecBlock)
+		if err != nil {
+			return nil, err
+		}
+		for pubKey, change := range changes {
+			if balances[pubKey] == nil {
+				balances[pubKey] = new(database.ECBalance)
+			}
+			balances[pubKey].Add(change)
+		}
+
+		if heights[i]%database.ECCheckpointInterval != 0 {
+			continue
+		}
+		for pubKey, balance := range balances {
+			pubKey := pubKey
+			binaryBalance, _ := balance.MarshalBinary()
+			checkpoints[string(ecCheckpointKey(heights[i], &pubKey)[1:])] = binaryBalance
+		}
+		checkpoints[string(ecCheckpointKey(heights[i], nil)[1:])] = checkpointCount(len(balances))
+	}
+	return checkpoints, nil
+}
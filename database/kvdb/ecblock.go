@@ -1,4 +1,4 @@
-package ldb
+package kvdb
 
 import (
 	"bytes"
@@ -6,13 +6,10 @@ import (
 	"fmt"
 
 	"github.com/FactomProject/FactomCode/common"
-	"github.com/FactomProject/goleveldb/leveldb"
-	"github.com/FactomProject/goleveldb/leveldb/iterator"
-	"github.com/FactomProject/goleveldb/leveldb/util"
 )
 
 // ProcessECBlockBatch inserts the ECBlock and update all it's cbentries in DB
-func (db *LevelDb) ProcessECBlockBatch(block *common.ECBlock) error {
+func (db *KVDb) ProcessECBlockBatch(block *common.ECBlock) error {
 	if block == nil {
 		return nil
 	}
@@ -20,7 +17,7 @@ func (db *LevelDb) ProcessECBlockBatch(block *common.ECBlock) error {
 	defer db.dbLock.Unlock()
 
 	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+		db.lbatch = new(Batch)
 	}
 	defer db.lbatch.Reset()
 
@@ -29,15 +26,10 @@ func (db *LevelDb) ProcessECBlockBatch(block *common.ECBlock) error {
 		return err
 	}
 
-	err = db.lDb.Write(db.lbatch, db.wo)
-	if err != nil {
-		fmt.Printf("batch failed %v\n", err)
-		return err
-	}
-	return nil
+	return db.store.Write(db.lbatch)
 }
 
-func (db *LevelDb) ProcessECBlockMultiBatch(block *common.ECBlock) error {
+func (db *KVDb) ProcessECBlockMultiBatch(block *common.ECBlock) error {
 	if block == nil {
 		return nil
 	}
@@ -58,6 +50,16 @@ func (db *LevelDb) ProcessECBlockMultiBatch(block *common.ECBlock) error {
 		return err
 	}
 	key = append(key, hash.Bytes()...)
+
+	// Update the entry credit balances, unless the block is stored already
+	_, err = db.store.Get(key)
+	if err == ErrNotFound {
+		err = db.processECBalancesMultiBatch(block)
+	}
+	if err != nil {
+		return err
+	}
+
 	db.lbatch.Put(key, binaryBlock)
 
 	// Insert block height cross reference
@@ -67,56 +69,44 @@ func (db *LevelDb) ProcessECBlockMultiBatch(block *common.ECBlock) error {
 	binary.Write(&buf, binary.BigEndian, block.Header.EBHeight)
 	dbNumkey = append(dbNumkey, buf.Bytes()...)
 	db.lbatch.Put(dbNumkey, hash.Bytes())
-	//fmt.Println("ProcessECBlockBatch: key=", hex.EncodeToString(dbNumkey), ", hash=", hash)
 
 	// Update the chain head reference
 	key = []byte{byte(TBL_CHAIN_HEAD)}
 	key = append(key, common.EC_CHAINID...)
-	//hash, err = block.HeaderHash()
-	//if err != nil {
-	//return err
-	//}
 	db.lbatch.Put(key, hash.Bytes())
 
 	return nil
 }
 
 // FetchECBlockByHash gets an Entry Credit block by hash from the database.
-func (db *LevelDb) FetchECBlockByHash(ecBlockHash *common.Hash) (ecBlock *common.ECBlock, err error) {
+func (db *KVDb) FetchECBlockByHash(ecBlockHash *common.Hash) (ecBlock *common.ECBlock, err error) {
 	var key = []byte{byte(TBL_CB)}
 	key = append(key, ecBlockHash.Bytes()...)
-	var data []byte
 	db.dbLock.RLock()
-	data, err = db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
 	}
-	//fmt.Println("FetchECBlockByHash: key=", hex.EncodeToString(key), ", data=", string(data))
 
-	if data != nil {
-		ecBlock = common.NewECBlock()
-		_, err := ecBlock.UnmarshalBinaryData(data)
-		if err != nil {
-			return nil, err
-		}
+	ecBlock = common.NewECBlock()
+	_, err = ecBlock.UnmarshalBinaryData(data)
+	if err != nil {
+		return nil, err
 	}
-	//fmt.Println("FetchECBlockByHash: ecBlock=", spew.Sdump(ecBlock))
 	return ecBlock, nil
 }
 
 // FetchECBlockByHeight gets an Entry Credit block by hash from the database.
-func (db *LevelDb) FetchECBlockByHeight(height uint32) (ecBlock *common.ECBlock, err error) {
+func (db *KVDb) FetchECBlockByHeight(height uint32) (ecBlock *common.ECBlock, err error) {
 	var key = []byte{byte(TBL_CB_NUM)}
 	var buf bytes.Buffer
 	binary.Write(&buf, binary.BigEndian, height)
 	key = append(key, common.EC_CHAINID...)
 	key = append(key, buf.Bytes()...)
-	//fmt.Println("FetchECBlockByHeight: key=", hex.EncodeToString(key))
 
-	var data []byte
 	db.dbLock.RLock()
-	data, err = db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
@@ -127,31 +117,30 @@ func (db *LevelDb) FetchECBlockByHeight(height uint32) (ecBlock *common.ECBlock,
 	if err != nil {
 		return nil, err
 	}
-	//fmt.Println("FetchECBlockByHeight: data=", hex.EncodeToString(data), ", hash=", ecBlockHash)
 	return db.FetchECBlockByHash(ecBlockHash)
 }
 
 // FetchAllECBlocks gets all of the entry credit blocks
-func (db *LevelDb) FetchAllECBlocks() (ecBlocks []common.ECBlock, err error) {
+func (db *KVDb) FetchAllECBlocks() (ecBlocks []common.ECBlock, err error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
 
-	var fromkey = []byte{byte(TBL_CB)}   // Table Name (1 bytes)						// Timestamp  (8 bytes)
+	var fromkey = []byte{byte(TBL_CB)}   // Table Name (1 bytes)
 	var tokey = []byte{byte(TBL_CB + 1)} // Table Name (1 bytes)
 	ecBlockSlice := make([]common.ECBlock, 0, 10)
-	var iter iterator.Iterator
-	iter = db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
 
-	for iter.Next() {
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
 		ecBlock := common.NewECBlock()
-		_, err := ecBlock.UnmarshalBinaryData(iter.Value())
+		_, err := ecBlock.UnmarshalBinaryData(value)
 		if err != nil {
-			return nil, err
+			return err
 		}
 		ecBlockSlice = append(ecBlockSlice, *ecBlock)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err = iter.Error()
 
 	return ecBlockSlice, nil
 }
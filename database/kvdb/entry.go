@@ -0,0 +1,276 @@
+package kvdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// InsertEntry inserts an entry
+func (db *KVDb) InsertEntry(entry *common.Entry) error {
+	if entry == nil {
+		return nil
+	}
+
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	if db.lbatch == nil {
+		db.lbatch = new(Batch)
+	}
+	defer db.lbatch.Reset()
+
+	err := db.InsertEntryMultiBatch(entry)
+	if err != nil {
+		return err
+	}
+
+	return db.store.Write(db.lbatch)
+}
+
+func (db *KVDb) InsertEntryMultiBatch(entry *common.Entry) error {
+	if entry == nil {
+		return nil
+	}
+
+	if db.lbatch == nil {
+		return fmt.Errorf("db.lbatch == nil")
+	}
+
+	binaryEntry, err := entry.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	var entryKey []byte = []byte{byte(TBL_ENTRY)}
+	entryKey = append(entryKey, entry.Hash().Bytes()...)
+	db.lbatch.Put(entryKey, db.encodeValue(binaryEntry))
+
+	db.indexExtIDsMultiBatch(entry)
+
+	if db.batchEntries != nil {
+		db.batchEntries[*entry.Hash()] = entry
+	}
+
+	return nil
+}
+
+// FetchEntry gets an entry by hash from the database.
+func (db *KVDb) FetchEntryByHash(entrySha *common.Hash) (entry *common.Entry, err error) {
+	db.dbLock.RLock()
+	data, err := db.getValue(TBL_ENTRY, entrySha.Bytes())
+	if err == ErrNotFound {
+		err = db.prunedEntryError(entrySha)
+	}
+	db.dbLock.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if data != nil {
+		entry = new(common.Entry)
+		_, err := entry.UnmarshalBinaryData(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// chainEntryKey returns the TBL_CHAIN_ENTRY key of the entry at position pos
+// in the entry block with sequence number seq of the chain.
+func chainEntryKey(chainID *common.Hash, seq uint32, pos uint32) []byte {
+	var key []byte = []byte{byte(TBL_CHAIN_ENTRY)}
+	key = append(key, chainID.Bytes()...)
+	bytes := make([]byte, 8)
+	binary.BigEndian.PutUint32(bytes[:4], seq)
+	binary.BigEndian.PutUint32(bytes[4:], pos)
+	return append(key, bytes...)
+}
+
+// insertChainEntriesMultiBatch indexes the entries of an entry block by
+// chain. Minute markers are skipped.
+func (db *KVDb) insertChainEntriesMultiBatch(eblock *common.EBlock) {
+	for i, ebEntry := range eblock.Body.EBEntries {
+		if ebEntry.IsMinuteMarker() {
+			continue
+		}
+		key := chainEntryKey(eblock.Header.ChainID, eblock.Header.EBSequence, uint32(i))
+		db.lbatch.Put(key, ebEntry.Bytes())
+	}
+}
+
+// errPageFull stops the iteration of a paged fetch once the page is full.
+var errPageFull = errors.New("page full")
+
+// FetchEntriesByChain gets up to limit entries of a chain starting at cursor.
+// The cursor is the entry block sequence in the high 32 bits and the position
+// in the entry block in the low 32 bits; a limit < 1 means no limit.
+func (db *KVDb) FetchEntriesByChain(chainID *common.Hash, cursor uint64, limit int) (entries []*common.Entry, next uint64, err error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	var prefix []byte = []byte{byte(TBL_CHAIN_ENTRY)} // Table Name (1 bytes)
+	prefix = append(prefix, chainID.Bytes()...)       // Chain ID (32 bytes)
+	var fromkey []byte = make([]byte, len(prefix)+8)
+	copy(fromkey, prefix)
+	binary.BigEndian.PutUint64(fromkey[len(prefix):], cursor) // Sequence and position (8 bytes)
+	var tokey []byte = addOneToByteArray(prefix)
+
+	entries = make([]*common.Entry, 0, 10)
+
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
+		if limit > 0 && len(entries) == limit {
+			next = binary.BigEndian.Uint64(key[len(prefix):])
+			return errPageFull
+		}
+
+		data, err := db.getValue(TBL_ENTRY, value)
+		if err == ErrNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		entry := new(common.Entry)
+		_, err = entry.UnmarshalBinaryData(data)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, 0, err
+	}
+
+	return entries, next, nil
+}
+
+// ReindexEntriesByChain rebuilds the chain entry index from all of the
+// entry blocks in the database, written in chunks.
+func (db *KVDb) ReindexEntriesByChain() error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	db.lbatch = new(Batch)
+	defer func() {
+		db.lbatch = nil
+	}()
+
+	var cursor []byte
+	for {
+		db.lbatch.Reset()
+		next, err := db.reindexEntriesByChainMultiBatch(cursor)
+		if err != nil {
+			return err
+		}
+		err = db.store.Write(db.lbatch)
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// reindexEntriesByChainMultiBatch queues the chain entry index of a chunk
+// of the entry blocks in the database.
+func (db *KVDb) reindexEntriesByChainMultiBatch(cursor []byte) ([]byte, error) {
+	return db.migrateTables(cursor, []uint8{TBL_EB}, func(table uint8, key, value []byte) error {
+		eBlock, err := database.UnmarshalStoredEBlock(value)
+		if err == database.ErrPruned {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		db.insertChainEntriesMultiBatch(eBlock)
+		return nil
+	})
+}
+
+// reindexEntryLocationsMultiBatch queues the entry location index of a
+// chunk of the entry blocks, then the block heights of the directory blocks
+// in the database.
+func (db *KVDb) reindexEntryLocationsMultiBatch(cursor []byte) ([]byte, error) {
+	return db.migrateTables(cursor, []uint8{TBL_EB, TBL_DB}, func(table uint8, key, value []byte) error {
+		if table == TBL_DB {
+			dBlock := common.NewDBlock()
+			_, err := dBlock.UnmarshalBinaryData(value)
+			if err != nil {
+				return err
+			}
+			db.insertDBEntryHeightsMultiBatch(dBlock)
+			return nil
+		}
+
+		eBlock, err := database.UnmarshalStoredEBlock(value)
+		if err == database.ErrPruned {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return db.insertEntryLocationsMultiBatch(eBlock)
+	})
+}
+
+// insertEntryLocationsMultiBatch records where each entry of an entry block
+// was recorded.
+func (db *KVDb) insertEntryLocationsMultiBatch(eblock *common.EBlock) error {
+	locations, err := database.EntryLocations(eblock)
+	if err != nil {
+		return err
+	}
+	for entryHash, location := range locations {
+		var key []byte = []byte{byte(TBL_ENTRY_LOCATION)}
+		key = append(key, entryHash.Bytes()...)
+		binaryLocation, err := location.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		db.lbatch.Put(key, binaryLocation)
+	}
+	return nil
+}
+
+// FetchEntryLocation gets the entry block, directory block height and minute
+// an entry was recorded in.
+func (db *KVDb) FetchEntryLocation(entryHash *common.Hash) (location *database.EntryLocation, err error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	return db.fetchEntryLocation(entryHash)
+}
+
+func (db *KVDb) fetchEntryLocation(entryHash *common.Hash) (location *database.EntryLocation, err error) {
+	var key []byte = []byte{byte(TBL_ENTRY_LOCATION)}
+	key = append(key, entryHash.Bytes()...)
+	data, _ := db.store.Get(key)
+
+	if data == nil {
+		return nil, nil
+	}
+	location = new(database.EntryLocation)
+	err = location.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The height of the stored directory block wins over the entry block's
+	key = []byte{byte(TBL_DB_ENTRY_HEIGHT)}
+	key = append(key, location.EBlockKeyMR.Bytes()...)
+	data, _ = db.store.Get(key)
+	if len(data) == 4 {
+		location.DBHeight = binary.BigEndian.Uint32(data)
+		location.InDBlock = true
+	}
+
+	return location, nil
+}
@@ -0,0 +1,175 @@
+package kvdb
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// The external ID index keys are the escaped external ID with its ASCII
+// letters lowercased, a terminator, the entry hash and the external ID as
+// it is, after the chain ID in TBL_CHAIN_EXTID. The value is the entry hash
+// followed by the external ID as it is, so a lookup can match with or
+// without case. Escaping keeps the order of the external IDs and lets a
+// prefix of an escaped external ID find every external ID that starts with
+// it, while the terminator tells an exact match from a longer external ID.
+var extIDTerminator = []byte{0x00, 0x00}
+
+// escapeExtID escapes the 0x00 bytes of an external ID as 0x00 0xFF.
+func escapeExtID(extID []byte) []byte {
+	escaped := make([]byte, 0, len(extID)+len(extIDTerminator))
+	for _, b := range extID {
+		escaped = append(escaped, b)
+		if b == 0x00 {
+			escaped = append(escaped, 0xFF)
+		}
+	}
+	return escaped
+}
+
+// foldExtID lowercases the ASCII letters of an external ID. External IDs
+// are binary, so the other bytes are left as they are.
+func foldExtID(extID []byte) []byte {
+	folded := make([]byte, len(extID))
+	for i, b := range extID {
+		if 'A' <= b && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		folded[i] = b
+	}
+	return folded
+}
+
+// extIDKeys returns the TBL_EXTID and TBL_CHAIN_EXTID keys of an external ID
+// of an entry.
+func extIDKeys(entry *common.Entry, extID []byte) [][]byte {
+	id := append(escapeExtID(foldExtID(extID)), extIDTerminator...)
+	id = append(id, entry.Hash().Bytes()...)
+	id = append(id, extID...)
+
+	var key []byte = []byte{byte(TBL_EXTID)}
+	key = append(key, id...)
+
+	var chainKey []byte = []byte{byte(TBL_CHAIN_EXTID)}
+	chainKey = append(chainKey, entry.ChainID.Bytes()...)
+	chainKey = append(chainKey, id...)
+
+	return [][]byte{key, chainKey}
+}
+
+// extIDValue returns the value of the index records of an external ID of
+// an entry.
+func extIDValue(entry *common.Entry, extID []byte) []byte {
+	return append(entry.Hash().Bytes(), extID...)
+}
+
+// indexExtIDsMultiBatch queues the external ID index records of an entry.
+func (db *KVDb) indexExtIDsMultiBatch(entry *common.Entry) {
+	for _, extID := range entry.ExtIDs {
+		for _, key := range extIDKeys(entry, extID) {
+			db.lbatch.Put(key, extIDValue(entry, extID))
+		}
+	}
+}
+
+// unindexExtIDsMultiBatch queues the deletes of the external ID index
+// records of an entry.
+func (db *KVDb) unindexExtIDsMultiBatch(entry *common.Entry) {
+	for _, extID := range entry.ExtIDs {
+		for _, key := range extIDKeys(entry, extID) {
+			db.lbatch.Delete(key)
+		}
+	}
+}
+
+// FetchEntryHashesByExtID gets up to limit hashes of the entries with an
+// external ID equal to extID, or starting with it if prefix is set, in the
+// chain chainID or in any chain if it is nil. With ignoreCase set ASCII
+// letters match in either case. They are ordered by lowercased external ID
+// and entry hash, starting at cursor (nil for the first page), and an entry
+// is listed once for each of its external IDs that matches. The returned
+// cursor fetches the next page and is nil when there is none.
+func (db *KVDb) FetchEntryHashesByExtID(extID []byte, prefix bool, ignoreCase bool, chainID *common.Hash, cursor []byte, limit int) (hashes []*common.Hash, next []byte, err error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	var search []byte = []byte{byte(TBL_EXTID)}
+	if chainID != nil {
+		search = []byte{byte(TBL_CHAIN_EXTID)}
+		search = append(search, chainID.Bytes()...)
+	}
+	search = append(search, escapeExtID(foldExtID(extID))...)
+	if !prefix {
+		search = append(search, extIDTerminator...)
+	}
+
+	var fromkey []byte = search
+	if cursor != nil {
+		if !bytes.HasPrefix(cursor, search[1:]) {
+			return nil, nil, fmt.Errorf("cursor %x is not from this search", cursor)
+		}
+		fromkey = append([]byte{search[0]}, cursor...)
+	}
+	var tokey []byte = prefixLimit(search)
+
+	hashes = make([]*common.Hash, 0, 10)
+
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
+		if len(value) < common.HASH_LENGTH {
+			return fmt.Errorf("invalid external ID index record %x", key)
+		}
+		if !ignoreCase {
+			raw := value[common.HASH_LENGTH:]
+			if !bytes.HasPrefix(raw, extID) || (!prefix && len(raw) != len(extID)) {
+				return nil
+			}
+		}
+
+		if limit > 0 && len(hashes) == limit {
+			next = make([]byte, len(key)-1)
+			copy(next, key[1:])
+			return errPageFull
+		}
+
+		hash := common.NewHash()
+		err := hash.SetBytes(value[:common.HASH_LENGTH])
+		if err != nil {
+			return err
+		}
+		hashes = append(hashes, hash)
+		return nil
+	})
+	if err != nil && err != errPageFull {
+		return nil, nil, err
+	}
+	return hashes, next, nil
+}
+
+// prefixLimit returns the first key after all of the keys starting with
+// prefix.
+func prefixLimit(prefix []byte) []byte {
+	limit := make([]byte, len(prefix))
+	copy(limit, prefix)
+	for i := len(limit) - 1; i >= 0; i-- {
+		if limit[i] < 0xFF {
+			limit[i]++
+			return limit[:i+1]
+		}
+	}
+	return nil
+}
+
+// reindexExtIDsMultiBatch queues the external ID indexes of a chunk of the
+// entries in the database.
+func (db *KVDb) reindexExtIDsMultiBatch(cursor []byte) ([]byte, error) {
+	return db.migrateTables(cursor, []uint8{TBL_ENTRY}, func(table uint8, key, value []byte) error {
+		entry := new(common.Entry)
+		_, err := entry.UnmarshalBinaryData(value)
+		if err != nil {
+			return err
+		}
+		db.indexExtIDsMultiBatch(entry)
+		return nil
+	})
+}
@@ -0,0 +1,270 @@
+package kvdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/factoid/block"
+)
+
+// processFactoidCheckpointMultiBatch queues, at a checkpoint height, a
+// snapshot of all factoid balances after a new factoid block. The factoid
+// blocks since the checkpoint before it are replayed from the store.
+func (db *KVDb) processFactoidCheckpointMultiBatch(fBlock block.IFBlock) error {
+	height := fBlock.GetDBHeight()
+	if height%database.FactoidCheckpointInterval != 0 {
+		return nil
+	}
+
+	balances, next, err := db.fetchFactoidCheckpointBelow(height)
+	if err != nil {
+		return err
+	}
+	for h := next; h < height; h++ {
+		stored, err := db.fetchFBlockByHeight(h)
+		if err != nil {
+			return err
+		}
+		addFactoidBalanceChanges(balances, stored)
+	}
+	addFactoidBalanceChanges(balances, fBlock)
+
+	db.putFactoidCheckpointMultiBatch(height, balances)
+	return nil
+}
+
+// putFactoidCheckpointMultiBatch queues the checkpoint of balances at height.
+func (db *KVDb) putFactoidCheckpointMultiBatch(height uint32, balances map[[32]byte]uint64) {
+	for address, balance := range balances {
+		address := address
+		db.lbatch.Put(fctCheckpointKey(height, &address), fctBalanceBytes(balance))
+	}
+	db.lbatch.Put(fctCheckpointKey(height, nil), checkpointCount(len(balances)))
+}
+
+// addFactoidBalanceChanges adds the balance changes of fBlock to balances.
+func addFactoidBalanceChanges(balances map[[32]byte]uint64, fBlock block.IFBlock) {
+	for address, change := range database.FactoidBalanceChanges(fBlock) {
+		balances[address] = uint64(int64(balances[address]) + change)
+	}
+}
+
+// fetchFBlockByHeight gets the factoid block at height. Unlike
+// FetchFBlockByHeight it takes no lock and a missing block is an error.
+func (db *KVDb) fetchFBlockByHeight(height uint32) (block.IFBlock, error) {
+	var key = []byte{byte(TBL_SC_NUM)}
+	key = append(key, common.FACTOID_CHAINID...)
+	num := make([]byte, 4)
+	binary.BigEndian.PutUint32(num, height)
+	key = append(key, num...)
+	hash, err := db.store.Get(key)
+	if err == ErrNotFound {
+		return nil, fmt.Errorf("factoid block %v is missing", height)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.fetchStoredFBlock(hash)
+}
+
+// fetchStoredFBlock gets the factoid block with hash, which must be stored.
+func (db *KVDb) fetchStoredFBlock(hash []byte) (block.IFBlock, error) {
+	data, err := db.store.Get(append([]byte{byte(TBL_SC)}, hash...))
+	if err != nil {
+		return nil, err
+	}
+	fBlock := new(block.FBlock)
+	_, err = fBlock.UnmarshalBinaryData(data)
+	if err != nil {
+		return nil, err
+	}
+	return fBlock, nil
+}
+
+// FetchFactoidBalanceAtHeight gets the factoid balance, in factoshis, of an
+// address as of the factoid block at a directory block height. The factoid
+// blocks after the nearest checkpoint at or below height are replayed.
+func (db *KVDb) FetchFactoidBalanceAtHeight(address *[32]byte, height uint32) (uint64, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	balance, next, err := db.fetchFactoidCheckpoint(address, height)
+	if err != nil {
+		return 0, err
+	}
+	for h := next; h <= height; h++ {
+		fBlock, err := db.fetchFBlockByHeight(h)
+		if err != nil {
+			return 0, err
+		}
+		balance = uint64(int64(balance) + database.FactoidBalanceChanges(fBlock)[*address])
+	}
+	return balance, nil
+}
+
+// fetchFactoidCheckpoint gets the balance of an address at the highest
+// checkpoint at or below height, and the height of the first factoid block
+// after it. Without one the balance starts at zero before the first block.
+func (db *KVDb) fetchFactoidCheckpoint(address *[32]byte, height uint32) (balance uint64, next uint32, err error) {
+	cp, err := db.findFactoidCheckpoint(int64(height))
+	if err != nil || cp < 0 {
+		return 0, 0, err
+	}
+
+	data, err := db.store.Get(fctCheckpointKey(uint32(cp), address))
+	if err == ErrNotFound {
+		return 0, uint32(cp) + 1, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	balance, err = fctBalance(data)
+	return balance, uint32(cp) + 1, err
+}
+
+// fetchFactoidCheckpointBelow gets all of the balances of the highest
+// checkpoint below height, and the height of the first factoid block after
+// it. Without one there are no balances before the first block.
+func (db *KVDb) fetchFactoidCheckpointBelow(height uint32) (balances map[[32]byte]uint64, next uint32, err error) {
+	balances = make(map[[32]byte]uint64)
+	cp, err := db.findFactoidCheckpoint(int64(height) - 1)
+	if err != nil || cp < 0 {
+		return balances, 0, err
+	}
+
+	prefix := fctCheckpointKey(uint32(cp), nil)
+	err = db.store.Iterate(append(prefix, 0), prefixLimit(prefix), func(key, value []byte) error {
+		balance, err := fctBalance(value)
+		if err != nil {
+			return err
+		}
+		var address [32]byte
+		copy(address[:], key[len(prefix):])
+		balances[address] = balance
+		return nil
+	})
+	return balances, uint32(cp) + 1, err
+}
+
+// findFactoidCheckpoint returns the height of the highest checkpoint at or
+// below height, -1 if there is none.
+func (db *KVDb) findFactoidCheckpoint(height int64) (int64, error) {
+	if height < 0 {
+		return -1, nil
+	}
+	for cp := height - height%database.FactoidCheckpointInterval; cp >= 0; cp -= database.FactoidCheckpointInterval {
+		_, err := db.store.Get(fctCheckpointKey(uint32(cp), nil))
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return cp, nil
+	}
+	return -1, nil
+}
+
+// fctCheckpointKey returns the key of a balance in the checkpoint at
+// height, or of the checkpoint itself if address is nil.
+func fctCheckpointKey(height uint32, address *[32]byte) []byte {
+	key := make([]byte, 5, 37)
+	key[0] = byte(TBL_FCT_CHECKPOINT)
+	binary.BigEndian.PutUint32(key[1:], height)
+	if address != nil {
+		key = append(key, address[:]...)
+	}
+	return key
+}
+
+func fctBalanceBytes(balance uint64) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, balance)
+	return data
+}
+
+func fctBalance(data []byte) (uint64, error) {
+	if len(data) != 8 {
+		return 0, fmt.Errorf("factoid balance is %v bytes, expected 8", len(data))
+	}
+	return binary.BigEndian.Uint64(data), nil
+}
+
+// rebuildFactoidCheckpointsMultiBatch queues a chunk of the factoid balance
+// checkpoints replayed from the factoid blocks in the database: the old
+// checkpoints are deleted first, then the blocks are replayed from the
+// lowest height. Only a checkpoint writes anything, so a chunk of the
+// blocks always ends after one, and the next chunk picks the balances up
+// from it.
+func (db *KVDb) rebuildFactoidCheckpointsMultiBatch(cursor []byte) ([]byte, error) {
+	var balances map[[32]byte]uint64
+
+	return db.migrateTables(cursor, []uint8{TBL_FCT_CHECKPOINT, TBL_SC_NUM}, func(table uint8, key, value []byte) error {
+		if table == TBL_FCT_CHECKPOINT {
+			db.lbatch.Delete(append([]byte{byte(TBL_FCT_CHECKPOINT)}, key...))
+			return nil
+		}
+
+		if len(key) != len(common.FACTOID_CHAINID)+4 || !bytes.HasPrefix(key, common.FACTOID_CHAINID) {
+			return nil
+		}
+		height := binary.BigEndian.Uint32(key[len(common.FACTOID_CHAINID):])
+		fBlock, err := db.fetchStoredFBlock(value)
+		if err != nil {
+			return err
+		}
+		if balances == nil {
+			balances, _, err = db.fetchFactoidCheckpointBelow(height)
+			if err != nil {
+				return err
+			}
+		}
+
+		addFactoidBalanceChanges(balances, fBlock)
+		if height%database.FactoidCheckpointInterval == 0 {
+			db.putFactoidCheckpointMultiBatch(height, balances)
+		}
+		return nil
+	})
+}
+
+// factoidCheckpoints returns the TBL_FCT_CHECKPOINT records, without the
+// table prefix, replayed from the factoid blocks in the database.
+func (db *KVDb) factoidCheckpoints() (map[string][]byte, error) {
+	var heights []uint32
+	var fBlockHashes [][]byte
+	err := db.forEach(TBL_SC_NUM, func(key, value []byte) error {
+		if len(key) != len(common.FACTOID_CHAINID)+4 || !bytes.HasPrefix(key, common.FACTOID_CHAINID) {
+			return nil
+		}
+		heights = append(heights, binary.BigEndian.Uint32(key[len(common.FACTOID_CHAINID):]))
+		fBlockHashes = append(fBlockHashes, value)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoints := make(map[string][]byte)
+	balances := make(map[[32]byte]uint64)
+	for i, hash := range fBlockHashes {
+		fBlock, err := db.fetchStoredFBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		addFactoidBalanceChanges(balances, fBlock)
+
+		if heights[i]%database.FactoidCheckpointInterval != 0 {
+			continue
+		}
+		for address, balance := range balances {
+			address := address
+			checkpoints[string(fctCheckpointKey(heights[i], &address)[1:])] = fctBalanceBytes(balance)
+		}
+		checkpoints[string(fctCheckpointKey(heights[i], nil)[1:])] = checkpointCount(len(balances))
+	}
+	return checkpoints, nil
+}
@@ -0,0 +1,408 @@
+package kvdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// tableNames names the tables in check reports
+var tableNames = map[uint8]string{
+	TBL_DB:              "TBL_DB",
+	TBL_DB_NUM:          "TBL_DB_NUM",
+	TBL_DB_MR:           "TBL_DB_MR",
+	TBL_DB_INFO:         "TBL_DB_INFO",
+	TBL_AB:              "TBL_AB",
+	TBL_AB_NUM:          "TBL_AB_NUM",
+	TBL_SC:              "TBL_SC",
+	TBL_SC_NUM:          "TBL_SC_NUM",
+	TBL_CB:              "TBL_CB",
+	TBL_CB_NUM:          "TBL_CB_NUM",
+	TBL_CB_MR:           "TBL_CB_MR",
+	TBL_CHAIN_HASH:      "TBL_CHAIN_HASH",
+	TBL_CHAIN_HEAD:      "TBL_CHAIN_HEAD",
+	TBL_EB:              "TBL_EB",
+	TBL_EB_CHAIN_NUM:    "TBL_EB_CHAIN_NUM",
+	TBL_EB_MR:           "TBL_EB_MR",
+	TBL_ENTRY:           "TBL_ENTRY",
+	TBL_CHAIN_ENTRY:     "TBL_CHAIN_ENTRY",
+	TBL_ENTRY_LOCATION:  "TBL_ENTRY_LOCATION",
+	TBL_DB_ENTRY_HEIGHT: "TBL_DB_ENTRY_HEIGHT",
+	TBL_META:            "TBL_META",
+	TBL_EC_BALANCE:      "TBL_EC_BALANCE",
+	TBL_EC_CHECKPOINT:   "TBL_EC_CHECKPOINT",
+	TBL_EXTID:           "TBL_EXTID",
+	TBL_CHAIN_EXTID:     "TBL_CHAIN_EXTID",
+	TBL_CHAIN_STATS:     "TBL_CHAIN_STATS",
+	TBL_FCT_CHECKPOINT:  "TBL_FCT_CHECKPOINT",
+}
+
+// CheckIssue is a single inconsistency found by Check.
+type CheckIssue struct {
+	Table      string `json:"table"`
+	Key        string `json:"key"` // hex, without the table prefix
+	Problem    string `json:"problem"`
+	Repairable bool   `json:"repairable"` // the key is in an index rebuilt from the blocks
+	Repaired   bool   `json:"repaired"`
+}
+
+// CheckReport is the machine readable result of Check.
+type CheckReport struct {
+	Checked map[string]int `json:"checked"` // number of keys checked per table
+	Issues  []CheckIssue   `json:"issues"`
+}
+
+// Unrepaired returns the number of issues still in the database.
+func (r *CheckReport) Unrepaired() int {
+	n := 0
+	for _, issue := range r.Issues {
+		if !issue.Repaired {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *CheckReport) add(table uint8, key []byte, repairable bool, format string, a ...interface{}) {
+	r.Issues = append(r.Issues, CheckIssue{
+		Table:      tableNames[table],
+		Key:        hex.EncodeToString(key),
+		Problem:    fmt.Sprintf(format, a...),
+		Repairable: repairable,
+	})
+}
+
+// index is the content an index table should have, rebuilt from the blocks.
+type index struct {
+	table    uint8
+	expected map[string][]byte // key without the table prefix -> value
+
+	// owns tells which keys of the table the index covers, nil for all
+	owns func(key []byte) bool
+}
+
+func newIndex(table uint8) *index {
+	return &index{table: table, expected: make(map[string][]byte)}
+}
+
+func (i *index) put(key []byte, value []byte) {
+	v := make([]byte, len(value))
+	copy(v, value)
+	i.expected[string(key)] = v
+}
+
+// Check walks the directory block and entry block tables and verifies that
+// every cross reference to them resolves and is consistent: TBL_DB_NUM,
+// TBL_DB_MR, TBL_EB_MR, TBL_EB_CHAIN_NUM (including sequence gaps),
+// TBL_CHAIN_HEAD, TBL_CHAIN_ENTRY, TBL_ENTRY_LOCATION, TBL_DB_ENTRY_HEIGHT,
+// TBL_EC_BALANCE, TBL_EC_CHECKPOINT, TBL_FCT_CHECKPOINT, TBL_EXTID,
+// TBL_CHAIN_EXTID, TBL_CHAIN_STATS unless the database is pruned, and the
+// entries referenced by entry blocks. With repair set the index tables are rewritten to match
+// the blocks.
+func (db *KVDb) Check(repair bool) (*CheckReport, error) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	report := &CheckReport{Checked: make(map[string]int)}
+
+	dbNum := newIndex(TBL_DB_NUM)
+	dbMR := newIndex(TBL_DB_MR)
+	dbEntryHeight := newIndex(TBL_DB_ENTRY_HEIGHT)
+	ebMR := newIndex(TBL_EB_MR)
+	ebChainNum := newIndex(TBL_EB_CHAIN_NUM)
+	chainEntry := newIndex(TBL_CHAIN_ENTRY)
+	entryLocation := newIndex(TBL_ENTRY_LOCATION)
+	chainHead := newIndex(TBL_CHAIN_HEAD)
+
+	// Directory blocks
+	maxHeight := int64(-1)
+	var dHead *common.Hash
+	err := db.forEach(TBL_DB, func(key, value []byte) error {
+		report.Checked[tableNames[TBL_DB]]++
+
+		dblock := common.NewDBlock()
+		_, err := dblock.UnmarshalBinaryData(value)
+		if err != nil {
+			report.add(TBL_DB, key, false, "cannot unmarshal directory block: %v", err)
+			return nil
+		}
+		if !bytes.Equal(common.Sha(value).Bytes(), key) {
+			report.add(TBL_DB, key, false, "hash of directory block is %v", common.Sha(value))
+		}
+		dblock.BuildKeyMerkleRoot()
+
+		height := make([]byte, 4)
+		binary.BigEndian.PutUint32(height, dblock.Header.DBHeight)
+		dbNum.put(height, key)
+		dbMR.put(dblock.KeyMR.Bytes(), key)
+		for _, dbEntry := range dblock.DBEntries {
+			dbEntryHeight.put(dbEntry.KeyMR.Bytes(), height)
+		}
+		if int64(dblock.Header.DBHeight) > maxHeight {
+			maxHeight = int64(dblock.Header.DBHeight)
+			dHead = dblock.KeyMR
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for h := int64(0); h < maxHeight; h++ {
+		height := make([]byte, 4)
+		binary.BigEndian.PutUint32(height, uint32(h))
+		if _, ok := dbNum.expected[string(height)]; !ok {
+			report.add(TBL_DB, height, false, "missing directory block at height %v", h)
+		}
+	}
+	if dHead != nil {
+		chainHead.put(common.D_CHAINID, dHead.Bytes())
+	}
+
+	// Entry blocks
+	maxSequence := make(map[string]uint32)
+	sequences := make(map[string]map[uint32]bool)
+	err = db.forEach(TBL_EB, func(key, value []byte) error {
+		report.Checked[tableNames[TBL_EB]]++
+
+		// A pruned block is its header only, which is checked through the
+		// cross references to it
+		eblock, err := database.UnmarshalStoredEBlock(value)
+		pruned := err == database.ErrPruned
+		if err != nil && !pruned {
+			report.add(TBL_EB, key, false, "cannot unmarshal entry block: %v", err)
+			return nil
+		}
+		if !pruned && !bytes.Equal(common.Sha(value).Bytes(), key) {
+			report.add(TBL_EB, key, false, "hash of entry block is %v", common.Sha(value))
+		}
+		var keyMR *common.Hash
+		if pruned {
+			keyMR, err = eblock.HeaderKeyMR()
+		} else {
+			keyMR, err = eblock.KeyMR()
+		}
+		if err != nil {
+			return err
+		}
+
+		chainID := string(eblock.Header.ChainID.Bytes())
+		seq := eblock.Header.EBSequence
+		ebMR.put(keyMR.Bytes(), key)
+		chainNum := make([]byte, 4)
+		binary.BigEndian.PutUint32(chainNum, seq)
+		ebChainNum.put(append(eblock.Header.ChainID.Bytes(), chainNum...), key)
+		if sequences[chainID] == nil {
+			sequences[chainID] = make(map[uint32]bool)
+		}
+		sequences[chainID][seq] = true
+		if max, ok := maxSequence[chainID]; !ok || seq >= max {
+			maxSequence[chainID] = seq
+			chainHead.put(eblock.Header.ChainID.Bytes(), keyMR.Bytes())
+		}
+
+		for i, ebEntry := range eblock.Body.EBEntries {
+			if ebEntry.IsMinuteMarker() {
+				continue
+			}
+			chainEntry.put(chainEntryKey(eblock.Header.ChainID, seq, uint32(i))[1:], ebEntry.Bytes())
+
+			entryKey := append([]byte{byte(TBL_ENTRY)}, ebEntry.Bytes()...)
+			if _, err := db.store.Get(entryKey); err != nil {
+				report.add(TBL_ENTRY, ebEntry.Bytes(), false, "entry referenced by entry block %v is missing", keyMR)
+			}
+		}
+
+		// The locations of the pruned entries are kept, and checked only
+		// through the entries still in the database
+		if pruned {
+			return nil
+		}
+		locations, err := database.EntryLocations(eblock)
+		if err != nil {
+			return err
+		}
+		for entryHash, location := range locations {
+			data, _ := location.MarshalBinary()
+			entryLocation.put(entryHash.Bytes(), data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for chainID, max := range maxSequence {
+		for seq := uint32(0); seq < max; seq++ {
+			if !sequences[chainID][seq] {
+				chainNum := make([]byte, 4)
+				binary.BigEndian.PutUint32(chainNum, seq)
+				report.add(TBL_EB_CHAIN_NUM, append([]byte(chainID), chainNum...), false, "sequence gap: missing entry block %v", seq)
+			}
+		}
+	}
+
+	// The entries of pruned blocks are gone, but where they were recorded
+	// is kept
+	prunedHeight, err := db.fetchPrunedHeight()
+	if err != nil {
+		return nil, err
+	}
+	if prunedHeight > 0 {
+		entryLocation.owns = func(key []byte) bool {
+			if _, ok := entryLocation.expected[string(key)]; ok {
+				return true
+			}
+			_, err := db.store.Get(append([]byte{byte(TBL_ENTRY)}, key...))
+			return err == nil
+		}
+	}
+
+	// Only the heads of the directory chain and of entry chains are
+	// checked; the admin, entry credit and factoid heads are left alone.
+	chainHead.owns = func(key []byte) bool {
+		_, ok := maxSequence[string(key)]
+		return ok || bytes.Equal(key, common.D_CHAINID)
+	}
+
+	// Entry credit balances, replayed from the entry credit blocks
+	ecBalance := newIndex(TBL_EC_BALANCE)
+	balances, err := db.ecBalanceChangesAbove(-1)
+	if err != nil {
+		return nil, err
+	}
+	for pubKey, balance := range balances {
+		binaryBalance, _ := balance.MarshalBinary()
+		ecBalance.put(pubKey[:], binaryBalance)
+	}
+
+	// External IDs of the entries
+	extID := newIndex(TBL_EXTID)
+	chainExtID := newIndex(TBL_CHAIN_EXTID)
+	err = db.forEach(TBL_ENTRY, func(key, value []byte) error {
+		entry := new(common.Entry)
+		_, err := entry.UnmarshalBinaryData(value)
+		if err != nil {
+			report.add(TBL_ENTRY, key, false, "cannot unmarshal entry: %v", err)
+			return nil
+		}
+		for _, id := range entry.ExtIDs {
+			keys := extIDKeys(entry, id)
+			extID.put(keys[0][1:], extIDValue(entry, id))
+			chainExtID.put(keys[1][1:], extIDValue(entry, id))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ecCheckpoint := newIndex(TBL_EC_CHECKPOINT)
+	ecCheckpoint.expected, err = db.ecCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	fctCheckpoint := newIndex(TBL_FCT_CHECKPOINT)
+	fctCheckpoint.expected, err = db.factoidCheckpoints()
+	if err != nil {
+		return nil, err
+	}
+
+	indexes := []*index{dbNum, dbMR, dbEntryHeight, ebMR, ebChainNum, chainHead, chainEntry, entryLocation, ecBalance, ecCheckpoint, fctCheckpoint, extID, chainExtID}
+
+	// The statistics of a pruned database count entries that are gone
+	if prunedHeight == 0 {
+		chainStats := newIndex(TBL_CHAIN_STATS)
+		all, err := db.chainStatsFromEBlocks()
+		if err != nil {
+			return nil, err
+		}
+		for chainID, stats := range all {
+			binaryStats, err := stats.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			chainStats.put([]byte(chainID), binaryStats)
+		}
+		indexes = append(indexes, chainStats)
+	}
+
+	batch := new(Batch)
+	for _, i := range indexes {
+		err = db.checkIndex(report, i, batch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if repair && batch.Len() > 0 {
+		err = db.store.Write(batch)
+		if err != nil {
+			return nil, err
+		}
+		for i := range report.Issues {
+			if report.Issues[i].Repairable {
+				report.Issues[i].Repaired = true
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// checkIndex compares an index table with the content it should have and
+// queues the writes that fix it in batch.
+func (db *KVDb) checkIndex(report *CheckReport, i *index, batch *Batch) error {
+	seen := make(map[string]bool)
+	err := db.forEach(i.table, func(key, value []byte) error {
+		if i.owns != nil && !i.owns(key) {
+			return nil
+		}
+		report.Checked[tableNames[i.table]]++
+		seen[string(key)] = true
+
+		tableKey := append([]byte{byte(i.table)}, key...)
+		expected, ok := i.expected[string(key)]
+		if !ok {
+			report.add(i.table, key, true, "dangling reference to %x", value)
+			batch.Delete(tableKey)
+		} else if !bytes.Equal(expected, value) {
+			report.add(i.table, key, true, "points to %x instead of %x", value, expected)
+			batch.Put(tableKey, expected)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key, expected := range i.expected {
+		if !seen[key] {
+			report.add(i.table, []byte(key), true, "missing, should point to %x", expected)
+			batch.Put(append([]byte{byte(i.table)}, key...), expected)
+		}
+	}
+	return nil
+}
+
+// forEach calls fn with the key, without the table prefix, and the value of
+// every record in a table.
+func (db *KVDb) forEach(table uint8, fn func(key, value []byte) error) error {
+	var fromkey = []byte{byte(table)}   // Table Name (1 bytes)
+	var tokey = []byte{byte(table + 1)} // Table Name (1 bytes)
+
+	return db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
+		key = key[1:]
+		if table == TBL_ENTRY || table == TBL_EB {
+			var err error
+			value, err = decodeValue(table, key, value)
+			if err != nil {
+				return err
+			}
+		}
+		return fn(key, value)
+	})
+}
@@ -0,0 +1,142 @@
+package kvdb
+
+import (
+	"encoding/binary"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/factoid/block"
+)
+
+// iterateRange calls next for every height, or sequence number, from start
+// up to, not including, end until next reports a missing one or returns an
+// error. No lock is held while next runs, so the callbacks of the Iterate
+// methods are free to use the database.
+func iterateRange(start, end int64, next func(height uint32) (found bool, err error)) error {
+	for height := start; end == database.AllShas || height < end; height++ {
+		found, err := next(uint32(height))
+		if err == database.ErrStopIteration {
+			return nil
+		}
+		if err != nil || !found {
+			return err
+		}
+	}
+	return nil
+}
+
+// IterateDBlocks calls fn with the directory blocks from startHeight up to,
+// not including, endHeight in height order.
+func (db *KVDb) IterateDBlocks(startHeight, endHeight int64, fn func(dBlock *common.DirectoryBlock) error) error {
+	return iterateRange(startHeight, endHeight, func(height uint32) (bool, error) {
+		dBlock, err := db.FetchDBlockByHeight(height)
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil || dBlock == nil {
+			return false, err
+		}
+		return true, fn(dBlock)
+	})
+}
+
+// IterateDirBlockInfo calls fn with the dirBlockInfo of the directory blocks
+// from startHeight up to, not including, endHeight in height order.
+func (db *KVDb) IterateDirBlockInfo(startHeight, endHeight int64, fn func(dirBlockInfo *common.DirBlockInfo) error) error {
+	return iterateRange(startHeight, endHeight, func(height uint32) (bool, error) {
+		dbHash, err := db.FetchDBHashByHeight(height)
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		dirBlockInfo, err := db.FetchDirBlockInfoByHash(dbHash)
+		if err != nil || dirBlockInfo == nil {
+			return true, err
+		}
+		return true, fn(dirBlockInfo)
+	})
+}
+
+// IterateABlocks calls fn with the admin blocks from startHeight up to, not
+// including, endHeight in height order.
+func (db *KVDb) IterateABlocks(startHeight, endHeight int64, fn func(aBlock *common.AdminBlock) error) error {
+	return iterateRange(startHeight, endHeight, func(height uint32) (bool, error) {
+		aBlock, err := db.FetchABlockByHeight(height)
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil || aBlock == nil {
+			return false, err
+		}
+		return true, fn(aBlock)
+	})
+}
+
+// IterateECBlocks calls fn with the entry credit blocks from startHeight up
+// to, not including, endHeight in height order.
+func (db *KVDb) IterateECBlocks(startHeight, endHeight int64, fn func(ecBlock *common.ECBlock) error) error {
+	return iterateRange(startHeight, endHeight, func(height uint32) (bool, error) {
+		ecBlock, err := db.FetchECBlockByHeight(height)
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil || ecBlock == nil {
+			return false, err
+		}
+		return true, fn(ecBlock)
+	})
+}
+
+// IterateFBlocks calls fn with the factoid blocks from startHeight up to, not
+// including, endHeight in height order.
+func (db *KVDb) IterateFBlocks(startHeight, endHeight int64, fn func(fBlock block.IFBlock) error) error {
+	return iterateRange(startHeight, endHeight, func(height uint32) (bool, error) {
+		fBlock, err := db.FetchFBlockByHeight(height)
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil || fBlock == nil {
+			return false, err
+		}
+		return true, fn(fBlock)
+	})
+}
+
+// IterateEBlocksByChain calls fn with the entry blocks of a chain from
+// sequence number startSeq up to, not including, endSeq in sequence order.
+// Pruned blocks are passed with their header only.
+func (db *KVDb) IterateEBlocksByChain(chainID *common.Hash, startSeq, endSeq int64, fn func(eBlock *common.EBlock) error) error {
+	return iterateRange(startSeq, endSeq, func(seq uint32) (bool, error) {
+		var key []byte = []byte{byte(TBL_EB_CHAIN_NUM)}
+		key = append(key, chainID.Bytes()...)
+		bytes := make([]byte, 4)
+		binary.BigEndian.PutUint32(bytes, seq)
+		key = append(key, bytes...)
+		db.dbLock.RLock()
+		data, err := db.store.Get(key)
+		db.dbLock.RUnlock()
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+
+		eBlockHash := common.NewHash()
+		_, err = eBlockHash.UnmarshalBinaryData(data)
+		if err != nil {
+			return false, err
+		}
+		eBlock, err := db.FetchEBlockByHash(eBlockHash)
+		if err == ErrNotFound {
+			return false, nil
+		}
+		if err != nil && err != database.ErrPruned {
+			return false, err
+		}
+		return true, fn(eBlock)
+	})
+}
@@ -0,0 +1,293 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package kvdb implements database.Db on top of a plain ordered key/value
+// Store. It lays out the data in "tables", each a one byte key prefix, so
+// every backend built on it (LevelDB, BoltDB, memory) holds the same keys.
+package kvdb
+
+import (
+	"log"
+	"sync"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/btcd/wire"
+	"github.com/FactomProject/goleveldb/leveldb"
+)
+
+// the "table" prefix
+const (
+
+	// Directory Block
+	TBL_DB uint8 = iota
+	TBL_DB_NUM
+	TBL_DB_MR
+	TBL_DB_INFO
+
+	// Admin Block
+	TBL_AB //4
+	TBL_AB_NUM
+
+	TBL_SC
+	TBL_SC_NUM
+
+	// Entry Credit Block
+	TBL_CB //8
+	TBL_CB_NUM
+	TBL_CB_MR
+
+	// Entry Chain
+	TBL_CHAIN_HASH //11
+
+	// The latest Block MR for chains including special chains
+	TBL_CHAIN_HEAD
+
+	// Entry Block
+	TBL_EB //13
+	TBL_EB_CHAIN_NUM
+	TBL_EB_MR
+
+	//Entry
+	TBL_ENTRY
+
+	// Entry hashes by chain, EBlock sequence and position in the EBlock
+	TBL_CHAIN_ENTRY //17
+
+	// Entry hash to the entry block and minute it was recorded in
+	TBL_ENTRY_LOCATION
+
+	// KeyMR of every block listed in a directory block to the DBHeight
+	TBL_DB_ENTRY_HEIGHT
+
+	// Database metadata, like the schema version
+	TBL_META
+
+	// Entry credit balance by EC public key
+	TBL_EC_BALANCE
+
+	// Entry credit balances by height and EC public key, at every
+	// database.ECCheckpointInterval heights
+	TBL_EC_CHECKPOINT
+
+	// Entry hashes by external ID, and by chain ID and external ID
+	TBL_EXTID
+	TBL_CHAIN_EXTID
+
+	// Statistics of the entry chains by chain ID
+	TBL_CHAIN_STATS
+
+	// Factoid balances by height and address, at every
+	// database.FactoidCheckpointInterval heights
+	TBL_FCT_CHECKPOINT
+)
+
+// ErrNotFound is returned by a Store for missing keys. It is the error
+// goleveldb returns, so the LevelDB backend can pass its errors through.
+var ErrNotFound = leveldb.ErrNotFound
+
+// Store is the key/value engine underneath a KVDb. KVDb serializes all
+// access to it, so implementations do not need their own locking.
+type Store interface {
+	// Get returns the value stored under key, or ErrNotFound.
+	Get(key []byte) ([]byte, error)
+
+	// Iterate calls fn for every key in [fromkey, tokey), in key order,
+	// and stops at the first error returned by fn. An empty (or nil)
+	// fromkey starts at the first key and an empty tokey ends after the
+	// last one, so Iterate(nil, nil, fn) walks the whole store. fn may
+	// keep key and value.
+	Iterate(fromkey, tokey []byte, fn func(key, value []byte) error) error
+
+	// Write applies all operations of the batch atomically.
+	Write(b *Batch) error
+
+	Sync() error
+	Close() error
+	RollbackClose() error
+}
+
+// Op is a single pending write in a Batch.
+type Op struct {
+	Key    []byte
+	Value  []byte
+	Delete bool
+}
+
+// Batch mirrors leveldb.Batch: writes are queued and only become visible
+// once the batch is written to the Store.
+type Batch struct {
+	Ops []Op
+}
+
+func (b *Batch) Put(key, value []byte) {
+	k := make([]byte, len(key))
+	copy(k, key)
+	v := make([]byte, len(value))
+	copy(v, value)
+	b.Ops = append(b.Ops, Op{Key: k, Value: v})
+}
+
+func (b *Batch) Delete(key []byte) {
+	k := make([]byte, len(key))
+	copy(k, key)
+	b.Ops = append(b.Ops, Op{Key: k, Delete: true})
+}
+
+func (b *Batch) Reset() {
+	b.Ops = b.Ops[:0]
+}
+
+func (b *Batch) Len() int {
+	return len(b.Ops)
+}
+
+type KVDb struct {
+	// lock preventing multiple entry
+	dbLock sync.RWMutex
+
+	store Store
+
+	lbatch *Batch
+
+	// entries inserted in the batch opened by StartBatch, which the chain
+	// statistics of the entry blocks in the same batch have to count
+	batchEntries map[common.Hash]*common.Entry
+
+	// compression of the entries and entry blocks written from now on
+	compression Compression
+
+	nextDirBlockHeight int64
+
+	lastDirBlkShaCached bool
+	lastDirBlkSha       *wire.ShaHash
+	lastDirBlkHeight    int64
+
+	// the DirBlock height cache as it was before the open batch, put back
+	// if the batch is not written
+	savedDirBlkShaCached bool
+	savedDirBlkSha       *wire.ShaHash
+	savedDirBlkHeight    int64
+}
+
+var _ database.Db = (*KVDb)(nil)
+
+// New returns a database.Db storing its tables in store.
+func New(store Store) *KVDb {
+	db := new(KVDb)
+	db.store = store
+
+	// Initialize db
+	db.lastDirBlkHeight = -1
+
+	return db
+}
+
+// Open returns a database.Db storing its tables in store, migrated to the
+// current schema version. The store is closed if the migration fails.
+func Open(store Store) (*KVDb, error) {
+	db := New(store)
+
+	reports, err := db.Migrate(false)
+	for _, r := range reports {
+		log.Printf("migrated db to schema version %v: %v (%v writes)\n", r.Version, r.Description, r.Writes)
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *KVDb) StartBatch() {
+	db.dbLock.Lock()
+	db.lbatch = new(Batch)
+	db.batchEntries = make(map[common.Hash]*common.Entry)
+	db.saveHeightCache()
+}
+
+// EndBatch writes the batch opened by StartBatch. The DirBlock height cache
+// goes back to where it was if the write fails.
+func (db *KVDb) EndBatch() error {
+	defer db.lbatch.Reset()
+	defer db.dbLock.Unlock()
+	db.batchEntries = nil
+
+	err := db.store.Write(db.lbatch)
+	if err != nil {
+		db.restoreHeightCache()
+	}
+	return err
+}
+
+// CancelBatch discards the batch opened by StartBatch and the DirBlock
+// height cache updates made in it.
+func (db *KVDb) CancelBatch() {
+	db.lbatch.Reset()
+	db.batchEntries = nil
+	db.restoreHeightCache()
+	db.dbLock.Unlock()
+}
+
+// saveHeightCache saves the DirBlock height cache before a batch that may
+// update it.
+func (db *KVDb) saveHeightCache() {
+	db.savedDirBlkShaCached = db.lastDirBlkShaCached
+	db.savedDirBlkSha = db.lastDirBlkSha
+	db.savedDirBlkHeight = db.lastDirBlkHeight
+}
+
+// restoreHeightCache puts back the DirBlock height cache saved by
+// saveHeightCache, for a batch that was not written.
+func (db *KVDb) restoreHeightCache() {
+	db.lastDirBlkShaCached = db.savedDirBlkShaCached
+	db.lastDirBlkSha = db.savedDirBlkSha
+	db.lastDirBlkHeight = db.savedDirBlkHeight
+}
+
+// Sync verifies that the database is coherent on disk,
+// and no outstanding transactions are in flight.
+func (db *KVDb) Sync() error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	return db.store.Sync()
+}
+
+// Close cleanly shuts down database, syncing all data.
+func (db *KVDb) Close() error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	return db.store.Close()
+}
+
+// RollbackClose discards the changes made since the last Sync, if the
+// Store supports it, and closes the database.
+func (db *KVDb) RollbackClose() error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	db.lastDirBlkShaCached = false
+	db.lastDirBlkSha = nil
+	db.lastDirBlkHeight = -1
+	return db.store.RollbackClose()
+}
+
+// Internal db use only
+func addOneToByteArray(input []byte) (output []byte) {
+	if input == nil {
+		return []byte{byte(1)}
+	}
+	output = make([]byte, len(input))
+	copy(output, input)
+	for i := len(input); i > 0; i-- {
+		if output[i-1] < 255 {
+			output[i-1] = output[i-1] + 1
+			break
+		}
+		output[i-1] = 0
+	}
+	return output
+}
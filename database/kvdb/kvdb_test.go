@@ -0,0 +1,202 @@
+package kvdb_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database/conformance"
+	"github.com/FactomProject/FactomCode/database/kvdb"
+	"github.com/FactomProject/FactomCode/database/memdb"
+)
+
+func TestCheck(t *testing.T) {
+	db := memdb.NewMemDb()
+
+	entry := conformance.NewTestEntry("check")
+	db.InsertEntry(entry)
+	eblock := common.NewEBlock()
+	eblock.Header.ChainID = entry.ChainID
+	eblock.AddEBEntry(entry)
+	if err := db.ProcessEBlockBatch(eblock); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := db.(*kvdb.KVDb).Check(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("consistent db reported issues: %+v", report.Issues)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	db := memdb.NewMemDb()
+
+	// Values written before and after compression is turned on both stay
+	// readable
+	raw := conformance.NewTestEntry(strings.Repeat("raw ", 100))
+	db.InsertEntry(raw)
+	compression, err := kvdb.ParseCompression("snappy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.(*kvdb.KVDb).SetCompression(compression)
+	compressed := conformance.NewTestEntry(strings.Repeat("compressed ", 100))
+	db.InsertEntry(compressed)
+
+	for _, entry := range []*common.Entry{raw, compressed} {
+		got, err := db.FetchEntryByHash(entry.Hash())
+		if err != nil || got == nil || !got.Hash().IsSameAs(entry.Hash()) {
+			t.Errorf("FetchEntryByHash(%v) = %v, %v", entry.Hash(), got, err)
+		}
+	}
+
+	eblock := common.NewEBlock()
+	eblock.Header.ChainID = raw.ChainID
+	eblock.AddEBEntry(raw)
+	eblock.AddEBEntry(compressed)
+	if err := db.ProcessEBlockBatch(eblock); err != nil {
+		t.Fatal(err)
+	}
+	hash, _ := eblock.Hash()
+	got, err := db.FetchEBlockByHash(hash)
+	if err != nil || got == nil {
+		t.Fatalf("FetchEBlockByHash(%v) = %v, %v", hash, got, err)
+	}
+	if gotHash, _ := got.Hash(); !gotHash.IsSameAs(hash) {
+		t.Errorf("FetchEBlockByHash(%v) returned block %v", hash, gotHash)
+	}
+
+	report, err := db.(*kvdb.KVDb).Check(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("db with compressed values reported issues: %+v", report.Issues)
+	}
+
+	if _, err := kvdb.ParseCompression("lzma"); err == nil {
+		t.Error("ParseCompression accepted an unknown codec")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	dbA := memdb.NewMemDb().(*kvdb.KVDb)
+	dbB := memdb.NewMemDb().(*kvdb.KVDb)
+
+	// The same entry stored with and without compression does not differ
+	shared := conformance.NewTestEntry(strings.Repeat("shared ", 100))
+	dbA.InsertEntry(shared)
+	dbB.SetCompression(kvdb.SnappyCompression)
+	dbB.InsertEntry(shared)
+	onlyA := conformance.NewTestEntry("only in A")
+	dbA.InsertEntry(onlyA)
+
+	report, err := kvdb.Diff(dbA, dbB, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Differences) == 0 {
+		t.Fatal("no differences found")
+	}
+	for _, d := range report.Differences {
+		if d.Key == shared.Hash().String() {
+			t.Errorf("shared entry reported: %v", d)
+		}
+	}
+	found := false
+	for _, d := range report.Differences {
+		if d.Table == "TBL_ENTRY" && d.Key == onlyA.Hash().String() {
+			found = d.Problem == "missing in B" && d.What == "entry "+onlyA.Hash().String()
+		}
+	}
+	if !found {
+		t.Errorf("entry missing in B not reported: %+v", report.Differences)
+	}
+
+	// Different directory blocks at the same height are paired
+	for i, db := range []*kvdb.KVDb{dbA, dbB} {
+		dblock := common.NewDBlock()
+		dblock.Header.Timestamp = uint32(i)
+		dblock.DBHash = nil
+		dblock.KeyMR = nil
+		if err := db.ProcessDBlockBatch(dblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report, err = kvdb.Diff(dbA, dbB, "a", "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found = false
+	for _, d := range report.Differences {
+		if strings.HasPrefix(d.Table, "TBL_DB") {
+			if found || d.Problem != "KeyMR differs" || d.What != "DBlock height 0" {
+				t.Errorf("diverged DBlock reported as: %v", d)
+			}
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("diverged DBlock not reported: %+v", report.Differences)
+	}
+}
+
+func TestCheckPruned(t *testing.T) {
+	db := memdb.NewMemDb()
+
+	var prev *common.EBlock
+	for height := uint32(0); height < 3; height++ {
+		entry := conformance.NewTestEntry("pruned " + strconv.Itoa(int(height)))
+		db.InsertEntry(entry)
+		eblock := common.NewEBlock()
+		eblock.Header.ChainID = entry.ChainID
+		eblock.Header.EBSequence = height
+		eblock.Header.EBHeight = height
+		if prev != nil {
+			eblock.Header.PrevKeyMR, _ = prev.KeyMR()
+		}
+		eblock.AddEBEntry(entry)
+		if err := db.ProcessEBlockBatch(eblock); err != nil {
+			t.Fatal(err)
+		}
+		dblock := common.NewDBlock()
+		dblock.Header.DBHeight = height
+		dblock.DBHash = nil
+		dblock.KeyMR = nil
+		dbEntry, _ := common.NewDBEntry(eblock)
+		dblock.DBEntries = append(dblock.DBEntries, dbEntry)
+		dblock.Header.BlockCount = 1
+		if err := db.ProcessDBlockBatch(dblock); err != nil {
+			t.Fatal(err)
+		}
+		prev = eblock
+	}
+
+	if pruned, err := db.PruneBelowHeight(2); err != nil || pruned != 2 {
+		t.Fatalf("PruneBelowHeight(2) = %v, %v", pruned, err)
+	}
+	report, err := db.(*kvdb.KVDb).Check(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("pruned db reported issues: %+v", report.Issues)
+	}
+}
+
+func TestSchemaVersion(t *testing.T) {
+	db := memdb.NewMemDb().(*kvdb.KVDb)
+
+	version, err := db.FetchSchemaVersion()
+	if err != nil || version != kvdb.SchemaVersion() {
+		t.Errorf("new db at schema version %v, want %v (err %v)", version, kvdb.SchemaVersion(), err)
+	}
+	reports, err := db.Migrate(true)
+	if err != nil || len(reports) != 0 {
+		t.Errorf("migrated db still has %v migrations to run (err %v)", len(reports), err)
+	}
+}
@@ -0,0 +1,236 @@
+package kvdb
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// schemaVersionKey holds the schema version of the database, which is the
+// number of migrations applied to it.
+var schemaVersionKey = []byte{byte(TBL_META), 's', 'c', 'h', 'e', 'm', 'a'}
+
+// migrationCursorKey holds, while a migration is only partly written, the
+// schema version it migrates to followed by the key to resume it from.
+var migrationCursorKey = []byte{byte(TBL_META), 'c', 'u', 'r', 's', 'o', 'r'}
+
+// migrationBatchSize is the number of writes after which a migration ends
+// its chunk. Each chunk is written in its own batch with the cursor of the
+// next one, so a migration never holds the whole reindex in memory.
+var migrationBatchSize = 10000
+
+// Migration upgrades the layout of the database by one schema version.
+// Migrate queues the writes of one chunk, starting at cursor (nil for the
+// first chunk), in db.lbatch and returns the cursor of the next chunk, nil
+// after the last one.
+type Migration struct {
+	Description string
+	Migrate     func(db *KVDb, cursor []byte) ([]byte, error)
+}
+
+// migrations is the ordered registry of schema migrations. The schema
+// version of a database is the number of migrations applied to it, so new
+// migrations must only ever be appended.
+var migrations = []Migration{
+	{"index entries by chain", (*KVDb).reindexEntriesByChainMultiBatch},
+	{"index entry locations", (*KVDb).reindexEntryLocationsMultiBatch},
+	{"store entry credit balances", (*KVDb).rebuildECBalancesMultiBatch},
+	{"store entry credit balance checkpoints", (*KVDb).rebuildECCheckpointsMultiBatch},
+	{"index external IDs", (*KVDb).reindexExtIDsMultiBatch},
+	{"store chain statistics", (*KVDb).rebuildChainStatsMultiBatch},
+	{"store factoid balance checkpoints", (*KVDb).rebuildFactoidCheckpointsMultiBatch},
+}
+
+// SchemaVersion is the schema version of a fully migrated database.
+func SchemaVersion() int32 {
+	return int32(len(migrations))
+}
+
+// MigrationReport describes a migration run by Migrate.
+type MigrationReport struct {
+	Version     int32 // schema version after the migration
+	Description string
+	Writes      int // number of keys written by the migration
+}
+
+// FetchSchemaVersion returns the schema version stored in the database. A
+// database written before versioning existed is at version 0.
+func (db *KVDb) FetchSchemaVersion() (int32, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	return db.fetchSchemaVersion()
+}
+
+func (db *KVDb) fetchSchemaVersion() (int32, error) {
+	data, err := db.store.Get(schemaVersionKey)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 4 {
+		return 0, fmt.Errorf("invalid schema version %x", data)
+	}
+	return int32(binary.BigEndian.Uint32(data)), nil
+}
+
+// fetchMigrationCursor returns the cursor to resume the migration to
+// version from, nil if it has not started.
+func (db *KVDb) fetchMigrationCursor(version int32) ([]byte, error) {
+	data, err := db.store.Get(migrationCursorKey)
+	if err == ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 4 {
+		return nil, fmt.Errorf("invalid migration cursor %x", data)
+	}
+	if int32(binary.BigEndian.Uint32(data)) != version {
+		return nil, nil
+	}
+	return data[4:], nil
+}
+
+// Migrate runs the migrations the database has not seen yet, in order. Each
+// migration is written in chunks of about migrationBatchSize writes, each
+// with the cursor of the next chunk, and the schema version is only bumped
+// with the last chunk, so an interrupted run resumes where it stopped. With
+// dryRun set the migrations are run but nothing is written, and the reports
+// tell what would be done; a migration that reads back its own earlier
+// chunks, like the balance checkpoints, then only gives an estimate.
+func (db *KVDb) Migrate(dryRun bool) (reports []MigrationReport, err error) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	version, err := db.fetchSchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+	if version > SchemaVersion() {
+		return nil, fmt.Errorf("db schema version %v is newer than the supported version %v", version, SchemaVersion())
+	}
+
+	db.lbatch = new(Batch)
+	defer func() {
+		db.lbatch = nil
+	}()
+
+	// A new database has nothing to migrate and starts at the current
+	// version
+	if version == 0 && !dryRun {
+		empty := true
+		err = db.store.Iterate(nil, nil, func(key, value []byte) error {
+			empty = false
+			return errPageFull
+		})
+		if err != nil && err != errPageFull {
+			return nil, err
+		}
+		if empty {
+			db.lbatch.Put(schemaVersionKey, schemaVersionBytes(SchemaVersion()))
+			return nil, db.store.Write(db.lbatch)
+		}
+	}
+
+	for ; version < SchemaVersion(); version++ {
+		m := migrations[version]
+		report := MigrationReport{Version: version + 1, Description: m.Description}
+
+		cursor, err := db.fetchMigrationCursor(version + 1)
+		if err != nil {
+			return reports, err
+		}
+		for {
+			db.lbatch.Reset()
+			cursor, err = m.Migrate(db, cursor)
+			if err != nil {
+				return reports, fmt.Errorf("migration to schema version %v (%v) failed: %v", version+1, m.Description, err)
+			}
+			report.Writes += db.lbatch.Len()
+			if dryRun {
+				if cursor == nil {
+					break
+				}
+				continue
+			}
+
+			if cursor != nil {
+				db.lbatch.Put(migrationCursorKey, append(schemaVersionBytes(version+1), cursor...))
+			} else {
+				db.lbatch.Delete(migrationCursorKey)
+				db.lbatch.Put(schemaVersionKey, schemaVersionBytes(version+1))
+			}
+			err = db.store.Write(db.lbatch)
+			if err != nil {
+				return reports, err
+			}
+			if cursor == nil {
+				break
+			}
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+func schemaVersionBytes(version int32) []byte {
+	bytes := make([]byte, 4)
+	binary.BigEndian.PutUint32(bytes, uint32(version))
+	return bytes
+}
+
+// migrateTables calls fn with the key, without the table prefix, and the
+// value of the records of tables, in that order, starting at the key
+// cursor, until db.lbatch holds migrationBatchSize writes. It returns the
+// key to resume from, nil after the last record. A chunk never spans two
+// tables, so the records of a table see the writes made for the tables
+// before it.
+func (db *KVDb) migrateTables(cursor []byte, tables []uint8, fn func(table uint8, key, value []byte) error) ([]byte, error) {
+	i := 0
+	if len(cursor) > 0 {
+		for i < len(tables) && tables[i] != cursor[0] {
+			i++
+		}
+		if i == len(tables) {
+			return nil, fmt.Errorf("invalid migration cursor %x", cursor)
+		}
+	}
+
+	for ; i < len(tables); i++ {
+		table := tables[i]
+		var fromkey = []byte{byte(table)}
+		if len(cursor) > 0 && cursor[0] == table {
+			fromkey = cursor
+		} else if db.lbatch.Len() > 0 {
+			return fromkey, nil
+		}
+		var tokey = []byte{byte(table + 1)}
+
+		var next []byte
+		err := db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
+			if db.lbatch.Len() >= migrationBatchSize {
+				next = key
+				return errPageFull
+			}
+			if table == TBL_ENTRY || table == TBL_EB {
+				var err error
+				value, err = decodeValue(table, key[1:], value)
+				if err != nil {
+					return err
+				}
+			}
+			return fn(table, key[1:], value)
+		})
+		if err == errPageFull {
+			return next, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
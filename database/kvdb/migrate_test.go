@@ -0,0 +1,162 @@
+package kvdb
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/conformance"
+)
+
+// mapStore is a Store whose Write fails after failAfter writes, if set.
+type mapStore struct {
+	m         map[string][]byte
+	writes    int
+	failAfter int
+}
+
+func (s *mapStore) Get(key []byte) ([]byte, error) {
+	v, ok := s.m[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return v, nil
+}
+
+func (s *mapStore) Iterate(fromkey, tokey []byte, fn func(key, value []byte) error) error {
+	var keys []string
+	for k := range s.m {
+		if bytes.Compare([]byte(k), fromkey) >= 0 && (len(tokey) == 0 || bytes.Compare([]byte(k), tokey) < 0) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := fn([]byte(k), s.m[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *mapStore) Write(b *Batch) error {
+	if s.failAfter > 0 && s.writes >= s.failAfter {
+		return errors.New("write failed")
+	}
+	s.writes++
+	for _, op := range b.Ops {
+		if op.Delete {
+			delete(s.m, string(op.Key))
+		} else {
+			s.m[string(op.Key)] = op.Value
+		}
+	}
+	return nil
+}
+
+func (s *mapStore) Sync() error          { return nil }
+func (s *mapStore) Close() error         { return nil }
+func (s *mapStore) RollbackClose() error { return nil }
+
+func TestMigrateChunks(t *testing.T) {
+	store := &mapStore{m: make(map[string][]byte)}
+	db, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := uint32(0); i <= 2*database.ECCheckpointInterval+1; i++ {
+		increase := common.NewIncreaseBalance()
+		increase.ECPubKey = new([32]byte)
+		increase.ECPubKey[0] = byte(i % 5)
+		increase.NumEC = 1
+		increase.Index = uint64(i)
+		ecBlock := common.NewECBlock()
+		ecBlock.Header.EBHeight = i
+		ecBlock.AddEntry(increase)
+		if err := db.ProcessECBlockBatch(ecBlock); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 30; i++ {
+		entry := conformance.NewTestEntry("migrate " + strconv.Itoa(i))
+		entry.ChainID = common.Sha([]byte("migrate " + strconv.Itoa(i%3)))
+		entry.ExtIDs = append(entry.ExtIDs, []byte("Migrate"))
+		db.InsertEntry(entry)
+		eblock := common.NewEBlock()
+		eblock.Header.ChainID = entry.ChainID
+		eblock.Header.EBSequence = uint32(i / 3)
+		eblock.AddEBEntry(entry)
+		if err := db.ProcessEBlockBatch(eblock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	migrated := make(map[string][]byte)
+	for k, v := range store.m {
+		migrated[k] = v
+	}
+
+	// Drop the indexes the migrations build, leave a stale balance and go
+	// back to a database without versioning
+	for k := range store.m {
+		switch k[0] {
+		case TBL_CHAIN_ENTRY, TBL_ENTRY_LOCATION, TBL_DB_ENTRY_HEIGHT, TBL_EC_BALANCE, TBL_EC_CHECKPOINT, TBL_FCT_CHECKPOINT, TBL_EXTID, TBL_CHAIN_EXTID, TBL_CHAIN_STATS, TBL_META:
+			delete(store.m, k)
+		}
+	}
+	store.m[string([]byte{TBL_EC_BALANCE, 9})] = []byte{1}
+
+	defer func(size int) {
+		migrationBatchSize = size
+	}(migrationBatchSize)
+	migrationBatchSize = 7
+
+	// An interrupted run leaves a cursor and resumes from it
+	store.writes = 0
+	store.failAfter = 50
+	if _, err := db.Migrate(false); err == nil {
+		t.Fatal("Migrate did not fail")
+	}
+	if version, _ := db.FetchSchemaVersion(); version >= SchemaVersion() {
+		t.Fatalf("interrupted migration at schema version %v", version)
+	}
+	if _, ok := store.m[string(migrationCursorKey)]; !ok {
+		t.Fatal("interrupted migration left no cursor")
+	}
+
+	store.failAfter = 0
+	reports, err := db.Migrate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) == 0 {
+		t.Fatal("resumed migration ran nothing")
+	}
+	if store.writes <= 50+len(reports) {
+		t.Errorf("migrations written in %v batches, not in chunks", store.writes)
+	}
+	if _, ok := store.m[string(migrationCursorKey)]; ok {
+		t.Error("finished migration left its cursor")
+	}
+
+	for k, v := range migrated {
+		if got, ok := store.m[k]; !ok || !bytes.Equal(got, v) {
+			t.Errorf("key %x is %x after the migration, want %x", k, got, v)
+		}
+	}
+	for k := range store.m {
+		if _, ok := migrated[k]; !ok {
+			t.Errorf("key %x left by the migration", k)
+		}
+	}
+
+	hashes, _, err := db.FetchEntryHashesByExtID([]byte("MIGRATE"), false, true, nil, nil, 0)
+	if err != nil || len(hashes) != 30 {
+		t.Errorf("FetchEntryHashesByExtID(MIGRATE) after the migration = %v hashes, %v", len(hashes), err)
+	}
+}
@@ -0,0 +1,215 @@
+package kvdb
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// prunedHeightKey holds the directory block height below which the database
+// has been pruned, under the same key as in LevelDB.
+var prunedHeightKey = []byte{byte(TBL_META), 'p', 'r', 'u', 'n', 'e', 'd'}
+
+// FetchPrunedHeight returns the height below which the database has been
+// pruned, 0 if it never was.
+func (db *KVDb) FetchPrunedHeight() (uint32, error) {
+	db.dbLock.RLock()
+	defer db.dbLock.RUnlock()
+
+	return db.fetchPrunedHeight()
+}
+
+func (db *KVDb) fetchPrunedHeight() (uint32, error) {
+	data, err := db.store.Get(prunedHeightKey)
+	if err == ErrNotFound {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if len(data) != 4 {
+		return 0, fmt.Errorf("invalid pruned height %x", data)
+	}
+	return binary.BigEndian.Uint32(data), nil
+}
+
+// pruneBatchSize is the number of writes after which PruneBelowHeight
+// writes what it pruned so far, together with the pruned height reached.
+var pruneBatchSize = 10000
+
+// PruneBelowHeight deletes the entries and entry block bodies recorded in
+// the directory blocks below height, picking up where the last call
+// stopped. The entry blocks are replaced by their headers, see
+// database.PrunedEBlockValue, and every other block and cross reference is
+// kept. It is written in chunks of about pruneBatchSize writes, each
+// consistent on its own.
+func (db *KVDb) PruneBelowHeight(height uint32) (int, error) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	db.lbatch = new(Batch)
+	defer func() {
+		db.lbatch = nil
+	}()
+
+	total := 0
+	for {
+		db.lbatch.Reset()
+		pruned, done, err := db.pruneBelowHeightMultiBatch(height)
+		if err != nil {
+			return total, err
+		}
+
+		err = db.store.Write(db.lbatch)
+		if err != nil {
+			return total, err
+		}
+		total += pruned
+		if done {
+			return total, nil
+		}
+	}
+}
+
+// pruneBelowHeightMultiBatch queues the pruning of a chunk of the directory
+// blocks from the pruned height up to height. It returns the number of
+// entry blocks pruned and whether it reached height.
+func (db *KVDb) pruneBelowHeightMultiBatch(height uint32) (pruned int, done bool, err error) {
+	if db.lbatch == nil {
+		return 0, false, fmt.Errorf("db.lbatch == nil")
+	}
+
+	from, err := db.fetchPrunedHeight()
+	if err != nil {
+		return 0, false, err
+	}
+
+	h := from
+	done = true
+	for ; h < height; h++ {
+		if db.lbatch.Len() >= pruneBatchSize {
+			done = false
+			break
+		}
+
+		var key []byte = []byte{byte(TBL_DB_NUM)}
+		num := make([]byte, 4)
+		binary.BigEndian.PutUint32(num, h)
+		key = append(key, num...)
+		dbHash, err := db.store.Get(key)
+		if err == ErrNotFound {
+			break
+		}
+		if err != nil {
+			return 0, false, err
+		}
+
+		data, err := db.store.Get(append([]byte{byte(TBL_DB)}, dbHash...))
+		if err != nil {
+			return 0, false, err
+		}
+		dblock := common.NewDBlock()
+		_, err = dblock.UnmarshalBinaryData(data)
+		if err != nil {
+			return 0, false, err
+		}
+
+		for _, dbEntry := range dblock.DBEntries {
+			ok, err := db.pruneEBlockMultiBatch(dbEntry.KeyMR, h)
+			if err != nil {
+				return 0, false, err
+			}
+			if ok {
+				pruned++
+			}
+		}
+	}
+
+	if h > from {
+		num := make([]byte, 4)
+		binary.BigEndian.PutUint32(num, h)
+		db.lbatch.Put(prunedHeightKey, num)
+	}
+	return pruned, done, nil
+}
+
+// pruneEBlockMultiBatch queues the pruning of the entry block with keyMR,
+// listed in the directory block at height, and of its entries that are not
+// recorded again above height, and reports whether it did. An entry is
+// pruned with the latest block recording it, so every chunk of a prune
+// leaves the entries of the blocks above the pruned height in place. The
+// admin, entry credit and factoid blocks, which are not entry blocks, and
+// the blocks pruned before are left alone.
+func (db *KVDb) pruneEBlockMultiBatch(keyMR *common.Hash, height uint32) (bool, error) {
+	ebHash, err := db.store.Get(append([]byte{byte(TBL_EB_MR)}, keyMR.Bytes()...))
+	if err == ErrNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	data, err := db.getValue(TBL_EB, ebHash)
+	if err != nil {
+		return false, err
+	}
+	eblock, err := database.UnmarshalStoredEBlock(data)
+	if err == database.ErrPruned {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	for i, ebEntry := range eblock.Body.EBEntries {
+		if ebEntry.IsMinuteMarker() {
+			continue
+		}
+		db.lbatch.Delete(chainEntryKey(eblock.Header.ChainID, eblock.Header.EBSequence, uint32(i)))
+
+		// An entry is located in the latest entry block recording it
+		location, err := db.fetchEntryLocation(ebEntry)
+		if err != nil {
+			return false, err
+		}
+		if location != nil && location.DBHeight > height {
+			continue
+		}
+
+		// An entry that cannot be read has no external IDs to unindex
+		entryData, _ := db.getValue(TBL_ENTRY, ebEntry.Bytes())
+		if entryData != nil {
+			entry := new(common.Entry)
+			if _, err := entry.UnmarshalBinaryData(entryData); err == nil {
+				db.unindexExtIDsMultiBatch(entry)
+			}
+		}
+		db.lbatch.Delete(append([]byte{byte(TBL_ENTRY)}, ebEntry.Bytes()...))
+	}
+
+	value, err := database.PrunedEBlockValue(eblock)
+	if err != nil {
+		return false, err
+	}
+	db.lbatch.Put(append([]byte{byte(TBL_EB)}, ebHash...), value)
+	return true, nil
+}
+
+// prunedEntryError returns database.ErrPruned for an entry that is missing
+// because it was pruned, and nil otherwise. The caller holds the lock.
+func (db *KVDb) prunedEntryError(entryHash *common.Hash) error {
+	prunedHeight, err := db.fetchPrunedHeight()
+	if err != nil || prunedHeight == 0 {
+		return err
+	}
+	location, err := db.fetchEntryLocation(entryHash)
+	if err != nil {
+		return err
+	}
+	if location != nil && location.DBHeight < prunedHeight {
+		return database.ErrPruned
+	}
+	return nil
+}
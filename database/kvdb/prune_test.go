@@ -0,0 +1,99 @@
+package kvdb
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database/conformance"
+)
+
+// newPruneTestDb returns a database with an entry block of one entry in
+// each of the directory blocks 0 to 5. The entry of height 1 is recorded
+// again at height 4.
+func newPruneTestDb(t *testing.T) (*KVDb, *mapStore) {
+	store := &mapStore{m: make(map[string][]byte)}
+	db, err := Open(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var again *common.Entry
+	var prev *common.EBlock
+	for height := uint32(0); height < 6; height++ {
+		entry := conformance.NewTestEntry("pruned " + strconv.Itoa(int(height)))
+		db.InsertEntry(entry)
+		eblock := common.NewEBlock()
+		eblock.Header.ChainID = entry.ChainID
+		eblock.Header.EBSequence = height
+		eblock.Header.EBHeight = height
+		if prev != nil {
+			eblock.Header.PrevKeyMR, _ = prev.KeyMR()
+		}
+		eblock.AddEBEntry(entry)
+		if height == 1 {
+			again = entry
+		}
+		if height == 4 {
+			eblock.AddEBEntry(again)
+		}
+		if err := db.ProcessEBlockBatch(eblock); err != nil {
+			t.Fatal(err)
+		}
+		dblock := common.NewDBlock()
+		dblock.Header.DBHeight = height
+		dblock.DBHash = nil
+		dblock.KeyMR = nil
+		dbEntry, _ := common.NewDBEntry(eblock)
+		dblock.DBEntries = append(dblock.DBEntries, dbEntry)
+		dblock.Header.BlockCount = 1
+		if err := db.ProcessDBlockBatch(dblock); err != nil {
+			t.Fatal(err)
+		}
+		prev = eblock
+	}
+	return db, store
+}
+
+func TestPruneChunks(t *testing.T) {
+	db, store := newPruneTestDb(t)
+	pruned, err := db.PruneBelowHeight(4)
+	if err != nil || pruned != 4 {
+		t.Fatalf("PruneBelowHeight(4) = %v, %v", pruned, err)
+	}
+
+	defer func(size int) {
+		pruneBatchSize = size
+	}(pruneBatchSize)
+	pruneBatchSize = 1
+
+	chunkedDb, chunkedStore := newPruneTestDb(t)
+	chunkedStore.writes = 0
+	pruned, err = chunkedDb.PruneBelowHeight(4)
+	if err != nil || pruned != 4 {
+		t.Fatalf("PruneBelowHeight(4) in chunks = %v, %v", pruned, err)
+	}
+	if chunkedStore.writes < 4 {
+		t.Errorf("prune written in %v batches, not in chunks", chunkedStore.writes)
+	}
+
+	for k, v := range store.m {
+		if got, ok := chunkedStore.m[k]; !ok || !bytes.Equal(got, v) {
+			t.Errorf("key %x is %x after a prune in chunks, want %x", k, got, v)
+		}
+	}
+	for k := range chunkedStore.m {
+		if _, ok := store.m[k]; !ok {
+			t.Errorf("key %x left by a prune in chunks", k)
+		}
+	}
+
+	report, err := chunkedDb.Check(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 0 {
+		t.Errorf("db pruned in chunks reported issues: %+v", report.Issues)
+	}
+}
@@ -0,0 +1,358 @@
+package kvdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/btcd/wire"
+)
+
+// RollbackToHeight deletes every directory, admin, entry credit, factoid and
+// entry block above the directory block height, the entries only they
+// reference and all of their cross references, and moves the chain heads
+// and the block height caches back to the blocks at height. It is written
+// in a single batch.
+func (db *KVDb) RollbackToHeight(height uint32) error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	if db.lbatch == nil {
+		db.lbatch = new(Batch)
+	}
+	defer db.lbatch.Reset()
+
+	dbHash, err := db.rollbackMultiBatch(height)
+	if err != nil {
+		return err
+	}
+
+	err = db.store.Write(db.lbatch)
+	if err != nil {
+		return err
+	}
+
+	// Reset the DirBlock Height caches
+	if dbHash != nil {
+		db.lastDirBlkHeight = int64(height)
+		db.lastDirBlkSha, _ = wire.NewShaHash(dbHash)
+		db.lastDirBlkShaCached = true
+	} else {
+		db.lastDirBlkHeight = -1
+		db.lastDirBlkSha = nil
+		db.lastDirBlkShaCached = false
+	}
+	if db.nextDirBlockHeight > int64(height)+1 {
+		db.nextDirBlockHeight = int64(height) + 1
+	}
+	return nil
+}
+
+// rollbackMultiBatch queues the deletes and chain head updates of
+// RollbackToHeight and returns the hash of the directory block at height,
+// or nil if there is none.
+func (db *KVDb) rollbackMultiBatch(height uint32) (dbHash []byte, err error) {
+	if db.lbatch == nil {
+		return nil, fmt.Errorf("db.lbatch == nil")
+	}
+
+	// The entry blocks and entries below the pruned height are gone, so
+	// the database cannot go back to a height before it
+	prunedHeight, err := db.fetchPrunedHeight()
+	if err != nil {
+		return nil, err
+	}
+	if uint64(height)+1 < uint64(prunedHeight) {
+		return nil, fmt.Errorf("cannot roll back to height %v, the database is pruned below height %v", height, prunedHeight)
+	}
+
+	// Directory blocks
+	var dHead []byte
+	dRemoved := false
+	err = db.forEach(TBL_DB_NUM, func(key, value []byte) error {
+		if len(key) != 4 || binary.BigEndian.Uint32(key) < height {
+			return nil
+		}
+
+		dblock := common.NewDBlock()
+		data, _ := db.store.Get(append([]byte{byte(TBL_DB)}, value...))
+		if data != nil {
+			_, err := dblock.UnmarshalBinaryData(data)
+			if err != nil {
+				return err
+			}
+			dblock.BuildKeyMerkleRoot()
+		}
+
+		if binary.BigEndian.Uint32(key) == height {
+			dbHash = value
+			if data != nil {
+				dHead = dblock.KeyMR.Bytes()
+			}
+			return nil
+		}
+
+		dRemoved = true
+		db.lbatch.Delete(append([]byte{byte(TBL_DB_NUM)}, key...))
+		db.lbatch.Delete(append([]byte{byte(TBL_DB)}, value...))
+		db.lbatch.Delete(append([]byte{byte(TBL_DB_INFO)}, value...))
+		if data != nil {
+			db.lbatch.Delete(append([]byte{byte(TBL_DB_MR)}, dblock.KeyMR.Bytes()...))
+			for _, dbEntry := range dblock.DBEntries {
+				db.lbatch.Delete(append([]byte{byte(TBL_DB_ENTRY_HEIGHT)}, dbEntry.KeyMR.Bytes()...))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if dRemoved {
+		db.rollbackChainHead(common.D_CHAINID, dHead)
+	}
+
+	// Entry credit balances, before the entry credit blocks go
+	ecChanges, err := db.ecBalanceChangesAbove(int64(height))
+	if err != nil {
+		return nil, err
+	}
+	_, err = db.updateECBalancesMultiBatch(ecChanges, true)
+	if err != nil {
+		return nil, err
+	}
+	err = db.forEach(TBL_EC_CHECKPOINT, func(key, value []byte) error {
+		if binary.BigEndian.Uint32(key) > height {
+			db.lbatch.Delete(append([]byte{byte(TBL_EC_CHECKPOINT)}, key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = db.forEach(TBL_FCT_CHECKPOINT, func(key, value []byte) error {
+		if binary.BigEndian.Uint32(key) > height {
+			db.lbatch.Delete(append([]byte{byte(TBL_FCT_CHECKPOINT)}, key...))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Admin, entry credit and factoid blocks, whose heights are directory
+	// block heights
+	heightTables := []struct {
+		numTable, blockTable uint8
+		chainID              []byte
+	}{
+		{TBL_AB_NUM, TBL_AB, common.ADMIN_CHAINID},
+		{TBL_CB_NUM, TBL_CB, common.EC_CHAINID},
+		{TBL_SC_NUM, TBL_SC, common.FACTOID_CHAINID},
+	}
+	for _, t := range heightTables {
+		head, removed, err := db.truncateHeightTable(t.numTable, t.blockTable, t.chainID, height)
+		if err != nil {
+			return nil, err
+		}
+		if removed {
+			db.rollbackChainHead(t.chainID, head)
+		}
+	}
+
+	// Entry blocks
+	firstRemoved := make(map[string]uint32) // chain ID -> lowest removed sequence
+	removedStats := make(map[string]*database.ChainStats)
+	removedEntries := make(map[string]bool)
+	err = db.forEach(TBL_EB, func(key, value []byte) error {
+		// Pruned blocks are all at or below height
+		eblock, err := database.UnmarshalStoredEBlock(value)
+		if err == database.ErrPruned {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if eblock.Header.EBHeight <= height {
+			return nil
+		}
+
+		keyMR, err := eblock.KeyMR()
+		if err != nil {
+			return err
+		}
+		chainID := eblock.Header.ChainID.Bytes()
+		seq := eblock.Header.EBSequence
+
+		db.lbatch.Delete(append([]byte{byte(TBL_EB)}, key...))
+		db.lbatch.Delete(append([]byte{byte(TBL_EB_MR)}, keyMR.Bytes()...))
+		chainNum := make([]byte, 4)
+		binary.BigEndian.PutUint32(chainNum, seq)
+		db.lbatch.Delete(append(append([]byte{byte(TBL_EB_CHAIN_NUM)}, chainID...), chainNum...))
+		for i, ebEntry := range eblock.Body.EBEntries {
+			if ebEntry.IsMinuteMarker() {
+				continue
+			}
+			db.lbatch.Delete(chainEntryKey(eblock.Header.ChainID, seq, uint32(i)))
+			removedEntries[string(ebEntry.Bytes())] = true
+		}
+
+		if first, ok := firstRemoved[string(chainID)]; !ok || seq < first {
+			firstRemoved[string(chainID)] = seq
+		}
+
+		change, err := database.EBlockChainStats(eblock, db.fetchStatsEntry)
+		if err != nil {
+			return err
+		}
+		if removedStats[string(chainID)] == nil {
+			removedStats[string(chainID)] = &database.ChainStats{ChainID: eblock.Header.ChainID}
+		}
+		removedStats[string(chainID)].Add(change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries also recorded in a remaining entry block are kept and located
+	// in the latest of them
+	kept := make(map[string]*database.EntryLocation)
+	if len(removedEntries) > 0 {
+		err = db.forEach(TBL_EB, func(key, value []byte) error {
+			// Pruned blocks no longer record any entries
+			eblock, err := database.UnmarshalStoredEBlock(value)
+			if err == database.ErrPruned {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if eblock.Header.EBHeight > height {
+				return nil
+			}
+
+			locations, err := database.EntryLocations(eblock)
+			if err != nil {
+				return err
+			}
+			for entryHash, location := range locations {
+				k := string(entryHash.Bytes())
+				if !removedEntries[k] {
+					continue
+				}
+				if l, ok := kept[k]; !ok || location.DBHeight >= l.DBHeight {
+					kept[k] = location
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for entryHash := range removedEntries {
+		key := append([]byte{byte(TBL_ENTRY_LOCATION)}, entryHash...)
+		if location, ok := kept[entryHash]; ok {
+			binaryLocation, err := location.MarshalBinary()
+			if err != nil {
+				return nil, err
+			}
+			db.lbatch.Put(key, binaryLocation)
+			continue
+		}
+		db.lbatch.Delete(key)
+		db.lbatch.Delete(append([]byte{byte(TBL_ENTRY)}, entryHash...))
+
+		// An entry that cannot be read has no external IDs to unindex
+		data, _ := db.getValue(TBL_ENTRY, []byte(entryHash))
+		if data != nil {
+			entry := new(common.Entry)
+			if _, err := entry.UnmarshalBinaryData(data); err == nil {
+				db.unindexExtIDsMultiBatch(entry)
+			}
+		}
+	}
+
+	// Move the entry chain heads and statistics back, dropping the chains
+	// created above height
+	for chainID, first := range firstRemoved {
+		if first == 0 {
+			db.lbatch.Delete(append([]byte{byte(TBL_CHAIN_HASH)}, chainID...))
+			db.lbatch.Delete(append([]byte{byte(TBL_CHAIN_STATS)}, chainID...))
+			db.rollbackChainHead([]byte(chainID), nil)
+			continue
+		}
+
+		chainNum := make([]byte, 4)
+		binary.BigEndian.PutUint32(chainNum, first-1)
+		ebHash, _ := db.store.Get(append(append([]byte{byte(TBL_EB_CHAIN_NUM)}, chainID...), chainNum...))
+		data, _ := db.getValue(TBL_EB, ebHash)
+		if ebHash == nil || data == nil {
+			db.rollbackChainHead([]byte(chainID), nil)
+			continue
+		}
+		// A pruned block keeps its KeyMR in its header
+		eblock, err := database.UnmarshalStoredEBlock(data)
+		var keyMR *common.Hash
+		if err == database.ErrPruned {
+			keyMR, err = eblock.HeaderKeyMR()
+		} else if err == nil {
+			keyMR, err = eblock.KeyMR()
+		}
+		if err != nil {
+			return nil, err
+		}
+		db.rollbackChainHead([]byte(chainID), keyMR.Bytes())
+
+		stats, err := db.fetchChainStats(eblock.Header.ChainID)
+		if err != nil {
+			return nil, err
+		}
+		if stats != nil {
+			stats.Sub(removedStats[chainID])
+			stats.LastHeight = eblock.Header.EBHeight
+			err = db.putChainStatsMultiBatch(stats)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return dbHash, nil
+}
+
+// truncateHeightTable queues the deletes of the blocks of a chain above
+// height, along with their height cross references, and returns the hash of
+// the block at height and whether anything was removed.
+func (db *KVDb) truncateHeightTable(numTable, blockTable uint8, chainID []byte, height uint32) (head []byte, removed bool, err error) {
+	err = db.forEach(numTable, func(key, value []byte) error {
+		if len(key) != len(chainID)+4 || !bytes.HasPrefix(key, chainID) {
+			return nil
+		}
+		h := binary.BigEndian.Uint32(key[len(chainID):])
+		if h == height {
+			head = value
+		}
+		if h <= height {
+			return nil
+		}
+		removed = true
+		db.lbatch.Delete(append([]byte{byte(numTable)}, key...))
+		db.lbatch.Delete(append([]byte{byte(blockTable)}, value...))
+		return nil
+	})
+	return head, removed, err
+}
+
+// rollbackChainHead points the head of a chain at head, or removes it if
+// head is nil.
+func (db *KVDb) rollbackChainHead(chainID []byte, head []byte) {
+	key := append([]byte{byte(TBL_CHAIN_HEAD)}, chainID...)
+	if head == nil {
+		db.lbatch.Delete(key)
+		return
+	}
+	db.lbatch.Put(key, head)
+}
@@ -1,4 +1,4 @@
-package ldb
+package kvdb
 
 import (
 	"bytes"
@@ -7,13 +7,10 @@ import (
 
 	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/factoid/block"
-	"github.com/FactomProject/goleveldb/leveldb"
-	"github.com/FactomProject/goleveldb/leveldb/iterator"
-	"github.com/FactomProject/goleveldb/leveldb/util"
 )
 
 // ProcessFBlockBatch inserts the factoid block
-func (db *LevelDb) ProcessFBlockBatch(block block.IFBlock) error {
+func (db *KVDb) ProcessFBlockBatch(block block.IFBlock) error {
 	if block == nil {
 		return nil
 	}
@@ -21,7 +18,7 @@ func (db *LevelDb) ProcessFBlockBatch(block block.IFBlock) error {
 	defer db.dbLock.Unlock()
 
 	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+		db.lbatch = new(Batch)
 	}
 	defer db.lbatch.Reset()
 
@@ -30,15 +27,10 @@ func (db *LevelDb) ProcessFBlockBatch(block block.IFBlock) error {
 		return err
 	}
 
-	err = db.lDb.Write(db.lbatch, db.wo)
-	if err != nil {
-		fmt.Printf("batch failed %v\n", err)
-		return err
-	}
-	return nil
+	return db.store.Write(db.lbatch)
 }
 
-func (db *LevelDb) ProcessFBlockMultiBatch(block block.IFBlock) error {
+func (db *KVDb) ProcessFBlockMultiBatch(block block.IFBlock) error {
 	if block == nil {
 		return nil
 	}
@@ -72,16 +64,15 @@ func (db *LevelDb) ProcessFBlockMultiBatch(block block.IFBlock) error {
 	key = append(key, common.FACTOID_CHAINID...)
 	db.lbatch.Put(key, scHash.Bytes())
 
-	return nil
+	return db.processFactoidCheckpointMultiBatch(block)
 }
 
 // FetchFBlockByHash gets an factoid block by hash from the database.
-func (db *LevelDb) FetchFBlockByHash(hash *common.Hash) (FBlock block.IFBlock, err error) {
+func (db *KVDb) FetchFBlockByHash(hash *common.Hash) (FBlock block.IFBlock, err error) {
 	var key = []byte{byte(TBL_SC)}
 	key = append(key, hash.Bytes()...)
-	var data []byte
 	db.dbLock.RLock()
-	data, err = db.lDb.Get(key, db.ro)
+	data, _ := db.store.Get(key)
 	db.dbLock.RUnlock()
 
 	if data != nil {
@@ -95,53 +86,50 @@ func (db *LevelDb) FetchFBlockByHash(hash *common.Hash) (FBlock block.IFBlock, e
 }
 
 // FetchFBlockByHeight gets an factoid block by hash from the database.
-func (db *LevelDb) FetchFBlockByHeight(height uint32) (block.IFBlock, error) {
+func (db *KVDb) FetchFBlockByHeight(height uint32) (block.IFBlock, error) {
 	var key = []byte{byte(TBL_SC_NUM)}
 	var buf bytes.Buffer
 	binary.Write(&buf, binary.BigEndian, height)
 	key = append(key, common.FACTOID_CHAINID...)
 	key = append(key, buf.Bytes()...)
 
-	var data []byte
-	var err error
 	db.dbLock.RLock()
-	data, err = db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 	db.dbLock.RUnlock()
 	if err != nil {
 		return nil, err
 	}
 
-	ecBlockHash := common.NewHash()
-	_, err = ecBlockHash.UnmarshalBinaryData(data)
+	fBlockHash := common.NewHash()
+	_, err = fBlockHash.UnmarshalBinaryData(data)
 	if err != nil {
 		return nil, err
 	}
-	return db.FetchFBlockByHash(ecBlockHash)
+	return db.FetchFBlockByHash(fBlockHash)
 }
 
 // FetchAllFBlocks gets all of the factoid blocks
-func (db *LevelDb) FetchAllFBlocks() (FBlocks []block.IFBlock, err error) {
+func (db *KVDb) FetchAllFBlocks() (FBlocks []block.IFBlock, err error) {
 	db.dbLock.RLock()
 	defer db.dbLock.RUnlock()
 
-	var fromkey = []byte{byte(TBL_SC)}   // Table Name (1 bytes)						// Timestamp  (8 bytes)
+	var fromkey = []byte{byte(TBL_SC)}   // Table Name (1 bytes)
 	var tokey = []byte{byte(TBL_SC + 1)} // Table Name (1 bytes)
-	var iter iterator.Iterator
 	FBlockSlice := make([]block.IFBlock, 0, 10)
-	iter = db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
 
-	for iter.Next() {
+	err = db.store.Iterate(fromkey, tokey, func(key, value []byte) error {
 		FBlock := new(block.FBlock)
-		_, err := FBlock.UnmarshalBinaryData(iter.Value())
+		_, err := FBlock.UnmarshalBinaryData(value)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		FBlockSlice = append(FBlockSlice, FBlock)
-
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	iter.Release()
-	err = iter.Error()
 
 	return FBlockSlice, nil
 }
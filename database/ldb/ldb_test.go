@@ -0,0 +1,61 @@
+package ldb_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/conformance"
+	"github.com/FactomProject/FactomCode/database/kvdb"
+	"github.com/FactomProject/FactomCode/database/ldb"
+)
+
+func TestConformance(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	n := 0
+	conformance.RunTests(t, func() database.Db {
+		n++
+		db, err := ldb.OpenLevelDB(filepath.Join(dir, strconv.Itoa(n)), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dbpath := filepath.Join(dir, "migrate")
+	db, err := ldb.OpenLevelDB(dbpath, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := db.(*kvdb.KVDb).FetchSchemaVersion()
+	if err != nil || version != kvdb.SchemaVersion() {
+		t.Errorf("new db at schema version %v, want %v (err %v)", version, kvdb.SchemaVersion(), err)
+	}
+	db.Close()
+
+	kdb, err := ldb.Open(dbpath, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kdb.Close()
+	reports, err := kdb.Migrate(true)
+	if err != nil || len(reports) != 0 {
+		t.Errorf("migrated db still has %v migrations to run (err %v)", len(reports), err)
+	}
+}
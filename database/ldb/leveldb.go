@@ -2,6 +2,8 @@
 // Use of this source code is governed by an ISC
 // license that can be found in the LICENSE file.
 
+// Package ldb implements database.Db on a LevelDB directory. It is a
+// kvdb.Store backend: the tables themselves are laid out by database/kvdb.
 package ldb
 
 import (
@@ -9,121 +11,55 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"strconv"
-	"sync"
 
 	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kvdb"
 
-	"github.com/FactomProject/btcd/wire"
 	"github.com/FactomProject/goleveldb/leveldb"
-	//	"github.com/FactomProject/goleveldb/leveldb/cache"
 	"github.com/FactomProject/goleveldb/leveldb/opt"
+	"github.com/FactomProject/goleveldb/leveldb/util"
 )
 
-const (
-	dbVersion     int = 2
-	dbMaxTransCnt     = 20000
-	dbMaxTransMem     = 64 * 1024 * 1024 // 64 MB
-)
-
-// the "table" prefix
-const (
-
-	// Directory Block
-	TBL_DB uint8 = iota
-	TBL_DB_NUM
-	TBL_DB_MR
-	TBL_DB_INFO
-
-	// Admin Block
-	TBL_AB //4
-	TBL_AB_NUM
-
-	TBL_SC
-	TBL_SC_NUM
-
-	// Entry Credit Block
-	TBL_CB //8
-	TBL_CB_NUM
-	TBL_CB_MR
-
-	// Entry Chain
-	TBL_CHAIN_HASH //11
-
-	// The latest Block MR for chains including special chains
-	TBL_CHAIN_HEAD
-
-	// Entry Block
-	TBL_EB //13
-	TBL_EB_CHAIN_NUM
-	TBL_EB_MR
-
-	//Entry
-	TBL_ENTRY
-)
-
-// the process status in db
-const (
-	STATUS_IN_QUEUE uint8 = iota
-	STATUS_PROCESSED
-)
-
-var currentChainType uint32 = 1
-
-var isLookupDB bool = true // to be put in property file
-
-type tTxInsertData struct {
-	txsha   *wire.ShaHash
-	blockid int64
-	txoff   int
-	txlen   int
-	usedbuf []byte
-}
-
-type LevelDb struct {
-	// lock preventing multiple entry
-	dbLock sync.RWMutex
+var CurrentDBVersion int32 = 1
 
-	// leveldb pieces
+// levelStore is a kvdb.Store backed by a LevelDB directory.
+type levelStore struct {
 	lDb *leveldb.DB
 	ro  *opt.ReadOptions
 	wo  *opt.WriteOptions
-
-	lbatch *leveldb.Batch
-
-	nextDirBlockHeight int64
-
-	lastDirBlkShaCached bool
-	lastDirBlkSha       *wire.ShaHash
-	lastDirBlkHeight    int64
 }
 
-var CurrentDBVersion int32 = 1
+// OpenLevelDB opens the database at dbpath and migrates it to the current
+// schema version.
+func OpenLevelDB(dbpath string, create bool) (database.Db, error) {
+	s, err := openStore(dbpath, create)
+	if err != nil {
+		return nil, err
+	}
+	kdb, err := kvdb.Open(s)
+	if err != nil {
+		return nil, err
+	}
+	return kdb, nil
+}
 
-func OpenLevelDB(dbpath string, create bool) (pbdb database.Db, err error) {
-	return openDB(dbpath, create)
+// Open opens the database at dbpath without migrating it, for the tools
+// that inspect a database as it is.
+func Open(dbpath string, create bool) (*kvdb.KVDb, error) {
+	s, err := openStore(dbpath, create)
+	if err != nil {
+		return nil, err
+	}
+	return kvdb.New(s), nil
 }
 
-func openDB(dbpath string, create bool) (pbdb database.Db, err error) {
-	var db LevelDb
-	var tlDb *leveldb.DB
+func openStore(dbpath string, create bool) (s *levelStore, err error) {
 	var dbversion int32
 
-	defer func() {
-		if err == nil {
-			db.lDb = tlDb
-
-			// Initialize db
-			db.lastDirBlkHeight = -1
-
-			pbdb = &db
-		}
-	}()
-
 	if create == true {
 		err = os.MkdirAll(dbpath, 0750)
 		if err != nil {
-			log.Println("mkdir failed %v %v", dbpath, err)
+			log.Printf("mkdir failed %v %v\n", dbpath, err)
 			return
 		}
 	} else {
@@ -164,7 +100,7 @@ func openDB(dbpath string, create bool) (pbdb database.Db, err error) {
 		return
 	}
 
-	tlDb, err = leveldb.OpenFile(dbpath, opts)
+	tlDb, err := leveldb.OpenFile(dbpath, opts)
 	if err != nil {
 		return
 	}
@@ -175,92 +111,81 @@ func openDB(dbpath string, create bool) (pbdb database.Db, err error) {
 		fo, ferr := os.Create(verfile)
 		if ferr != nil {
 			// TODO(design) close and delete database?
+			tlDb.Close()
 			err = ferr
 			return
 		}
 		defer fo.Close()
 		err = binary.Write(fo, binary.BigEndian, dbversion)
 		if err != nil {
+			tlDb.Close()
 			return
 		}
 	}
 
-	return
+	return &levelStore{lDb: tlDb}, nil
 }
 
-func (db *LevelDb) StartBatch() {
-	db.dbLock.Lock()
-	db.lbatch = new(leveldb.Batch)
+func (s *levelStore) Get(key []byte) ([]byte, error) {
+	return s.lDb.Get(key, s.ro)
 }
 
-func (db *LevelDb) EndBatch() error {
-	defer db.lbatch.Reset()
-	defer db.dbLock.Unlock()
-
-	err := db.lDb.Write(db.lbatch, db.wo)
-	if err != nil {
-		fmt.Printf("batch failed %v\n", err)
-		return err
+func (s *levelStore) Iterate(fromkey, tokey []byte, fn func(key, value []byte) error) error {
+	// A nil Start or Limit leaves that end of the range open
+	r := new(util.Range)
+	if len(fromkey) > 0 {
+		r.Start = fromkey
+	}
+	if len(tokey) > 0 {
+		r.Limit = tokey
 	}
+	iter := s.lDb.NewIterator(r, s.ro)
+	defer iter.Release()
 
-	return nil
-}
+	for iter.Next() {
+		// The iterator reuses its buffers
+		key := make([]byte, len(iter.Key()))
+		copy(key, iter.Key())
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
 
-func (db *LevelDb) close() error {
-	return db.lDb.Close()
+		err := fn(key, value)
+		if err != nil {
+			return err
+		}
+	}
+	return iter.Error()
 }
 
-// Sync verifies that the database is coherent on disk,
-// and no outstanding transactions are in flight.
-func (db *LevelDb) Sync() error {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
+func (s *levelStore) Write(b *kvdb.Batch) error {
+	batch := new(leveldb.Batch)
+	for _, op := range b.Ops {
+		if op.Delete {
+			batch.Delete(op.Key)
+		} else {
+			batch.Put(op.Key, op.Value)
+		}
+	}
 
-	// while specified by the API, does nothing
-	// however does grab lock to verify it does not return until other operations are complete.
+	err := s.lDb.Write(batch, s.wo)
+	if err != nil {
+		fmt.Printf("batch failed %v\n", err)
+		return err
+	}
 	return nil
 }
 
-// Close cleanly shuts down database, syncing all data.
-func (db *LevelDb) Close() error {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
-	return db.close()
-}
-
-func int64ToKey(keyint int64) []byte {
-	key := strconv.FormatInt(keyint, 10)
-	return []byte(key)
-}
-
-func shaBlkToKey(sha *wire.ShaHash) []byte {
-	shaB := sha.Bytes()
-	return shaB
-}
-
-func shaTxToKey(sha *wire.ShaHash) []byte {
-	shaB := sha.Bytes()
-	shaB = append(shaB, "tx"...)
-	return shaB
-}
-
-func shaSpentTxToKey(sha *wire.ShaHash) []byte {
-	shaB := sha.Bytes()
-	shaB = append(shaB, "sx"...)
-	return shaB
+// Sync does nothing: every Write is already in the LevelDB journal.
+func (s *levelStore) Sync() error {
+	return nil
 }
 
-func (db *LevelDb) lBatch() *leveldb.Batch {
-	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
-	}
-	return db.lbatch
+func (s *levelStore) Close() error {
+	return s.lDb.Close()
 }
 
-func (db *LevelDb) RollbackClose() error {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
-	return db.close()
+// RollbackClose closes the database; LevelDB keeps no transaction to
+// discard.
+func (s *levelStore) RollbackClose() error {
+	return s.lDb.Close()
 }
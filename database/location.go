@@ -0,0 +1,79 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// EntryLocation tells where an entry was recorded.
+type EntryLocation struct {
+	// EBlockKeyMR is the key merkle root of the entry block holding the entry
+	EBlockKeyMR *common.Hash
+
+	// DBHeight is the height of the directory block holding the entry block
+	DBHeight uint32
+
+	// Minute is the end of minute marker following the entry in the entry
+	// block, 0 if there is none
+	Minute uint8
+
+	// InDBlock is set once the directory block at DBHeight has been stored.
+	// It is not marshalled.
+	InDBlock bool
+}
+
+// entryLocationSize is KeyMR (32 bytes) + DBHeight (4 bytes) + Minute (1 byte)
+const entryLocationSize = 37
+
+func (l *EntryLocation) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, entryLocationSize)
+	data = append(data, l.EBlockKeyMR.Bytes()...)
+	height := make([]byte, 4)
+	binary.BigEndian.PutUint32(height, l.DBHeight)
+	data = append(data, height...)
+	data = append(data, l.Minute)
+	return data, nil
+}
+
+func (l *EntryLocation) UnmarshalBinary(data []byte) error {
+	if len(data) < entryLocationSize {
+		return fmt.Errorf("EntryLocation: %v bytes, expected %v", len(data), entryLocationSize)
+	}
+	l.EBlockKeyMR = common.NewHash()
+	l.EBlockKeyMR.SetBytes(data[:32])
+	l.DBHeight = binary.BigEndian.Uint32(data[32:36])
+	l.Minute = data[36]
+	return nil
+}
+
+// EntryLocations returns the location of every entry of an entry block,
+// keyed by entry hash. Minute markers are skipped.
+func EntryLocations(eblock *common.EBlock) (map[common.Hash]*EntryLocation, error) {
+	keyMR, err := eblock.KeyMR()
+	if err != nil {
+		return nil, err
+	}
+
+	locations := make(map[common.Hash]*EntryLocation)
+	pending := make([]*EntryLocation, 0, len(eblock.Body.EBEntries))
+	for _, ebEntry := range eblock.Body.EBEntries {
+		if ebEntry.IsMinuteMarker() {
+			minute := ebEntry.Bytes()[31]
+			for _, l := range pending {
+				l.Minute = minute
+			}
+			pending = pending[:0]
+			continue
+		}
+		l := &EntryLocation{EBlockKeyMR: keyMR, DBHeight: eblock.Header.EBHeight}
+		locations[*ebEntry] = l
+		pending = append(pending, l)
+	}
+	return locations, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package memdb implements database.Db on top of Go maps. It stores the same
+// kvdb "tables" as the other backends, under the same keys, and is meant for
+// tests and ephemeral nodes that do not need to persist anything.
+package memdb
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kvdb"
+)
+
+// memStore is a kvdb.Store kept entirely in memory.
+type memStore struct {
+	// store holds the committed key/value pairs; saved is the copy taken
+	// at the last Sync, restored by RollbackClose.
+	store map[string][]byte
+	saved map[string][]byte
+}
+
+// NewMemDb returns an empty in-memory database at the current schema
+// version.
+func NewMemDb() database.Db {
+	s := new(memStore)
+	s.store = make(map[string][]byte)
+	s.saved = make(map[string][]byte)
+	db, err := kvdb.Open(s)
+	if err != nil {
+		// The migrations of an empty map cannot fail
+		panic(err)
+	}
+	return db
+}
+
+// Get returns a copy of the value stored under key.
+func (s *memStore) Get(key []byte) ([]byte, error) {
+	data, ok := s.store[string(key)]
+	if !ok {
+		return nil, kvdb.ErrNotFound
+	}
+	value := make([]byte, len(data))
+	copy(value, data)
+	return value, nil
+}
+
+// Iterate walks [fromkey, tokey) in key order, the same order a LevelDB
+// iterator would produce. An empty tokey leaves the range open.
+func (s *memStore) Iterate(fromkey, tokey []byte, fn func(key, value []byte) error) error {
+	keys := make([]string, 0, 10)
+	for k := range s.store {
+		if bytes.Compare([]byte(k), fromkey) < 0 {
+			continue
+		}
+		if len(tokey) > 0 && bytes.Compare([]byte(k), tokey) >= 0 {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		data := s.store[k]
+		value := make([]byte, len(data))
+		copy(value, data)
+		if err := fn([]byte(k), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write applies all operations of b to the store.
+func (s *memStore) Write(b *kvdb.Batch) error {
+	for _, op := range b.Ops {
+		if op.Delete {
+			delete(s.store, string(op.Key))
+		} else {
+			s.store[string(op.Key)] = op.Value
+		}
+	}
+	return nil
+}
+
+func copyStore(src map[string][]byte) map[string][]byte {
+	dst := make(map[string][]byte, len(src))
+	for k, v := range src {
+		dst[k] = v
+	}
+	return dst
+}
+
+// Sync saves the current contents so that a later RollbackClose can return
+// to them.
+func (s *memStore) Sync() error {
+	s.saved = copyStore(s.store)
+	return nil
+}
+
+// Close is a no-op; nothing is persisted.
+func (s *memStore) Close() error {
+	return nil
+}
+
+// RollbackClose discards the changes made since the last Sync.
+func (s *memStore) RollbackClose() error {
+	s.store = copyStore(s.saved)
+	return nil
+}
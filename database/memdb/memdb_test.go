@@ -0,0 +1,33 @@
+package memdb_test
+
+import (
+	"testing"
+
+	"github.com/FactomProject/FactomCode/database/conformance"
+	"github.com/FactomProject/FactomCode/database/memdb"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.RunTests(t, memdb.NewMemDb)
+}
+
+func TestRollbackClose(t *testing.T) {
+	db := memdb.NewMemDb()
+
+	kept := conformance.NewTestEntry("kept")
+	db.InsertEntry(kept)
+	db.Sync()
+
+	dropped := conformance.NewTestEntry("dropped")
+	db.InsertEntry(dropped)
+
+	if err := db.RollbackClose(); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := db.FetchEntryByHash(kept.Hash()); got == nil {
+		t.Errorf("synced entry lost on rollback")
+	}
+	if got, _ := db.FetchEntryByHash(dropped.Hash()); got != nil {
+		t.Errorf("unsynced entry survived rollback")
+	}
+}
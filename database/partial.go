@@ -0,0 +1,57 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// DiscardPartialHeight removes the blocks stored above the last directory
+// block, which a crash leaves behind when it interrupts the separate writes
+// of a directory block and the blocks it lists. Heights are now written in
+// one batch, so only databases written before that can hold such a height.
+// Those always wrote the admin, entry credit and factoid blocks before the
+// entry blocks and the directory block, so one of them is found at the
+// next height whenever a height was partially written. It reports whether
+// anything was discarded.
+func DiscardPartialHeight(db Db) (bool, error) {
+	height, err := FetchDChainHeight(db)
+	if err != nil {
+		return false, err
+	}
+	next := uint32(height + 1)
+
+	aBlock, _ := db.FetchABlockByHeight(next)
+	ecBlock, _ := db.FetchECBlockByHeight(next)
+	fBlock, _ := db.FetchFBlockByHeight(next)
+	if aBlock == nil && ecBlock == nil && fBlock == nil {
+		return false, nil
+	}
+
+	if height < 0 {
+		return false, fmt.Errorf("the genesis directory block was only partially written; remove the database and restart")
+	}
+	return true, db.RollbackToHeight(uint32(height))
+}
+
+// FetchDChainHeight returns the height of the directory chain head, or -1
+// for an empty database.
+func FetchDChainHeight(db Db) (int64, error) {
+	dChainID, err := common.NewShaHash(common.D_CHAINID)
+	if err != nil {
+		return -1, err
+	}
+	head, err := db.FetchHeadMRByChainID(dChainID)
+	if err != nil || head == nil {
+		return -1, nil
+	}
+	dBlock, err := db.FetchDBlockByMR(head)
+	if err != nil || dBlock == nil {
+		return -1, fmt.Errorf("cannot read the directory chain head %v: %v", head, err)
+	}
+	return int64(dBlock.Header.DBHeight), nil
+}
@@ -0,0 +1,61 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// ErrPruned is returned for an entry, or an entry block body, that was
+// recorded in the database but has since been pruned by PruneBelowHeight.
+var ErrPruned = errors.New("pruned from this database")
+
+// prunedEBlockMagic starts the value a pruned entry block is replaced with,
+// which is followed by the binary entry block header. At 4 + 140 bytes it
+// cannot be mistaken for a stored entry block, which is 140 bytes plus 32
+// for each of its entries.
+var prunedEBlockMagic = []byte{'P', 'R', 'N', 'D'}
+
+// PrunedEBlockValue returns the value an entry block is stored as once it is
+// pruned: its header alone, which keeps the key merkle root and the links to
+// the previous block of the chain.
+func PrunedEBlockValue(eblock *common.EBlock) ([]byte, error) {
+	header, err := eblock.MarshalHeaderBinary()
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, prunedEBlockMagic...), header...), nil
+}
+
+// IsPrunedEBlockValue tells whether a stored entry block value is the header
+// of a pruned entry block.
+func IsPrunedEBlockValue(data []byte) bool {
+	return len(data) == len(prunedEBlockMagic)+common.EBHeaderSize && bytes.HasPrefix(data, prunedEBlockMagic)
+}
+
+// UnmarshalStoredEBlock unmarshals a stored entry block. For a pruned one it
+// returns the block with its header only, and no entries, along with
+// ErrPruned. The header is left as it was stored, so the key merkle root of
+// such a block is HeaderKeyMR; KeyMR would rebuild the header from the
+// empty body.
+func UnmarshalStoredEBlock(data []byte) (*common.EBlock, error) {
+	eBlock := common.NewEBlock()
+	if IsPrunedEBlockValue(data) {
+		_, err := eBlock.UnmarshalHeaderBinaryData(data[len(prunedEBlockMagic):])
+		if err != nil {
+			return nil, err
+		}
+		return eBlock, ErrPruned
+	}
+
+	_, err := eBlock.UnmarshalBinaryData(data)
+	if err != nil {
+		return nil, err
+	}
+	return eBlock, nil
+}
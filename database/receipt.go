@@ -0,0 +1,80 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package database
+
+import (
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// BuildReceipt returns the receipt of an entry. It returns nil for an
+// unknown entry or one whose entry block is not in a directory block yet,
+// and ErrPruned if the body of the entry block was pruned. The receipt holds
+// the Bitcoin anchor of the directory block once it is confirmed.
+func BuildReceipt(db Db, entryHash *common.Hash) (*common.Receipt, error) {
+	location, err := db.FetchEntryLocation(entryHash)
+	if err != nil {
+		return nil, err
+	}
+	if location == nil || !location.InDBlock {
+		return nil, nil
+	}
+
+	eBlock, err := db.FetchEBlockByMR(location.EBlockKeyMR)
+	if err != nil {
+		return nil, err
+	}
+	if eBlock == nil {
+		return nil, fmt.Errorf("entry block %v is missing", location.EBlockKeyMR)
+	}
+	dBlock, err := db.FetchDBlockByHeight(location.DBHeight)
+	if err != nil {
+		return nil, err
+	}
+	if dBlock == nil {
+		return nil, fmt.Errorf("directory block %v is missing", location.DBHeight)
+	}
+
+	branch, err := eBlock.Body.EntryMerkleBranch(entryHash)
+	if err != nil {
+		return nil, err
+	}
+	next := make([]*common.MerkleBranch, 3)
+	next[0], err = eBlock.KeyMRMerkleBranch()
+	if err != nil {
+		return nil, err
+	}
+	next[1], err = dBlock.EBlockMerkleBranch(location.EBlockKeyMR)
+	if err != nil {
+		return nil, err
+	}
+	next[2], err = dBlock.KeyMRMerkleBranch()
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range next {
+		branch, err = branch.Append(b)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	receipt := &common.Receipt{
+		Entry:        entryHash,
+		EBlockKeyMR:  location.EBlockKeyMR,
+		DBlockHeader: dBlock.Header,
+		MerkleBranch: branch,
+	}
+
+	anchor, err := db.FetchDirBlockInfoByHash(dBlock.DBHash)
+	if err != nil {
+		return nil, err
+	}
+	if anchor != nil && anchor.BTCConfirmed {
+		receipt.Anchor = anchor
+	}
+	return receipt, nil
+}
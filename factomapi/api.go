@@ -7,6 +7,7 @@ package factomapi
 import (
 	"encoding/hex"
 	"fmt"
+	"math"
 
 	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/FactomCode/database"
@@ -15,6 +16,9 @@ import (
 	fct "github.com/FactomProject/factoid"
 )
 
+// ChainsPageSize is the number of entry chains listed by Chains at a time.
+const ChainsPageSize = 100
+
 var (
 	db     database.Db
 	inMsgQ chan wire.FtmInternalMsg
@@ -32,6 +36,45 @@ func ChainHead(chainid string) (*common.Hash, error) {
 	return c, nil
 }
 
+// ChainStats returns the statistics of an entry chain.
+func ChainStats(chainid string) (*database.ChainStats, error) {
+	h, err := atoh(chainid)
+	if err != nil {
+		return nil, err
+	}
+	stats, err := db.FetchChainStats(h)
+	if err != nil {
+		return nil, err
+	}
+	if stats == nil {
+		return nil, fmt.Errorf("Chain not found")
+	}
+	return stats, nil
+}
+
+// Chains returns the statistics of up to ChainsPageSize entry chains,
+// ordered by chain ID and starting at the chain ID cursor, empty for the
+// first page. The returned cursor fetches the next page and is empty after
+// the last one.
+func Chains(cursor string) ([]*database.ChainStats, string, error) {
+	var from *common.Hash
+	if cursor != "" {
+		h, err := atoh(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+		from = h
+	}
+	stats, next, err := db.FetchAllChainStats(from, ChainsPageSize)
+	if err != nil {
+		return nil, "", err
+	}
+	if next == nil {
+		return stats, "", nil
+	}
+	return stats, next.String(), nil
+}
+
 func CommitChain(c *common.CommitChain) error {
 	m := wire.NewMsgCommitChain()
 	m.CommitChain = c
@@ -65,6 +108,20 @@ func DBlockByKeyMR(keymr string) (*common.DirectoryBlock, error) {
 	return r, nil
 }
 
+// DBlockByTime returns the directory block covering a time in minutes since
+// the epoch, the last one stamped at or before it.
+func DBlockByTime(timestamp uint32) (*common.DirectoryBlock, error) {
+	block, err := db.FetchDBlockByTime(timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, fmt.Errorf("No directory block at or before this time")
+	}
+	block.BuildKeyMerkleRoot()
+	return block, nil
+}
+
 func DBlockHead() (*common.DirectoryBlock, error) {
 	_, height, err := db.FetchBlockHeightCache()
 	if err != nil {
@@ -84,12 +141,33 @@ func EBlockByKeyMR(keymr string) (*common.EBlock, error) {
 		return nil, err
 	}
 	r, err := db.FetchEBlockByMR(h)
+	if err == database.ErrPruned {
+		return r, err
+	}
 	if err != nil {
 		return r, fmt.Errorf("EBlock not found")
 	}
 	return r, nil
 }
 
+// EBlockBySequence returns the entry block of a chain by its sequence number.
+func EBlockBySequence(chainid string, seq uint32) (*common.EBlock, error) {
+	h, err := atoh(chainid)
+	if err != nil {
+		return nil, err
+	}
+	r, err := db.FetchEBlockByHeight(h, seq)
+	if err == database.ErrPruned {
+		return r, err
+	}
+	if err != nil {
+		return r, fmt.Errorf("EBlock not found")
+	}
+	return r, nil
+}
+
+// ECBalance returns the live entry credit balance of a public key, which
+// counts the commits and purchases not yet in an entry credit block.
 func ECBalance(eckey string) (uint32, error) {
 	key := new([32]byte)
 	if p, err := hex.DecodeString(eckey); err != nil {
@@ -98,7 +176,44 @@ func ECBalance(eckey string) (uint32, error) {
 		copy(key[:], p)
 	}
 	val, _ := process.GetEntryCreditBalance(key)
-	return uint32(val), nil
+	return ecCredits(int64(val))
+}
+
+// ECBalanceAt returns the entry credit balance of a public key as of the
+// entry credit block at a directory block height.
+func ECBalanceAt(eckey string, height uint32) (uint32, error) {
+	key := new([32]byte)
+	if p, err := hex.DecodeString(eckey); err != nil {
+		return 0, err
+	} else {
+		copy(key[:], p)
+	}
+	balance, err := db.FetchECBalanceAtHeight(key, height)
+	if err != nil {
+		return 0, err
+	}
+	return ecCredits(balance.Balance)
+}
+
+// ecCredits checks that a balance fits the uint32 the API reports. A
+// negative balance means the balances are broken, and is not wrapped.
+func ecCredits(balance int64) (uint32, error) {
+	if balance < 0 || balance > math.MaxUint32 {
+		return 0, fmt.Errorf("Invalid entry credit balance %d", balance)
+	}
+	return uint32(balance), nil
+}
+
+// FactoidBalanceAt returns the factoid balance, in factoshis, of an address
+// as of the factoid block at a directory block height.
+func FactoidBalanceAt(address string, height uint32) (uint64, error) {
+	key := new([32]byte)
+	if p, err := hex.DecodeString(address); err != nil {
+		return 0, err
+	} else {
+		copy(key[:], p)
+	}
+	return db.FetchFactoidBalanceAtHeight(key, height)
 }
 
 func EntryByHash(hash string) (*common.Entry, error) {
@@ -116,6 +231,23 @@ func EntryByHash(hash string) (*common.Entry, error) {
 	return r, nil
 }
 
+// Receipt returns the receipt proving that an entry is in a directory block
+// and, once the directory block is anchored, in Bitcoin.
+func Receipt(hash string) (*common.Receipt, error) {
+	h, err := atoh(hash)
+	if err != nil {
+		return nil, err
+	}
+	r, err := database.BuildReceipt(db, h)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, fmt.Errorf("Entry not found or not in a directory block yet")
+	}
+	return r, nil
+}
+
 func RevealEntry(e *common.Entry) error {
 	m := wire.NewMsgRevealEntry()
 	m.Entry = e
@@ -0,0 +1,318 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/boltdb"
+	"github.com/FactomProject/FactomCode/database/kvdb"
+	"github.com/FactomProject/FactomCode/database/ldb"
+	"github.com/FactomProject/FactomCode/process"
+)
+
+// commands are the operator commands factomd runs instead of the node, as
+// in 'factomd migrate --dry-run'.
+var commands = map[string]func(args []string) error{
+	"migrate":  migrateCommand,
+	"fsck":     fsckCommand,
+	"rollback": rollbackCommand,
+	"export":   exportCommand,
+	"import":   importCommand,
+	"diff":     diffCommand,
+}
+
+// runCommand runs the named operator command and reports whether there was
+// one. A failing command exits factomd with status 1.
+func runCommand(name string, args []string) bool {
+	cmd, ok := commands[name]
+	if !ok {
+		return false
+	}
+
+	err := cmd(args)
+	if err != nil {
+		fmt.Println(name+":", err)
+		os.Exit(1)
+	}
+	return true
+}
+
+// migrateCommand brings the configured database to the current schema
+// version. With --dry-run it only reports the migrations that would be run.
+func migrateCommand(args []string) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "report the migrations without writing anything")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		kdb, err := openConfiguredKVDb()
+		if err != nil {
+			return err
+		}
+		defer kdb.Close()
+
+		reports, err := kdb.Migrate(true)
+		if err != nil {
+			return err
+		}
+		if len(reports) == 0 {
+			fmt.Println("Database is at schema version", kvdb.SchemaVersion())
+		}
+		for _, r := range reports {
+			fmt.Printf("would migrate to schema version %v: %v (%v writes)\n", r.Version, r.Description, r.Writes)
+		}
+		return nil
+	}
+
+	pbdb, err := openConfiguredDB(false)
+	if err != nil {
+		return err
+	}
+	return pbdb.Close()
+}
+
+// fsckCommand checks the cross references of the configured database and
+// prints the report as JSON. With --repair the rebuildable indexes are fixed.
+func fsckCommand(args []string) error {
+	flags := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := flags.Bool("repair", false, "rebuild the index tables that do not match the blocks")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	kdb, err := openConfiguredKVDb()
+	if err != nil {
+		return err
+	}
+	defer kdb.Close()
+
+	report, err := kdb.Check(*repair)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+
+	if n := report.Unrepaired(); n > 0 {
+		return fmt.Errorf("%v problems found", n)
+	}
+	return nil
+}
+
+// diffCommand compares two databases, as in 'factomd diff server/ldb
+// follower/factom_bolt.db', and prints every difference, or the report as
+// JSON with --json. A directory is opened as LevelDB and a file as BoltDB.
+func diffCommand(args []string) error {
+	flags := flag.NewFlagSet("diff", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: factomd diff [--json] dbpathA dbpathB")
+	}
+
+	dbA, err := openDiffDB(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer dbA.Close()
+	dbB, err := openDiffDB(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer dbB.Close()
+
+	report, err := kvdb.Diff(dbA, dbB, flags.Arg(0), flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		for _, d := range report.Differences {
+			fmt.Println(d)
+		}
+	}
+
+	if n := len(report.Differences); n > 0 {
+		return fmt.Errorf("%v differences found", n)
+	}
+	return nil
+}
+
+// openDiffDB opens the existing database at dbpath without migrating it,
+// as LevelDB if dbpath is a directory and as BoltDB if it is a file.
+func openDiffDB(dbpath string) (*kvdb.KVDb, error) {
+	fi, err := os.Stat(dbpath)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return ldb.Open(dbpath, false)
+	}
+	return boltdb.Open(dbpath)
+}
+
+// rollbackCommand deletes every block above --height from the configured
+// database, as after a bad deploy or a corrupted sync. The node resyncs the
+// removed blocks the next time it starts.
+func rollbackCommand(args []string) error {
+	flags := flag.NewFlagSet("rollback", flag.ContinueOnError)
+	height := flags.Int64("height", -1, "directory block height to roll the database back to")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if *height < 0 || *height > int64(^uint32(0)) {
+		return fmt.Errorf("a --height of 0 or more is required")
+	}
+
+	pbdb, err := openConfiguredDB(false)
+	if err != nil {
+		return err
+	}
+	defer pbdb.Close()
+
+	err = pbdb.RollbackToHeight(uint32(*height))
+	if err != nil {
+		return err
+	}
+	fmt.Println("Database rolled back to directory block height", *height)
+	return nil
+}
+
+// exportCommand writes the directory block heights --from through --to of
+// the configured database to an archive file, as in
+// 'factomd export --from 0 --to 1000 out.archive'.
+func exportCommand(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	from := flags.Int64("from", 0, "first directory block height to export")
+	to := flags.Int64("to", -1, "last directory block height to export (default: the last one)")
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: factomd export [--from height] [--to height] file")
+	}
+
+	pbdb, err := openConfiguredDB(false)
+	if err != nil {
+		return err
+	}
+	defer pbdb.Close()
+
+	if *to < 0 {
+		*to, err = database.FetchDChainHeight(pbdb)
+		if err != nil {
+			return err
+		}
+	}
+	if *from < 0 || *from > *to || *to > int64(^uint32(0)) {
+		return fmt.Errorf("cannot export from height %v to height %v", *from, *to)
+	}
+
+	f, err := os.Create(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = database.ExportArchive(pbdb, uint32(*from), uint32(*to), w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(flags.Arg(0))
+		return err
+	}
+	fmt.Printf("Exported directory block heights %v to %v\n", *from, *to)
+	return nil
+}
+
+// importCommand stores the heights of an archive file in the configured
+// database, which is created if needed, and validates them.
+func importCommand(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	err := flags.Parse(args)
+	if err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: factomd import file")
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	pbdb, err := openConfiguredDB(true)
+	if err != nil {
+		return err
+	}
+	defer pbdb.Close()
+
+	imported, err := process.ImportArchive(pbdb, bufio.NewReader(f))
+	fmt.Println("Imported", imported, "directory block heights")
+	return err
+}
+
+// openConfiguredDB opens the database of the configured DBType, creating it
+// if create is set, with the configured compression.
+func openConfiguredDB(create bool) (database.Db, error) {
+	var pbdb database.Db
+	var err error
+	switch strings.ToUpper(dbType) {
+	case "BOLT":
+		pbdb, err = boltdb.OpenBoltDB(boltDBpath+"factom_bolt.db", create)
+	default:
+		pbdb, err = ldb.OpenLevelDB(ldbpath, create)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := setCompression(pbdb); err != nil {
+		pbdb.Close()
+		return nil, err
+	}
+	return pbdb, nil
+}
+
+// openConfiguredKVDb opens the existing database of the configured DBType
+// without migrating it, for the commands that inspect it as it is.
+func openConfiguredKVDb() (*kvdb.KVDb, error) {
+	switch strings.ToUpper(dbType) {
+	case "BOLT":
+		return boltdb.Open(boltDBpath + "factom_bolt.db")
+	default:
+		return ldb.Open(ldbpath, false)
+	}
+}
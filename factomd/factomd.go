@@ -9,6 +9,9 @@ import (
 	"github.com/FactomProject/FactomCode/common"
 	cp "github.com/FactomProject/FactomCode/controlpanel"
 	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/boltdb"
+	"github.com/FactomProject/FactomCode/database/cachedb"
+	"github.com/FactomProject/FactomCode/database/kvdb"
 	"github.com/FactomProject/FactomCode/database/ldb"
 	"github.com/FactomProject/FactomCode/process"
 	"github.com/FactomProject/FactomCode/util"
@@ -30,6 +33,7 @@ var (
 	homeDir         = ""
 	ldbpath         = ""
 	boltDBpath      = ""
+	dbType          = ""
 	db              database.Db                           // database
 	inMsgQueue      = make(chan wire.FtmInternalMsg, 100) //incoming message queue for factom application messages
 	outMsgQueue     = make(chan wire.FtmInternalMsg, 100) //outgoing message queue for factom application messages
@@ -73,6 +77,11 @@ func main() {
 	// Load configuration file and send settings to components
 	loadConfigurations()
 
+	// Run an operator command instead of the node if one is given
+	if len(os.Args) >= 2 && runCommand(os.Args[1], os.Args[2:]) {
+		return
+	}
+
 	// create the $home/.factom directory if it does not exist
 	os.Mkdir(homeDir, 0755)
 
@@ -140,6 +149,7 @@ func loadConfigurations() {
 	homeDir = cfg.App.HomeDir
 	ldbpath = cfg.App.LdbPath
 	boltDBpath = cfg.App.BoltDBPath
+	dbType = cfg.App.DBType
 	process.LoadConfigurations(cfg)
 
 }
@@ -152,6 +162,42 @@ func initDB() {
 	common.FactoidState = stateinit.NewFactoidState(boltDBpath + "factoid_bolt.db")
 
 	//init db
+	switch strings.ToUpper(dbType) {
+	case "BOLT":
+		initBoltDB()
+	default:
+		initLevelDB()
+	}
+
+	if err := setCompression(db); err != nil {
+		panic(err)
+	}
+
+	// Cache the recently fetched blocks, entries and chain heads
+	sizes := cachedb.Sizes{
+		DBlocks:    cfg.DBCache.DBlocks,
+		EBlocks:    cfg.DBCache.EBlocks,
+		Entries:    cfg.DBCache.Entries,
+		ChainHeads: cfg.DBCache.ChainHeads,
+	}
+	if sizes != (cachedb.Sizes{}) {
+		db = cachedb.New(db, sizes)
+	}
+}
+
+// setCompression applies the configured LdbCompression to a database of
+// either DBType: both store their tables through kvdb. Only the entries and
+// entry blocks written from now on are compressed.
+func setCompression(db database.Db) error {
+	compression, err := kvdb.ParseCompression(cfg.App.LdbCompression)
+	if err != nil {
+		return err
+	}
+	db.(*kvdb.KVDb).SetCompression(compression)
+	return nil
+}
+
+func initLevelDB() {
 	var err error
 	db, err = ldb.OpenLevelDB(ldbpath, false)
 
@@ -169,7 +215,28 @@ func initDB() {
 		}
 	}
 	ftmdLog.Info("Database started from: " + ldbpath)
+}
 
+func initBoltDB() {
+	boltpath := boltDBpath + "factom_bolt.db"
+
+	var err error
+	db, err = boltdb.OpenBoltDB(boltpath, false)
+
+	if err != nil {
+		ftmdLog.Errorf("err opening db: %v\n", err)
+
+	}
+
+	if db == nil {
+		ftmdLog.Info("Creating new db ...")
+		db, err = boltdb.OpenBoltDB(boltpath, true)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+	ftmdLog.Info("Database started from: " + boltpath)
 }
 
 func isCompilerVersionOK() bool {
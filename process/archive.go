@@ -0,0 +1,163 @@
+// Copyright 2015 FactomProject Authors. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package process
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/factoid/block"
+)
+
+// ImportArchive stores the heights of an archive written by
+// database.ExportArchive in archiveDB, which is how a new node is seeded
+// offline. The archive has to continue the directory chain of the database.
+// Every height is validated before it is stored and a height that fails
+// ends the import; the whole directory chain is validated again at the end.
+// It returns the number of heights imported.
+//
+// ImportArchive must not be called while the processor is running.
+func ImportArchive(archiveDB database.Db, r io.Reader) (imported int, err error) {
+	ecChainID := new(common.Hash)
+	ecChainID.SetBytes(common.EC_CHAINID)
+	aChainID := new(common.Hash)
+	aChainID.SetBytes(common.ADMIN_CHAINID)
+	dChainID := new(common.Hash)
+	dChainID.SetBytes(common.D_CHAINID)
+
+	// Only the head of the directory chain is needed to continue it
+	var next uint32
+	var prevMR, prevHash *common.Hash
+	// An empty database has no head
+	headMR, _ := archiveDB.FetchHeadMRByChainID(dChainID)
+	if headMR != nil {
+		head, err := archiveDB.FetchDBlockByMR(headMR)
+		if err != nil {
+			return 0, err
+		}
+		if head == nil {
+			return 0, fmt.Errorf("head directory block %v is missing", headMR)
+		}
+		prevMR, prevHash, err = validateDBlock(archiveDB, ecChainID, aChainID, head)
+		if err != nil {
+			return 0, err
+		}
+		next = head.Header.DBHeight + 1
+	}
+
+	ar, err := database.NewArchiveReader(r)
+	if err != nil {
+		return 0, err
+	}
+	for {
+		h, err := ar.ReadHeight()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return imported, err
+		}
+
+		dBlock := h.DBlock
+		height := dBlock.Header.DBHeight
+		if height != next {
+			return imported, fmt.Errorf("archive height %v does not continue the database at height %v", height, next)
+		}
+		if prevHash != nil && (!prevHash.IsSameAs(dBlock.Header.PrevLedgerKeyMR) || !prevMR.IsSameAs(dBlock.Header.PrevKeyMR)) {
+			return imported, errors.New("Previous block hash not matching for Dir block: " + fmt.Sprint(height))
+		}
+
+		prevMR, prevHash, err = validateDBlock(newArchiveHeightDb(archiveDB, h), ecChainID, aChainID, dBlock)
+		if err != nil {
+			return imported, fmt.Errorf("height %v: %v", height, err)
+		}
+		err = database.StoreArchiveHeight(archiveDB, h)
+		if err != nil {
+			return imported, err
+		}
+
+		next++
+		imported++
+	}
+
+	if next == 0 {
+		return 0, nil
+	}
+	c := new(common.DChain)
+	c.NextDBHeight = next
+	return imported, validateDChain(archiveDB, ecChainID, aChainID, c)
+}
+
+// archiveHeightDb looks the blocks and entries of an archive height up
+// before the database, so the height can be validated before it is stored.
+type archiveHeightDb struct {
+	database.Db
+	h       *database.ArchiveHeight
+	eBlocks map[common.Hash]*common.EBlock
+	entries map[common.Hash]*common.Entry
+}
+
+func newArchiveHeightDb(db database.Db, h *database.ArchiveHeight) *archiveHeightDb {
+	a := &archiveHeightDb{
+		Db:      db,
+		h:       h,
+		eBlocks: make(map[common.Hash]*common.EBlock),
+		entries: make(map[common.Hash]*common.Entry),
+	}
+	for _, eBlock := range h.EBlocks {
+		if keyMR, err := eBlock.KeyMR(); err == nil {
+			a.eBlocks[*keyMR] = eBlock
+		}
+	}
+	for _, entry := range h.Entries {
+		a.entries[*entry.Hash()] = entry
+	}
+	return a
+}
+
+func (a *archiveHeightDb) FetchECBlockByHash(hash *common.Hash) (*common.ECBlock, error) {
+	if a.h.ECBlock != nil {
+		ecHash, err := a.h.ECBlock.HeaderHash()
+		if err == nil && ecHash.IsSameAs(hash) {
+			return a.h.ECBlock, nil
+		}
+	}
+	return a.Db.FetchECBlockByHash(hash)
+}
+
+func (a *archiveHeightDb) FetchABlockByHash(hash *common.Hash) (*common.AdminBlock, error) {
+	if a.h.ABlock != nil {
+		aHash, err := a.h.ABlock.PartialHash()
+		if err == nil && aHash.IsSameAs(hash) {
+			return a.h.ABlock, nil
+		}
+	}
+	return a.Db.FetchABlockByHash(hash)
+}
+
+func (a *archiveHeightDb) FetchFBlockByHash(hash *common.Hash) (block.IFBlock, error) {
+	if a.h.FBlock != nil && bytes.Equal(a.h.FBlock.GetKeyMR().Bytes(), hash.Bytes()) {
+		return a.h.FBlock, nil
+	}
+	return a.Db.FetchFBlockByHash(hash)
+}
+
+func (a *archiveHeightDb) FetchEBlockByMR(mr *common.Hash) (*common.EBlock, error) {
+	if eBlock, ok := a.eBlocks[*mr]; ok {
+		return eBlock, nil
+	}
+	return a.Db.FetchEBlockByMR(mr)
+}
+
+func (a *archiveHeightDb) FetchEntryByHash(hash *common.Hash) (*common.Entry, error) {
+	if entry, ok := a.entries[*hash]; ok {
+		return entry, nil
+	}
+	return a.Db.FetchEntryByHash(hash)
+}
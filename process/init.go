@@ -11,6 +11,7 @@ import (
 	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/FactomCode/consensus"
 	cp "github.com/FactomProject/FactomCode/controlpanel"
+	"github.com/FactomProject/FactomCode/database"
 	"github.com/FactomProject/FactomCode/factomlog"
 	"github.com/FactomProject/FactomCode/util"
 	"github.com/FactomProject/btcd/wire"
@@ -18,7 +19,6 @@ import (
 	"github.com/FactomProject/factoid/block"
 	"github.com/FactomProject/go-spew/spew"
 	"runtime/debug"
-	"sort"
 	"strconv"
 )
 
@@ -33,42 +33,36 @@ func initDChain() {
 	barray := common.D_CHAINID
 	dchain.ChainID.SetBytes(barray)
 
-	// get all dBlocks from db
-	dBlocks, _ := db.FetchAllDBlocks()
-	sort.Sort(util.ByDBlockIDAccending(dBlocks))
-
-	dchain.Blocks = make([]*common.DirectoryBlock, len(dBlocks), len(dBlocks)+1)
-
-	for i := 0; i < len(dBlocks); i = i + 1 {
-		if dBlocks[i].Header.DBHeight != uint32(i) {
-			panic("Error in initializing dChain:" + dchain.ChainID.String())
+	// Only the head block is needed to continue the chain; the older blocks
+	// are read from db when needed
+	dchain.Blocks = make([]*common.DirectoryBlock, 0, 10)
+	var head *common.DirectoryBlock
+	headMR, _ := db.FetchHeadMRByChainID(dchain.ChainID)
+	if headMR != nil {
+		var err error
+		head, err = db.FetchDBlockByMR(headMR)
+		if err != nil {
+			panic(err)
 		}
-		dBlocks[i].Chain = dchain
-		dBlocks[i].IsSealed = true
-		dBlocks[i].IsSavedInDB = true
-		dchain.Blocks[i] = &dBlocks[i]
-	}
-
-	// double check the block ids
-	for i := 0; i < len(dchain.Blocks); i = i + 1 {
-		if uint32(i) != dchain.Blocks[i].Header.DBHeight {
-			panic(errors.New("BlockID does not equal index for chain:" + dchain.ChainID.String() + " block:" + fmt.Sprintf("%v", dchain.Blocks[i].Header.DBHeight)))
+		if head == nil {
+			panic("Head block not found for chain:" + dchain.ChainID.String())
 		}
+		head.Chain = dchain
+		head.IsSealed = true
+		head.IsSavedInDB = true
 	}
 
 	//Create an empty block and append to the chain
-	if len(dchain.Blocks) == 0 {
+	if head == nil {
 		dchain.NextDBHeight = 0
 		dchain.NextBlock, _ = common.CreateDBlock(dchain, nil, 10)
 	} else {
-		dchain.NextDBHeight = uint32(len(dchain.Blocks))
-		dchain.NextBlock, _ = common.CreateDBlock(dchain, dchain.Blocks[len(dchain.Blocks)-1], 10)
+		dchain.NextDBHeight = head.Header.DBHeight + 1
+		dchain.NextBlock, _ = common.CreateDBlock(dchain, head, 10)
 		// Update dir block height cache in db
 		db.UpdateBlockHeightCache(dchain.NextDBHeight-1, dchain.NextBlock.Header.PrevLedgerKeyMR)
 	}
 
-	exportDChain(dchain)
-
 	//Double check the sealed flag
 	if dchain.NextBlock.IsSealed == true {
 		panic("dchain.Blocks[dchain.NextBlockID].IsSealed for chain:" + dchain.ChainID.String())
@@ -84,17 +78,21 @@ func initECChain() {
 	//Initialize the Entry Credit Chain ID
 	ecchain = common.NewECChain()
 
-	// get all ecBlocks from db
-	ecBlocks, _ := db.FetchAllECBlocks()
-	sort.Sort(util.ByECBlockIDAccending(ecBlocks))
-
-	// Calculate the EC balance for each account
-	for _, v := range ecBlocks {
-		initializeECreditMap(&v)
+	// Load the EC balance of each account, which the database keeps up to
+	// date with every ECBlock
+	err := db.IterateECBalances(func(pubKey *[32]byte, balance *database.ECBalance) error {
+		eCreditMap[string(pubKey[:])] = int32(balance.Balance)
+		// Don't add the Increases to Factoid state, the Factoid processing will do that.
+		common.FactoidState.UpdateECBalance(fct.NewAddress(pubKey[:]), balance.Spent)
+		return nil
+	})
+	if err != nil {
+		panic(err)
 	}
 
 	//Create an empty block and append to the chain
-	if len(ecBlocks) == 0 || dchain.NextDBHeight == 0 {
+	ecHead, _ := db.FetchHeadMRByChainID(ecchain.ChainID)
+	if ecHead == nil || dchain.NextDBHeight == 0 {
 		ecchain.NextBlockHeight = 0
 		ecchain.NextBlock = common.NewECBlock()
 		ecchain.NextBlock.AddEntry(serverIndex)
@@ -106,8 +104,11 @@ func initECChain() {
 	} else {
 		// Entry Credit Chain should have the same height as the dir chain
 		ecchain.NextBlockHeight = dchain.NextDBHeight
-		var err error
-		ecchain.NextBlock, err = common.NextECBlock(&ecBlocks[ecchain.NextBlockHeight-1])
+		prev, _ := db.FetchECBlockByHeight(ecchain.NextBlockHeight - 1)
+		if prev == nil {
+			panic(errors.New("Missing Entry Credit Block at height " + fmt.Sprintf("%v", ecchain.NextBlockHeight-1)))
+		}
+		ecchain.NextBlock, err = common.NextECBlock(prev)
 		if err != nil {
 			panic(err)
 		}
@@ -115,7 +116,6 @@ func initECChain() {
 
 	// create a backup copy before processing entries
 	copyCreditMap(eCreditMap, eCreditMapBackup)
-	exportECChain(ecchain)
 
 	// ONly for debugging
 	if procLog.Level() > factomlog.Info {
@@ -132,33 +132,37 @@ func initAChain() {
 	achain.ChainID = new(common.Hash)
 	achain.ChainID.SetBytes(common.ADMIN_CHAINID)
 
-	// get all aBlocks from db
-	aBlocks, _ := db.FetchAllABlocks()
-	sort.Sort(util.ByABlockIDAccending(aBlocks))
-
-	// double check the block ids
-	for i := 0; i < len(aBlocks); i = i + 1 {
-		if uint32(i) != aBlocks[i].Header.DBHeight {
-			panic(errors.New("BlockID does not equal index for chain:" + achain.ChainID.String() + " block:" + fmt.Sprintf("%v", aBlocks[i].Header.DBHeight)))
+	// get all aBlocks from db and double check the block ids
+	var aBlockCount uint32
+	var prev *common.AdminBlock
+	err := db.IterateABlocks(0, database.AllShas, func(aBlock *common.AdminBlock) error {
+		if aBlockCount != aBlock.Header.DBHeight {
+			panic(errors.New("BlockID does not equal index for chain:" + achain.ChainID.String() + " block:" + fmt.Sprintf("%v", aBlock.Header.DBHeight)))
 		}
-		if !validateDBSignature(&aBlocks[i], dchain) {
-			panic(errors.New("No valid signature found in Admin Block = " + fmt.Sprintf("%s\n", spew.Sdump(aBlocks[i]))))
+		if !validateDBSignature(aBlock, dchain) {
+			panic(errors.New("No valid signature found in Admin Block = " + fmt.Sprintf("%s\n", spew.Sdump(aBlock))))
 		}
+		if aBlock.Header.DBHeight+1 == dchain.NextDBHeight {
+			prev = aBlock
+		}
+		aBlockCount++
+		return nil
+	})
+	if err != nil {
+		panic(err)
 	}
 
 	//Create an empty block and append to the chain
-	if len(aBlocks) == 0 || dchain.NextDBHeight == 0 {
+	if aBlockCount == 0 || dchain.NextDBHeight == 0 {
 		achain.NextBlockHeight = 0
 		achain.NextBlock, _ = common.CreateAdminBlock(achain, nil, 10)
 
 	} else {
 		// Entry Credit Chain should have the same height as the dir chain
 		achain.NextBlockHeight = dchain.NextDBHeight
-		achain.NextBlock, _ = common.CreateAdminBlock(achain, &aBlocks[achain.NextBlockHeight-1], 10)
+		achain.NextBlock, _ = common.CreateAdminBlock(achain, prev, 10)
 	}
 
-	exportAChain(achain)
-
 }
 
 // Initialize Factoid Block Chain from database
@@ -169,29 +173,31 @@ func initFctChain() {
 	fchain.ChainID = new(common.Hash)
 	fchain.ChainID.SetBytes(fct.FACTOID_CHAINID)
 
-	// get all aBlocks from db
-	fBlocks, _ := db.FetchAllFBlocks()
-	sort.Sort(util.ByFBlockIDAccending(fBlocks))
-
-	// double check the block ids
-	for i := 0; i < len(fBlocks); i = i + 1 {
-		if uint32(i) != fBlocks[i].GetDBHeight() {
+	// get all fBlocks from db and double check the block ids
+	var fBlockCount uint32
+	err := db.IterateFBlocks(0, database.AllShas, func(fBlock block.IFBlock) error {
+		if fBlockCount != fBlock.GetDBHeight() {
 			panic(errors.New("BlockID does not equal index for chain:" +
 				fchain.ChainID.String() + " block:" +
-				fmt.Sprintf("%v", fBlocks[i].GetDBHeight())))
+				fmt.Sprintf("%v", fBlock.GetDBHeight())))
 		} else {
-			FactoshisPerCredit = fBlocks[i].GetExchRate()
+			FactoshisPerCredit = fBlock.GetExchRate()
 			common.FactoidState.SetFactoshisPerEC(FactoshisPerCredit)
 			// initialize the FactoidState in sequence
-			err := common.FactoidState.AddTransactionBlock(fBlocks[i])
+			err := common.FactoidState.AddTransactionBlock(fBlock)
 			if err != nil {
 				panic("Failed to rebuild factoid state: " + err.Error())
 			}
 		}
+		fBlockCount++
+		return nil
+	})
+	if err != nil {
+		panic(err)
 	}
 
 	//Create an empty block and append to the chain
-	if len(fBlocks) == 0 || dchain.NextDBHeight == 0 {
+	if fBlockCount == 0 || dchain.NextDBHeight == 0 {
 		common.FactoidState.SetFactoshisPerEC(FactoshisPerCredit)
 		fchain.NextBlockHeight = 0
 		// func GetGenesisFBlock(ftime uint64, ExRate uint64, addressCnt int, Factoids uint64 ) IFBlock {
@@ -213,8 +219,6 @@ func initFctChain() {
 		fchain.NextBlock = common.FactoidState.GetCurrentBlock()
 	}
 
-	exportFctChain(fchain)
-
 }
 
 // Initialize Entry Block Chains from database
@@ -231,7 +235,6 @@ func initEChains() {
 	for _, chain := range chains {
 		var newChain = chain
 		chainIDMap[newChain.ChainID.String()] = newChain
-		exportEChain(chain)
 	}
 
 }
@@ -282,105 +285,136 @@ func initServerKeys() {
 func initProcessListMgr() {
 	plMgr = consensus.NewProcessListMgr(dchain.NextDBHeight, 1, 10, serverPrivKey)
 
+	// Nothing is acked for the new blocks yet
+	ackedECObjects = 0
+	ackedChainEntries = make(map[string]uint32)
+
 }
 
 // Initialize the entry chains in memory from db
 func initEChainFromDB(chain *common.EChain) {
 
-	eBlocks, _ := db.FetchAllEBlocksByChain(chain.ChainID)
-	sort.Sort(util.ByEBlockIDAccending(*eBlocks))
-
-	for i := 0; i < len(*eBlocks); i = i + 1 {
-		if uint32(i) != (*eBlocks)[i].Header.EBSequence {
-			panic(errors.New("BlockID does not equal index for chain:" + chain.ChainID.String() + " block:" + fmt.Sprintf("%v", (*eBlocks)[i].Header.EBSequence)))
+	// Only the head block is needed to continue the chain
+	var last *common.EBlock
+	var err error
+	headMR, _ := db.FetchHeadMRByChainID(chain.ChainID)
+	if headMR != nil {
+		last, err = db.FetchEBlockByMR(headMR)
+		if err != nil && err != database.ErrPruned {
+			panic(err)
+		}
+		if last == nil {
+			panic(errors.New("Head block not found for chain:" + chain.ChainID.String()))
 		}
 	}
 
-	var err error
-	if len(*eBlocks) == 0 {
+	if last == nil {
 		chain.NextBlockHeight = 0
 		chain.NextBlock, err = common.MakeEBlock(chain, nil)
 		if err != nil {
 			panic(err)
 		}
+	} else if len(last.Body.EBEntries) == 0 {
+		// A pruned head has its header only; the hash of the whole block
+		// is found by its KeyMR
+		chain.NextBlockHeight = last.Header.EBSequence + 1
+		chain.NextBlock, err = common.MakeEBlock(chain, nil)
+		if err != nil {
+			panic(err)
+		}
+		chain.NextBlock.Header.PrevKeyMR = headMR
+		chain.NextBlock.Header.PrevLedgerKeyMR, err = db.FetchEBHashByMR(headMR)
+		if err != nil {
+			panic(err)
+		}
 	} else {
-		chain.NextBlockHeight = uint32(len(*eBlocks))
-		chain.NextBlock, err = common.MakeEBlock(chain, &(*eBlocks)[len(*eBlocks)-1])
+		chain.NextBlockHeight = last.Header.EBSequence + 1
+		chain.NextBlock, err = common.MakeEBlock(chain, last)
 		if err != nil {
 			panic(err)
 		}
 	}
 
 	// Initialize chain with the first entry (Name and rules) for non-server mode
-	if nodeMode != common.SERVER_NODE && chain.FirstEntry == nil && len(*eBlocks) > 0 {
-		chain.FirstEntry, _ = db.FetchEntryByHash((*eBlocks)[0].Body.EBEntries[0])
-		if chain.FirstEntry != nil {
-			db.InsertChain(chain)
+	if nodeMode != common.SERVER_NODE && chain.FirstEntry == nil && last != nil {
+		first, _ := db.FetchEBlockByHeight(chain.ChainID, 0)
+		if first != nil && len(first.Body.EBEntries) > 0 {
+			chain.FirstEntry, _ = db.FetchEntryByHash(first.Body.EBEntries[0])
+			if chain.FirstEntry != nil {
+				db.InsertChain(chain)
+			}
 		}
 	}
 
 }
 
-// Validate dir chain from genesis block
-func validateDChain(c *common.DChain) error {
+// Validate the dir chain stored in db from genesis block. ecChainID and
+// aChainID tell the entry credit and admin blocks listed in a dir block
+// apart from the entry blocks.
+func validateDChain(db database.Db, ecChainID, aChainID *common.Hash, c *common.DChain) error {
 
-	if nodeMode != common.SERVER_NODE && len(c.Blocks) == 0 {
+	if nodeMode != common.SERVER_NODE && c.NextDBHeight == 0 {
 		return nil
 	}
 
-	if uint32(len(c.Blocks)) != c.NextDBHeight {
-		return errors.New("Dir chain has an un-expected Next Block ID: " + strconv.Itoa(int(c.NextDBHeight)))
-	}
-
 	//prevMR and prevBlkHash are used to validate against the block next in the chain
-	prevMR, prevBlkHash, err := validateDBlock(c, c.Blocks[0])
-	if err != nil {
-		return err
-	}
-
-	//validate the genesis block
-	//prevBlkHash is the block hash for c.Blocks[0]
-	if prevBlkHash == nil || prevBlkHash.String() != common.GENESIS_DIR_BLOCK_HASH {
-
-		str := fmt.Sprintf("<pre>" +
-			"Expected: " + common.GENESIS_DIR_BLOCK_HASH + "<br>" +
-			"Found:    " + prevBlkHash.String() + "</pre><br><br>")
-		cp.CP.AddUpdate(
-			"GenHash",                    // tag
-			"warning",                    // Category
-			"Genesis Hash doesn't match", // Title
-			str, // Message
-			0)
-		// panic for Milestone 1
-		panic("Genesis Block wasn't as expected:\n" +
-			"    Expected: " + common.GENESIS_DIR_BLOCK_HASH + "\n" +
-			"    Found:    " + prevBlkHash.String())
-
-	}
-
-	for i := 1; i < len(c.Blocks); i++ {
-		if !prevBlkHash.IsSameAs(c.Blocks[i].Header.PrevLedgerKeyMR) {
-			return errors.New("Previous block hash not matching for Dir block: " + strconv.Itoa(i))
+	var prevMR, prevBlkHash *common.Hash
+	var height uint32
+	err := db.IterateDBlocks(0, database.AllShas, func(b *common.DirectoryBlock) error {
+		if b.Header.DBHeight != height {
+			return errors.New("Dir block " + strconv.Itoa(int(b.Header.DBHeight)) + " stored at height " + strconv.Itoa(int(height)))
 		}
-		if !prevMR.IsSameAs(c.Blocks[i].Header.PrevKeyMR) {
-			return errors.New("Previous merkle root not matching for Dir block: " + strconv.Itoa(i))
+		if height > 0 {
+			if !prevBlkHash.IsSameAs(b.Header.PrevLedgerKeyMR) {
+				return errors.New("Previous block hash not matching for Dir block: " + strconv.Itoa(int(height)))
+			}
+			if !prevMR.IsSameAs(b.Header.PrevKeyMR) {
+				return errors.New("Previous merkle root not matching for Dir block: " + strconv.Itoa(int(height)))
+			}
 		}
-		mr, dblkHash, err := validateDBlock(c, c.Blocks[i])
+
+		mr, dblkHash, err := validateDBlock(db, ecChainID, aChainID, b)
 		if err != nil {
-			c.Blocks[i].IsValidated = false
 			return err
 		}
 
+		//validate the genesis block
+		if height == 0 && (dblkHash == nil || dblkHash.String() != common.GENESIS_DIR_BLOCK_HASH) {
+
+			str := fmt.Sprintf("<pre>" +
+				"Expected: " + common.GENESIS_DIR_BLOCK_HASH + "<br>" +
+				"Found:    " + dblkHash.String() + "</pre><br><br>")
+			cp.CP.AddUpdate(
+				"GenHash",                    // tag
+				"warning",                    // Category
+				"Genesis Hash doesn't match", // Title
+				str, // Message
+				0)
+			// panic for Milestone 1
+			panic("Genesis Block wasn't as expected:\n" +
+				"    Expected: " + common.GENESIS_DIR_BLOCK_HASH + "\n" +
+				"    Found:    " + dblkHash.String())
+
+		}
+
 		prevMR = mr
 		prevBlkHash = dblkHash
-		c.Blocks[i].IsValidated = true
+		height++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if height != c.NextDBHeight {
+		return errors.New("Dir chain has an un-expected Next Block ID: " + strconv.Itoa(int(c.NextDBHeight)))
 	}
 
 	return nil
 }
 
 // Validate a dir block
-func validateDBlock(c *common.DChain, b *common.DirectoryBlock) (merkleRoot *common.Hash, dbHash *common.Hash, err error) {
+func validateDBlock(db database.Db, ecChainID, aChainID *common.Hash, b *common.DirectoryBlock) (merkleRoot *common.Hash, dbHash *common.Hash, err error) {
 
 	bodyMR, err := b.BuildBodyMR()
 	if err != nil {
@@ -393,23 +427,23 @@ func validateDBlock(c *common.DChain, b *common.DirectoryBlock) (merkleRoot *com
 
 	for _, dbEntry := range b.DBEntries {
 		switch dbEntry.ChainID.String() {
-		case ecchain.ChainID.String():
-			err := validateCBlockByMR(dbEntry.KeyMR)
+		case ecChainID.String():
+			err := validateCBlockByMR(db, dbEntry.KeyMR)
 			if err != nil {
 				return nil, nil, err
 			}
-		case achain.ChainID.String():
-			err := validateABlockByMR(dbEntry.KeyMR)
+		case aChainID.String():
+			err := validateABlockByMR(db, dbEntry.KeyMR)
 			if err != nil {
 				return nil, nil, err
 			}
 		case wire.FChainID.String():
-			err := validateFBlockByMR(dbEntry.KeyMR)
+			err := validateFBlockByMR(db, dbEntry.KeyMR)
 			if err != nil {
 				return nil, nil, err
 			}
 		default:
-			err := validateEBlockByMR(dbEntry.ChainID, dbEntry.KeyMR)
+			err := validateEBlockByMR(db, dbEntry.ChainID, dbEntry.KeyMR)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -423,7 +457,7 @@ func validateDBlock(c *common.DChain, b *common.DirectoryBlock) (merkleRoot *com
 }
 
 // Validate Entry Credit Block by merkle root
-func validateCBlockByMR(mr *common.Hash) error {
+func validateCBlockByMR(db database.Db, mr *common.Hash) error {
 	cb, _ := db.FetchECBlockByHash(mr)
 
 	if cb == nil {
@@ -434,7 +468,7 @@ func validateCBlockByMR(mr *common.Hash) error {
 }
 
 // Validate Admin Block by merkle root
-func validateABlockByMR(mr *common.Hash) error {
+func validateABlockByMR(db database.Db, mr *common.Hash) error {
 	b, _ := db.FetchABlockByHash(mr)
 
 	if b == nil {
@@ -445,7 +479,7 @@ func validateABlockByMR(mr *common.Hash) error {
 }
 
 // Validate FBlock by merkle root
-func validateFBlockByMR(mr *common.Hash) error {
+func validateFBlockByMR(db database.Db, mr *common.Hash) error {
 	b, _ := db.FetchFBlockByHash(mr)
 
 	if b == nil {
@@ -464,9 +498,20 @@ func validateFBlockByMR(mr *common.Hash) error {
 }
 
 // Validate Entry Block by merkle root
-func validateEBlockByMR(cid *common.Hash, mr *common.Hash) error {
+func validateEBlockByMR(db database.Db, cid *common.Hash, mr *common.Hash) error {
 
 	eb, err := db.FetchEBlockByMR(mr)
+	if err == database.ErrPruned && eb != nil {
+		// Only the header of a pruned block is left to check
+		keyMR, err := eb.HeaderKeyMR()
+		if err != nil {
+			return err
+		}
+		if !mr.IsSameAs(keyMR) {
+			return errors.New("Entry block's merkle root does not match with: " + mr.String())
+		}
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -64,6 +64,11 @@ var (
 	plMgr                 *consensus.ProcessListMgr
 	lastDirBlockTimestamp uint32
 
+	// The entry credit block objects and the entries of each chain acked
+	// for the open blocks, so no more is acked than the blocks can hold
+	ackedECObjects    uint64
+	ackedChainEntries map[string]uint32
+
 	//Server Private key and Public key for milestone 1
 	serverPrivKey common.PrivateKey
 	serverPubKey  common.PublicKey
@@ -81,9 +86,9 @@ var (
 
 var (
 	directoryBlockInSeconds int
-	dataStorePath           string
 	ldbpath                 string
 	nodeMode                string
+	pruneDepth              int
 	devNet                  bool
 	serverPrivKeyHex        string
 	serverIndex             = common.NewServerIndexNumber()
@@ -94,10 +99,10 @@ func LoadConfigurations(cfg *util.FactomdConfig) {
 
 	//setting the variables by the valued form the config file
 	logLevel = cfg.Log.LogLevel
-	dataStorePath = cfg.App.DataStorePath
 	ldbpath = cfg.App.LdbPath
 	directoryBlockInSeconds = cfg.App.DirectoryBlockInSeconds
 	nodeMode = cfg.App.NodeMode
+	pruneDepth = cfg.App.PruneDepth
 	serverPrivKeyHex = cfg.App.ServerPrivKey
 
 	cp.CP.SetPort(cfg.Controlpanel.Port)
@@ -124,6 +129,15 @@ func initProcessor() {
 
 	FactoshisPerCredit = 666666 // .001 / .15 * 100000000 (assuming a Factoid is .15 cents, entry credit = .1 cents
 
+	// Discard a directory block height a crash left partially written
+	discarded, err := database.DiscardPartialHeight(db)
+	if err != nil {
+		panic(err)
+	}
+	if discarded {
+		procLog.Warning("Discarded the partially written blocks above the last directory block")
+	}
+
 	// init Directory Block Chain
 	initDChain()
 
@@ -165,7 +179,7 @@ func initProcessor() {
 	}
 
 	// Validate all dir blocks
-	err := validateDChain(dchain)
+	err = validateDChain(db, ecchain.ChainID, achain.ChainID, dchain)
 	if err != nil {
 		if nodeMode == common.SERVER_NODE {
 			panic("Error found in validating directory blocks: " + err.Error())
@@ -412,6 +426,9 @@ func serveMsgRequest(msg wire.FtmInternalMsg) error {
 		// Handle the server case
 		if nodeMode == common.SERVER_NODE {
 			t := msgFactoidTX.Transaction
+			if !ecBlockHasRoom(len(t.GetECOutputs())) {
+				return fmt.Errorf("Entry credit block is full, cannot buy entry credits")
+			}
 			txnum := len(common.FactoidState.GetCurrentBlock().GetTransactions())
 			if common.FactoidState.AddTransaction(txnum, t) == nil {
 				if err := processBuyEntryCredit(msgFactoidTX); err != nil {
@@ -549,6 +566,12 @@ func processRevealEntry(msg *wire.MsgRevealEntry) error {
 			return fmt.Errorf("Credit needs to paid first before an entry is revealed: %s", e.Hash().String())
 		}
 
+		// Retry in the next block if this one is full
+		if nodeMode == common.SERVER_NODE && !eBlockHasRoom(e.ChainID.String()) {
+			procLog.Warning("Entry block is full for chain: " + e.ChainID.String())
+			return fMemPool.addOrphanMsg(msg, h)
+		}
+
 		// Add the msg to the Mem pool
 		fMemPool.addMsg(msg, h)
 
@@ -567,6 +590,7 @@ func processRevealEntry(msg *wire.MsgRevealEntry) error {
 				// Broadcast the ack to the network if no errors
 				outMsgQueue <- ack
 			}
+			ackedChainEntries[e.ChainID.String()]++
 		}
 
 		delete(commitEntryMap, e.Hash().String())
@@ -578,6 +602,12 @@ func processRevealEntry(msg *wire.MsgRevealEntry) error {
 				msg.Entry.ChainID.String())
 		}
 
+		// Retry in the next block if this one is full
+		if nodeMode == common.SERVER_NODE && !eBlockHasRoom(e.ChainID.String()) {
+			procLog.Warning("Directory block is full for new chain: " + e.ChainID.String())
+			return fMemPool.addOrphanMsg(msg, h)
+		}
+
 		// add new chain to chainIDMap
 		newChain := common.NewEChain()
 		newChain.ChainID = e.ChainID
@@ -631,6 +661,7 @@ func processRevealEntry(msg *wire.MsgRevealEntry) error {
 				// Broadcast the ack to the network if no errors
 				outMsgQueue <- ack
 			}
+			ackedChainEntries[e.ChainID.String()]++
 		}
 
 		delete(commitChainMap, e.Hash().String())
@@ -665,6 +696,13 @@ func processCommitEntry(msg *wire.MsgCommitEntry) error {
 		return fmt.Errorf("Not enough credits for CommitEntry")
 	}
 
+	// Retry in the next block if this one is full
+	if nodeMode == common.SERVER_NODE && !ecBlockHasRoom(1) {
+		procLog.Warning("Entry credit block is full for CommitEntry")
+		h, _ := msg.Sha()
+		return fMemPool.addOrphanMsg(msg, &h)
+	}
+
 	// add to the commitEntryMap
 	commitEntryMap[c.EntryHash.String()] = c
 
@@ -687,6 +725,7 @@ func processCommitEntry(msg *wire.MsgCommitEntry) error {
 			// Broadcast the ack to the network if no errors
 			outMsgQueue <- ack
 		}
+		ackedECObjects++
 	}
 
 	return nil
@@ -715,6 +754,13 @@ func processCommitChain(msg *wire.MsgCommitChain) error {
 		return fmt.Errorf("Not enough credits for CommitChain")
 	}
 
+	// Retry in the next block if this one is full
+	if nodeMode == common.SERVER_NODE && !ecBlockHasRoom(1) {
+		procLog.Warning("Entry credit block is full for CommitChain")
+		h, _ := msg.Sha()
+		return fMemPool.addOrphanMsg(msg, &h)
+	}
+
 	// add to the commitChainMap
 	commitChainMap[c.EntryHash.String()] = c
 
@@ -737,6 +783,7 @@ func processCommitChain(msg *wire.MsgCommitChain) error {
 			// Broadcast the ack to the network if no errors
 			outMsgQueue <- ack
 		}
+		ackedECObjects++
 	}
 
 	return nil
@@ -764,10 +811,37 @@ func processBuyEntryCredit(msg *wire.MsgFactoidTX) error {
 	if _, err := plMgr.AddMyProcessListItem(msg, &h, wire.ACK_FACTOID_TX); err != nil {
 		return err
 	}
+	ackedECObjects += uint64(len(msg.Transaction.GetECOutputs()))
 
 	return nil
 }
 
+// ecBlockReserved is the number of objects of every entry credit block that
+// are not acked: the server index and the 10 minute numbers.
+const ecBlockReserved = 11
+
+// maxAckedChainEntries is the most entries acked for a chain in one block.
+// AddEBEntry keeps room for the 10 minute markers wherever the block is, so
+// with the markers added before the last entry it takes 10 more.
+const maxAckedChainEntries = common.MAX_EBLOCK_ENTRIES - 20
+
+// ecBlockHasRoom reports whether n more objects can be acked for the open
+// entry credit block.
+func ecBlockHasRoom(n int) bool {
+	return ackedECObjects+uint64(n)+ecBlockReserved <= common.MAX_ECBLOCK_OBJECTS
+}
+
+// eBlockHasRoom reports whether one more entry of a chain can be acked for
+// its open entry block and, for the first entry of the chain in the block,
+// whether the directory block has room for one more entry block besides
+// the admin, entry credit and factoid blocks.
+func eBlockHasRoom(chainID string) bool {
+	if n, ok := ackedChainEntries[chainID]; ok {
+		return n < maxAckedChainEntries
+	}
+	return uint32(len(ackedChainEntries))+3 < common.MAX_DBLOCK_ENTRIES
+}
+
 // Process Orphan pool before the end of 10 min
 func processFromOrphanPool() error {
 	for k, msg := range fMemPool.orphans {
@@ -803,21 +877,22 @@ func processFromOrphanPool() error {
 	return nil
 }
 
-func buildRevealEntry(msg *wire.MsgRevealEntry) {
+func buildRevealEntry(msg *wire.MsgRevealEntry) error {
 	chain := chainIDMap[msg.Entry.ChainID.String()]
+	if chain == nil {
+		return errors.New("Chain not found for entry:" + msg.Entry.Hash().String())
+	}
 
-	// store the new entry in db
-	db.InsertEntry(msg.Entry)
-
+	// The entry is stored by saveBlocks, with the block that records it
 	err := chain.NextBlock.AddEBEntry(msg.Entry)
 
 	if err != nil {
-		panic("Error while adding Entity to Block:" + err.Error())
+		return errors.New("Error while adding Entity to Block:" + err.Error())
 	}
-
+	return nil
 }
 
-func buildIncreaseBalance(msg *wire.MsgFactoidTX) {
+func buildIncreaseBalance(msg *wire.MsgFactoidTX) error {
 	t := msg.Transaction
 	for i, ecout := range t.GetECOutputs() {
 		ib := common.NewIncreaseBalance()
@@ -835,41 +910,49 @@ func buildIncreaseBalance(msg *wire.MsgFactoidTX) {
 
 		ib.Index = uint64(i)
 
-		ecchain.NextBlock.AddEntry(ib)
+		if err := ecchain.NextBlock.AddEntry(ib); err != nil {
+			return errors.New("Error while adding IncreaseBalance to Block: " + err.Error())
+		}
 	}
+	return nil
 }
 
-func buildCommitEntry(msg *wire.MsgCommitEntry) {
-	ecchain.NextBlock.AddEntry(msg.CommitEntry)
+func buildCommitEntry(msg *wire.MsgCommitEntry) error {
+	if err := ecchain.NextBlock.AddEntry(msg.CommitEntry); err != nil {
+		return errors.New("Error while adding CommitEntry to Block: " + err.Error())
+	}
+	return nil
 }
 
-func buildCommitChain(msg *wire.MsgCommitChain) {
-	ecchain.NextBlock.AddEntry(msg.CommitChain)
+func buildCommitChain(msg *wire.MsgCommitChain) error {
+	if err := ecchain.NextBlock.AddEntry(msg.CommitChain); err != nil {
+		return errors.New("Error while adding CommitChain to Block: " + err.Error())
+	}
+	return nil
 }
 
-func buildRevealChain(msg *wire.MsgRevealEntry) {
+func buildRevealChain(msg *wire.MsgRevealEntry) (*common.EChain, error) {
 	chain := chainIDMap[msg.Entry.ChainID.String()]
+	if chain == nil {
+		return nil, errors.New("Chain not found for first entry:" + msg.Entry.Hash().String())
+	}
 
-	// Store the new chain in db
-	db.InsertChain(chain)
-
-	// Chain initialization
+	// Chain initialization. The chain and its first entry are stored by
+	// saveBlocks, with the block that records them
 	initEChainFromDB(chain)
 
-	// store the new entry in db
-	db.InsertEntry(chain.FirstEntry)
-
 	err := chain.NextBlock.AddEBEntry(chain.FirstEntry)
 
 	if err != nil {
-		panic(fmt.Sprintf(`Error while adding the First Entry to Block: %s`,
-			err.Error()))
+		return nil, fmt.Errorf(`Error while adding the First Entry to Block: %s`,
+			err.Error())
 	}
+	return chain, nil
 }
 
 // Loop through the Process List items and get the touched chains
 // Put End-Of-Minute marker in the entry chains
-func buildEndOfMinute(pl *consensus.ProcessList, pli *consensus.ProcessListItem) {
+func buildEndOfMinute(pl *consensus.ProcessList, pli *consensus.ProcessListItem) error {
 	tmpChains := make(map[string]*common.EChain)
 	for _, v := range pl.GetPLItems()[:pli.Ack.Index] {
 		if v.Ack.Type == wire.ACK_REVEAL_ENTRY ||
@@ -888,13 +971,18 @@ func buildEndOfMinute(pl *consensus.ProcessList, pli *consensus.ProcessListItem)
 	// Add it to the entry credit chain
 	cbEntry := common.NewMinuteNumber()
 	cbEntry.Number = pli.Ack.Type
-	ecchain.NextBlock.AddEntry(cbEntry)
+	if err := ecchain.NextBlock.AddEntry(cbEntry); err != nil {
+		return errors.New("Error while adding MinuteNumber to Block: " + err.Error())
+	}
 
 	// Add it to the admin chain
 	abEntries := achain.NextBlock.ABEntries
 	if len(abEntries) > 0 && abEntries[len(abEntries)-1].Type() != common.TYPE_MINUTE_NUM {
-		achain.NextBlock.AddEndOfMinuteMarker(pli.Ack.Type)
+		if err := achain.NextBlock.AddEndOfMinuteMarker(pli.Ack.Type); err != nil {
+			return errors.New("Error while adding EndOfMinuteEntry to Block: " + err.Error())
+		}
 	}
+	return nil
 }
 
 // build Genesis blocks
@@ -915,25 +1003,30 @@ func buildGenesisBlocks() error {
 	cBlock := newEntryCreditBlock(ecchain)
 	procLog.Debugf("buildGenesisBlocks: cBlock=%s\n", spew.Sdump(cBlock))
 	dchain.AddECBlockToDBEntry(cBlock)
-	exportECChain(ecchain)
 
 	// Admin chain
 	aBlock := newAdminBlock(achain)
 	procLog.Debugf("buildGenesisBlocks: aBlock=%s\n", spew.Sdump(aBlock))
 	dchain.AddABlockToDBEntry(aBlock)
-	exportAChain(achain)
 
 	// factoid Genesis Address
 	//fchain.NextBlock = block.GetGenesisFBlock(0, FactoshisPerCredit, 10, 200000000000)
 	fchain.NextBlock = block.GetGenesisFBlock()
 	FBlock := newFactoidBlock(fchain)
 	dchain.AddFBlockToDBEntry(FBlock)
-	exportFctChain(fchain)
 
 	// Directory Block chain
 	procLog.Debug("in buildGenesisBlocks")
 	dbBlock := newDirectoryBlock(dchain)
 
+	err = saveBlocks(dbBlock, aBlock, cBlock, FBlock, nil, nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	nextFactoidBlock(fchain)
+	anchor.UpdateDirBlockInfoMap(common.NewDirBlockInfoFromDBlock(dbBlock))
+	SignDirectoryBlock()
+
 	// Check block hash if genesis block
 	if dbBlock.DBHash.String() != common.GENESIS_DIR_BLOCK_HASH {
 		//Panic for Milestone 1
@@ -941,8 +1034,6 @@ func buildGenesisBlocks() error {
 			"\nGenesis block hash found:    " + dbBlock.DBHash.String() + "\n")
 	}
 
-	exportDChain(dchain)
-
 	// place an anchor into btc
 	placeAnchor(dbBlock)
 
@@ -951,32 +1042,39 @@ func buildGenesisBlocks() error {
 
 // build blocks from all process lists
 func buildBlocks() error {
+	// The chains are put back as they are now if the blocks fail to build
+	// or to save, so the process list can be built again
+	saved := saveChains()
 
 	// Allocate the first three dbentries for Admin block, ECBlock and Factoid block
 	dchain.AddDBEntry(&common.DBEntry{}) // AdminBlock
 	dchain.AddDBEntry(&common.DBEntry{}) // ECBlock
 	dchain.AddDBEntry(&common.DBEntry{}) // factoid
 
+	var entries []*common.Entry
+	var chains []*common.EChain
 	if plMgr != nil && plMgr.MyProcessList.IsValid() {
-		buildFromProcessList(plMgr.MyProcessList)
+		var err error
+		entries, chains, err = buildFromProcessList(plMgr.MyProcessList)
+		if err != nil {
+			saved.restore()
+			return err
+		}
 	}
 
 	// Entry Credit Chain
 	ecBlock := newEntryCreditBlock(ecchain)
 	dchain.AddECBlockToDBEntry(ecBlock)
-	exportECBlock(ecBlock)
 
 	// Admin chain
 	aBlock := newAdminBlock(achain)
 
 	dchain.AddABlockToDBEntry(aBlock)
-	exportABlock(aBlock)
 
 	// Factoid chain
 	fBlock := newFactoidBlock(fchain)
 
 	dchain.AddFBlockToDBEntry(fBlock)
-	exportFctBlock(fBlock)
 
 	// sort the echains by chain id
 	var keys []string
@@ -986,19 +1084,33 @@ func buildBlocks() error {
 	sort.Strings(keys)
 
 	// Entry Chains
+	var eBlocks []*common.EBlock
 	for _, k := range keys {
 		chain := chainIDMap[k]
 		eblock := newEntryBlock(chain)
 		if eblock != nil {
 			dchain.AddEBlockToDBEntry(eblock)
+			eBlocks = append(eBlocks, eblock)
 		}
-		exportEBlock(eblock)
 	}
 
 	// Directory Block chain
 	procLog.Debug("in buildBlocks")
 	dbBlock := newDirectoryBlock(dchain)
 
+	// Store the directory block with all of its blocks at once
+	err := saveBlocks(dbBlock, aBlock, ecBlock, fBlock, eBlocks, entries, chains)
+	if err != nil {
+		saved.restore()
+		return err
+	}
+	nextFactoidBlock(fchain)
+	anchor.UpdateDirBlockInfoMap(common.NewDirBlockInfoFromDBlock(dbBlock))
+	pruneBlocks(dbBlock.Header.DBHeight)
+
+	// To be improved in milestone 2
+	SignDirectoryBlock()
+
 	// Generate the inventory vector and relay it.
 	binary, _ := dbBlock.MarshalBinary()
 	commonHash := common.Sha(binary)
@@ -1009,8 +1121,6 @@ func buildBlocks() error {
 	db.UpdateBlockHeightCache(dbBlock.Header.DBHeight, commonHash)
 	db.UpdateNextBlockHeightCache(dchain.NextDBHeight)
 
-	exportDBlock(dbBlock)
-
 	// re-initialize the process lit manager
 	initProcessListMgr()
 
@@ -1029,28 +1139,40 @@ func buildBlocks() error {
 	return nil
 }
 
-// build blocks from a process lists
-func buildFromProcessList(pl *consensus.ProcessList) error {
+// build blocks from a process lists, and return the revealed entries and
+// new chains, which are stored with the blocks. An item the open blocks
+// cannot hold is an error, and the blocks are then only partly built.
+func buildFromProcessList(pl *consensus.ProcessList) (entries []*common.Entry, chains []*common.EChain, err error) {
 	for _, pli := range pl.GetPLItems() {
 		if pli.Ack.Type == wire.ACK_COMMIT_CHAIN {
-			buildCommitChain(pli.Msg.(*wire.MsgCommitChain))
+			err = buildCommitChain(pli.Msg.(*wire.MsgCommitChain))
 		} else if pli.Ack.Type == wire.ACK_FACTOID_TX {
-			buildIncreaseBalance(pli.Msg.(*wire.MsgFactoidTX))
+			err = buildIncreaseBalance(pli.Msg.(*wire.MsgFactoidTX))
 		} else if pli.Ack.Type == wire.ACK_COMMIT_ENTRY {
-			buildCommitEntry(pli.Msg.(*wire.MsgCommitEntry))
+			err = buildCommitEntry(pli.Msg.(*wire.MsgCommitEntry))
 		} else if pli.Ack.Type == wire.ACK_REVEAL_CHAIN {
-			buildRevealChain(pli.Msg.(*wire.MsgRevealEntry))
+			var chain *common.EChain
+			chain, err = buildRevealChain(pli.Msg.(*wire.MsgRevealEntry))
+			if err == nil {
+				chains = append(chains, chain)
+				entries = append(entries, chain.FirstEntry)
+			}
 		} else if pli.Ack.Type == wire.ACK_REVEAL_ENTRY {
-			buildRevealEntry(pli.Msg.(*wire.MsgRevealEntry))
+			msg := pli.Msg.(*wire.MsgRevealEntry)
+			err = buildRevealEntry(msg)
+			entries = append(entries, msg.Entry)
 		} else if wire.END_MINUTE_1 <= pli.Ack.Type && pli.Ack.Type <= wire.END_MINUTE_10 {
-			buildEndOfMinute(pl, pli)
+			err = buildEndOfMinute(pl, pli)
+		}
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
-	return nil
+	return entries, chains, nil
 }
 
-// Seals the current open block, store it in db and create the next open block
+// Seals the current open block and create the next open block
 func newEntryBlock(chain *common.EChain) *common.EBlock {
 	// acquire the last block
 	block := chain.NextBlock
@@ -1074,13 +1196,11 @@ func newEntryBlock(chain *common.EChain) *common.EBlock {
 		return nil
 	}
 
-	//Store the block in db
-	db.ProcessEBlockBatch(block)
 	procLog.Infof("EntryBlock: block" + strconv.FormatUint(uint64(block.Header.EBSequence), 10) + " created for chain: " + chain.ChainID.String())
 	return block
 }
 
-// Seals the current open block, store it in db and create the next open block
+// Seals the current open block and create the next open block
 func newEntryCreditBlock(chain *common.ECChain) *common.ECBlock {
 
 	// acquire the last block
@@ -1100,14 +1220,12 @@ func newEntryCreditBlock(chain *common.ECChain) *common.ECBlock {
 	chain.NextBlock.AddEntry(serverIndex)
 	chain.BlockMutex.Unlock()
 
-	//Store the block in db
-	db.ProcessECBlockBatch(block)
 	procLog.Infof("EntryCreditBlock: block" + strconv.FormatUint(uint64(block.Header.EBHeight), 10) + " created for chain: " + chain.ChainID.String())
 
 	return block
 }
 
-// Seals the current open block, store it in db and create the next open block
+// Seals the current open block and create the next open block
 func newAdminBlock(chain *common.AdminChain) *common.AdminBlock {
 
 	// acquire the last block
@@ -1137,14 +1255,14 @@ func newAdminBlock(chain *common.AdminChain) *common.AdminBlock {
 	}
 	chain.BlockMutex.Unlock()
 
-	//Store the block in db
-	db.ProcessABlockBatch(block)
 	procLog.Infof("Admin Block: block " + strconv.FormatUint(uint64(block.Header.DBHeight), 10) + " created for chain: " + chain.ChainID.String())
 
 	return block
 }
 
-// Seals the current open block, store it in db and create the next open block
+// Seals the current open block. The next open block is only created by
+// nextFactoidBlock once the block is saved, as the factoid state cannot be
+// put back.
 func newFactoidBlock(chain *common.FctChain) block.IFBlock {
 
 	older := FactoshisPerCredit
@@ -1181,21 +1299,22 @@ func newFactoidBlock(chain *common.FctChain) block.IFBlock {
 		panic("Factoid Block height does not match Directory Block height:" + strconv.Itoa(int(dchain.NextDBHeight)))
 	}
 
+	procLog.Infof("Factoid chain: block " + strconv.FormatUint(uint64(currentBlock.GetDBHeight()), 10) + " created for chain: " + chain.ChainID.String())
+
+	return currentBlock
+}
+
+// Create the next open factoid block after a saved one
+func nextFactoidBlock(chain *common.FctChain) {
 	chain.BlockMutex.Lock()
 	chain.NextBlockHeight++
 	common.FactoidState.SetFactoshisPerEC(FactoshisPerCredit)
 	common.FactoidState.ProcessEndOfBlock2(chain.NextBlockHeight)
 	chain.NextBlock = common.FactoidState.GetCurrentBlock()
 	chain.BlockMutex.Unlock()
-
-	//Store the block in db
-	db.ProcessFBlockBatch(currentBlock)
-	procLog.Infof("Factoid chain: block " + strconv.FormatUint(uint64(currentBlock.GetDBHeight()), 10) + " created for chain: " + chain.ChainID.String())
-
-	return currentBlock
 }
 
-// Seals the current open block, store it in db and create the next open block
+// Seals the current open block and create the next open block
 func newDirectoryBlock(chain *common.DChain) *common.DirectoryBlock {
 	procLog.Debug("**** new Dir Block")
 	// acquire the last block
@@ -1224,19 +1343,152 @@ func newDirectoryBlock(chain *common.DChain) *common.DirectoryBlock {
 	block.DBHash, _ = common.CreateHash(block)
 	block.BuildKeyMerkleRoot()
 
-	//Store the block in db
-	db.ProcessDBlockBatch(block)
+	procLog.Info("DirectoryBlock: block" + strconv.FormatUint(uint64(block.Header.DBHeight), 10) + " created for directory block chain: " + chain.ChainID.String())
 
-	// Initialize the dirBlockInfo obj in db
-	db.InsertDirBlockInfo(common.NewDirBlockInfoFromDBlock(block))
-	anchor.UpdateDirBlockInfoMap(common.NewDirBlockInfoFromDBlock(block))
+	return block
+}
 
-	procLog.Info("DirectoryBlock: block" + strconv.FormatUint(uint64(block.Header.DBHeight), 10) + " created for directory block chain: " + chain.ChainID.String())
+// saveBlocks stores a directory block, the blocks it lists, the new entries
+// and chains they record and its dirBlockInfo in a single batch, so that a
+// crash never leaves a partially written directory block height in db.
+func saveBlocks(dBlock *common.DirectoryBlock, aBlock *common.AdminBlock, ecBlock *common.ECBlock, fBlock block.IFBlock, eBlocks []*common.EBlock, entries []*common.Entry, chains []*common.EChain) error {
+	db.StartBatch()
 
-	// To be improved in milestone 2
-	SignDirectoryBlock()
+	var err error
+	for _, entry := range entries {
+		if err == nil {
+			err = db.InsertEntryMultiBatch(entry)
+		}
+	}
+	for _, chain := range chains {
+		if err == nil {
+			err = db.InsertChainMultiBatch(chain)
+		}
+	}
+	if err == nil {
+		err = db.ProcessECBlockMultiBatch(ecBlock)
+	}
+	if err == nil {
+		err = db.ProcessABlockMultiBatch(aBlock)
+	}
+	if err == nil {
+		err = db.ProcessFBlockMultiBatch(fBlock)
+	}
+	for _, eBlock := range eBlocks {
+		if err == nil {
+			err = db.ProcessEBlockMultiBatch(eBlock)
+		}
+	}
+	if err == nil {
+		err = db.ProcessDBlockMultiBatch(dBlock)
+	}
+	if err == nil {
+		err = db.InsertDirBlockInfoMultiBatch(common.NewDirBlockInfoFromDBlock(dBlock))
+	}
+	if err != nil {
+		db.CancelBatch()
+		return err
+	}
 
-	return block
+	return db.EndBatch()
+}
+
+// chainsState is a copy of the open blocks and heights of the chains, which
+// building a directory block moves on.
+type chainsState struct {
+	dBlock   *common.DirectoryBlock
+	dHeight  uint32
+	dBlocks  int
+	ecBlock  *common.ECBlock
+	ecHeight uint32
+	aBlock   *common.AdminBlock
+	aHeight  uint32
+	eBlocks  map[string]*common.EBlock
+	eHeights map[string]uint32
+}
+
+// saveChains copies the open blocks and heights of the chains. The blocks
+// are copied down to their entry lists, which building them appends to.
+func saveChains() *chainsState {
+	s := new(chainsState)
+
+	dBlock := *dchain.NextBlock
+	dHeader := *dBlock.Header
+	dBlock.Header = &dHeader
+	dBlock.DBEntries = append([]*common.DBEntry(nil), dBlock.DBEntries...)
+	s.dBlock = &dBlock
+	s.dHeight = dchain.NextDBHeight
+	s.dBlocks = len(dchain.Blocks)
+
+	ecBlock := *ecchain.NextBlock
+	ecHeader := *ecBlock.Header
+	ecBlock.Header = &ecHeader
+	ecBlock.Body = &common.ECBlockBody{Entries: append([]common.ECBlockEntry(nil), ecBlock.Body.Entries...)}
+	s.ecBlock = &ecBlock
+	s.ecHeight = ecchain.NextBlockHeight
+
+	aBlock := *achain.NextBlock
+	aHeader := *aBlock.Header
+	aBlock.Header = &aHeader
+	aBlock.ABEntries = append([]common.ABEntry(nil), aBlock.ABEntries...)
+	s.aBlock = &aBlock
+	s.aHeight = achain.NextBlockHeight
+
+	s.eBlocks = make(map[string]*common.EBlock)
+	s.eHeights = make(map[string]uint32)
+	for k, chain := range chainIDMap {
+		if chain.NextBlock != nil {
+			eBlock := *chain.NextBlock
+			eHeader := *eBlock.Header
+			eBlock.Header = &eHeader
+			eBlock.Body = &common.EBlockBody{EBEntries: append([]*common.Hash(nil), eBlock.Body.EBEntries...)}
+			s.eBlocks[k] = &eBlock
+		}
+		s.eHeights[k] = chain.NextBlockHeight
+	}
+	return s
+}
+
+// restore puts the chains back as they were when s was saved.
+func (s *chainsState) restore() {
+	dchain.BlockMutex.Lock()
+	dchain.NextBlock = s.dBlock
+	dchain.NextDBHeight = s.dHeight
+	dchain.Blocks = dchain.Blocks[:s.dBlocks]
+	dchain.BlockMutex.Unlock()
+
+	ecchain.BlockMutex.Lock()
+	ecchain.NextBlock = s.ecBlock
+	ecchain.NextBlockHeight = s.ecHeight
+	ecchain.BlockMutex.Unlock()
+
+	achain.BlockMutex.Lock()
+	achain.NextBlock = s.aBlock
+	achain.NextBlockHeight = s.aHeight
+	achain.BlockMutex.Unlock()
+
+	for k, chain := range chainIDMap {
+		chain.NextBlock = s.eBlocks[k]
+		chain.NextBlockHeight = s.eHeights[k]
+	}
+}
+
+// pruneBlocks drops the entries and entry block bodies recorded more than
+// pruneDepth directory blocks below height from db, when pruning is on.
+// Failing to prune does not stop the node.
+func pruneBlocks(height uint32) {
+	if pruneDepth <= 0 || int64(height)+1 <= int64(pruneDepth) {
+		return
+	}
+	below := height + 1 - uint32(pruneDepth)
+	pruned, err := db.PruneBelowHeight(below)
+	if err != nil {
+		procLog.Error("Pruning below directory block ", below, " failed: ", err)
+		return
+	}
+	if pruned > 0 {
+		procLog.Debug("Pruned ", pruned, " entry blocks below directory block ", below)
+	}
 }
 
 // Sign the directory block
@@ -1248,7 +1500,7 @@ func SignDirectoryBlock() error {
 		dbHeaderBytes, _ := dbBlock.Header.MarshalBinary()
 		identityChainID := common.NewHash() // 0 ID for milestone 1
 		sig := serverPrivKey.Sign(dbHeaderBytes)
-		achain.NextBlock.AddABEntry(common.NewDBSignatureEntry(identityChainID, sig))
+		return achain.NextBlock.AddABEntry(common.NewDBSignatureEntry(identityChainID, sig))
 	}
 	return nil
 }
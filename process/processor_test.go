@@ -0,0 +1,167 @@
+// Copyright 2015 FactomProject Authors. All rights reserved.
+// Use of this source code is governed by the MIT license
+// that can be found in the LICENSE file.
+
+package process
+
+import (
+	"encoding/binary"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/btcd/wire"
+	fct "github.com/FactomProject/factoid"
+)
+
+// setupServer sets up a server with empty open blocks and an entry credit
+// key holding credits.
+func setupServer(t *testing.T, credits int32) *[32]byte {
+	nodeMode = common.SERVER_NODE
+	if err := serverPrivKey.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+	fMemPool = new(ftmMemPool)
+	fMemPool.init_ftmMemPool()
+	outMsgQueue = make(chan wire.FtmInternalMsg, 100)
+
+	dchain = common.NewDChain()
+	dchain.ChainID = new(common.Hash)
+	dchain.ChainID.SetBytes(common.D_CHAINID)
+	ecchain = common.NewECChain()
+	ecchain.NextBlock = common.NewECBlock()
+	achain = new(common.AdminChain)
+	achain.ChainID = new(common.Hash)
+	achain.ChainID.SetBytes(common.ADMIN_CHAINID)
+	fchain = new(common.FctChain)
+	fchain.ChainID = new(common.Hash)
+	fchain.ChainID.SetBytes(fct.FACTOID_CHAINID)
+
+	chainIDMap = make(map[string]*common.EChain)
+	commitChainMap = make(map[string]*common.CommitChain)
+	commitEntryMap = make(map[string]*common.CommitEntry)
+	initProcessListMgr()
+
+	pub := new([32]byte)
+	pub[0] = 1
+	eCreditMap = map[string]int32{string(pub[:]): credits}
+	return pub
+}
+
+// newTestCommitEntry returns a commit of 1 entry credit for entry.
+func newTestCommitEntry(pub *[32]byte, entry *common.Entry) *wire.MsgCommitEntry {
+	c := common.NewCommitEntry()
+	milli := make([]byte, 8)
+	binary.BigEndian.PutUint64(milli, uint64(time.Now().UnixNano()/1e6))
+	copy(c.MilliTime[:], milli[2:])
+	c.EntryHash = entry.Hash()
+	c.Credits = 1
+	c.ECPubKey = pub
+
+	msg := wire.NewMsgCommitEntry()
+	msg.CommitEntry = c
+	return msg
+}
+
+func newTestEntry(chainID *common.Hash, i int) *common.Entry {
+	entry := common.NewEntry()
+	entry.ChainID = chainID
+	entry.Content = []byte("entry " + strconv.Itoa(i))
+	return entry
+}
+
+func isOrphan(msg wire.Message, hash *wire.ShaHash) bool {
+	orphan, ok := fMemPool.orphans[*hash]
+	return ok && orphan == msg
+}
+
+func TestECBlockAdmission(t *testing.T) {
+	pub := setupServer(t, 10)
+	chainID := common.Sha([]byte("admission"))
+
+	// One more object fills the entry credit block
+	ackedECObjects = common.MAX_ECBLOCK_OBJECTS - ecBlockReserved - 1
+
+	last := newTestCommitEntry(pub, newTestEntry(chainID, 0))
+	if err := processCommitEntry(last); err != nil {
+		t.Fatal(err)
+	}
+	if ackedECObjects != common.MAX_ECBLOCK_OBJECTS-ecBlockReserved {
+		t.Fatalf("%v objects acked, want %v", ackedECObjects, common.MAX_ECBLOCK_OBJECTS-ecBlockReserved)
+	}
+
+	next := newTestCommitEntry(pub, newTestEntry(chainID, 1))
+	if err := processCommitEntry(next); err != nil {
+		t.Fatal(err)
+	}
+	h, _ := next.Sha()
+	if !isOrphan(next, &h) {
+		t.Error("commit past a full entry credit block is not in the orphan pool")
+	}
+	if _, ok := commitEntryMap[next.CommitEntry.EntryHash.String()]; ok {
+		t.Error("commit past a full entry credit block was admitted")
+	}
+	if n := len(plMgr.MyProcessList.GetPLItems()); n != 1 {
+		t.Errorf("%v items acked, want 1", n)
+	}
+	if credits := eCreditMap[string(pub[:])]; credits != 9 {
+		t.Errorf("%v credits left, want 9", credits)
+	}
+}
+
+func TestEBlockAdmission(t *testing.T) {
+	pub := setupServer(t, 10)
+	chainID := common.Sha([]byte("admission"))
+	chain := common.NewEChain()
+	chain.ChainID = chainID
+	chainIDMap[chainID.String()] = chain
+
+	// One more entry fills the entry block of the chain
+	ackedChainEntries[chainID.String()] = maxAckedChainEntries - 1
+
+	var reveals []*wire.MsgRevealEntry
+	for i := 0; i < 2; i++ {
+		entry := newTestEntry(chainID, i)
+		commit := newTestCommitEntry(pub, entry)
+		commitEntryMap[entry.Hash().String()] = commit.CommitEntry
+
+		reveal := wire.NewMsgRevealEntry()
+		reveal.Entry = entry
+		if err := processRevealEntry(reveal); err != nil {
+			t.Fatal(err)
+		}
+		reveals = append(reveals, reveal)
+	}
+
+	if n := ackedChainEntries[chainID.String()]; n != maxAckedChainEntries {
+		t.Errorf("%v entries acked for the chain, want %v", n, maxAckedChainEntries)
+	}
+	h, _ := wire.NewShaHash(reveals[1].Entry.Hash().Bytes())
+	if !isOrphan(reveals[1], h) {
+		t.Error("entry past a full entry block is not in the orphan pool")
+	}
+	if _, ok := commitEntryMap[reveals[1].Entry.Hash().String()]; !ok {
+		t.Error("the commit of an entry past a full entry block was used")
+	}
+	if n := len(plMgr.MyProcessList.GetPLItems()); n != 1 {
+		t.Errorf("%v items acked, want 1", n)
+	}
+}
+
+func TestBuildFullECBlock(t *testing.T) {
+	pub := setupServer(t, 10)
+
+	commit := newTestCommitEntry(pub, newTestEntry(common.Sha([]byte("build")), 0))
+	if err := processCommitEntry(commit); err != nil {
+		t.Fatal(err)
+	}
+
+	// The open block filled up without the objects being acked here, like
+	// on a node that builds the process list of another server
+	ecchain.NextBlock.Body.Entries = make([]common.ECBlockEntry, common.MAX_ECBLOCK_OBJECTS)
+
+	if _, _, err := buildFromProcessList(plMgr.MyProcessList); err == nil {
+		t.Error("built a commit into a full entry credit block")
+	}
+}
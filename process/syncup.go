@@ -12,6 +12,7 @@ import (
 	cp "github.com/FactomProject/FactomCode/controlpanel"
 	"github.com/FactomProject/FactomCode/database"
 	"github.com/FactomProject/btcd/wire"
+	"github.com/FactomProject/factoid/block"
 	"github.com/FactomProject/go-spew/spew"
 	"strconv"
 	"time"
@@ -201,7 +202,9 @@ func validateAndStoreBlocks(fMemPool *ftmMemPool, db database.Db, dchain *common
 				if err == nil {
 					deleteBlocksFromMemPool(dblk, fMemPool)
 				} else {
-					panic("error in storeBlocksFromMemPool. " + err.Error())
+					// Refuse the block and try it again later
+					procLog.Error("error in storeBlocksFromMemPool. " + err.Error())
+					time.Sleep(time.Duration(sleeptime * 1000000)) // Nanoseconds for duration
 				}
 			} else {
 				time.Sleep(time.Duration(sleeptime * 1000000)) // Nanoseconds for duration
@@ -290,101 +293,122 @@ func validateBlocksFromMemPool(b *common.DirectoryBlock, fMemPool *ftmMemPool, d
 	return true
 }
 
-// Validate the new blocks in mem pool and store them in db
-// Need to make a batch insert in db in milestone 2
+// Validate the new blocks in mem pool and store them in db, all in one
+// batch with the dir block
 func storeBlocksFromMemPool(b *common.DirectoryBlock, fMemPool *ftmMemPool, db database.Db) error {
 	fMemPool.RLock()
 	defer fMemPool.RUnlock()
 
+	// Collect the blocks first: db cannot be read while the batch is open
+	var ecBlock *common.ECBlock
+	var aBlock *common.AdminBlock
+	var fBlock block.IFBlock
+	var eBlocks []*common.EBlock
+	var entries []*common.Entry
+	var chains []*common.EChain
 	for _, dbEntry := range b.DBEntries {
 		switch dbEntry.ChainID.String() {
 		case ecchain.ChainID.String():
-			ecBlkMsg := fMemPool.blockpool[dbEntry.KeyMR.String()].(*wire.MsgECBlock)
-			err := db.ProcessECBlockBatch(ecBlkMsg.ECBlock)
-			if err != nil {
-				return err
-			}
-			// needs to be improved??
-			initializeECreditMap(ecBlkMsg.ECBlock)
-			// for debugging
-			exportECBlock(ecBlkMsg.ECBlock)
+			ecBlock = fMemPool.blockpool[dbEntry.KeyMR.String()].(*wire.MsgECBlock).ECBlock
 		case achain.ChainID.String():
-			aBlkMsg := fMemPool.blockpool[dbEntry.KeyMR.String()].(*wire.MsgABlock)
-			err := db.ProcessABlockBatch(aBlkMsg.ABlk)
-			if err != nil {
-				return err
-			}
-			// for debugging
-			exportABlock(aBlkMsg.ABlk)
+			aBlock = fMemPool.blockpool[dbEntry.KeyMR.String()].(*wire.MsgABlock).ABlk
 		case fchain.ChainID.String():
-			fBlkMsg := fMemPool.blockpool[dbEntry.KeyMR.String()].(*wire.MsgFBlock)
-			err := db.ProcessFBlockBatch(fBlkMsg.SC)
-			if err != nil {
-				return err
-			}
-			// Initialize the Factoid State
-			err = common.FactoidState.AddTransactionBlock(fBlkMsg.SC)
-			FactoshisPerCredit = fBlkMsg.SC.GetExchRate()
-			if err != nil {
-				return err
-			}
-
-			// for debugging
-			exportFctBlock(fBlkMsg.SC)
+			fBlock = fMemPool.blockpool[dbEntry.KeyMR.String()].(*wire.MsgFBlock).SC
 		default:
 			// handle Entry Block
 			eBlkMsg, _ := fMemPool.blockpool[dbEntry.KeyMR.String()].(*wire.MsgEBlock)
-			// store entry in db first
+			// store the entries in mem pool with the block
 			for _, ebEntry := range eBlkMsg.EBlk.Body.EBEntries {
 				if msg, foundInMemPool := fMemPool.blockpool[ebEntry.String()]; foundInMemPool {
-					err := db.InsertEntry(msg.(*wire.MsgEntry).Entry)
-					if err != nil {
-						return err
-					}
+					entries = append(entries, msg.(*wire.MsgEntry).Entry)
 				}
 			}
-			// Store Entry Block in db
-			err := db.ProcessEBlockBatch(eBlkMsg.EBlk)
-			if err != nil {
-				return err
-			}
+			eBlocks = append(eBlocks, eBlkMsg.EBlk)
 
 			// create a chain when it's the first block of the entry chain
 			if eBlkMsg.EBlk.Header.EBSequence == 0 {
 				chain := new(common.EChain)
 				chain.ChainID = eBlkMsg.EBlk.Header.ChainID
-				chain.FirstEntry, _ = db.FetchEntryByHash(eBlkMsg.EBlk.Body.EBEntries[0])
+				firstEntry := eBlkMsg.EBlk.Body.EBEntries[0]
+				if msg, foundInMemPool := fMemPool.blockpool[firstEntry.String()]; foundInMemPool {
+					chain.FirstEntry = msg.(*wire.MsgEntry).Entry
+				} else {
+					chain.FirstEntry, _ = db.FetchEntryByHash(firstEntry)
+				}
 				if chain.FirstEntry == nil {
 					return errors.New("First entry not found for chain:" + eBlkMsg.EBlk.Header.ChainID.String())
 				}
-
-				db.InsertChain(chain)
-				chainIDMap[chain.ChainID.String()] = chain
+				chains = append(chains, chain)
 			}
-
-			// for debugging
-			exportEBlock(eBlkMsg.EBlk)
 		}
 	}
 
 	dbhash, dbHeight, _ := db.FetchBlockHeightCache()
 	//fmt.Printf("last block height is %d, to-be-saved block height is %d\n", dbHeight, b.Header.DBHeight)
 
-	// Store the dir block
-	err := db.ProcessDBlockBatch(b)
+	// Store the dir block with all of its blocks at once
+	db.StartBatch()
+	var err error
+	for _, entry := range entries {
+		if err == nil {
+			err = db.InsertEntryMultiBatch(entry)
+		}
+	}
+	for _, chain := range chains {
+		if err == nil {
+			err = db.InsertChainMultiBatch(chain)
+		}
+	}
+	if err == nil && ecBlock != nil {
+		err = db.ProcessECBlockMultiBatch(ecBlock)
+	}
+	if err == nil && aBlock != nil {
+		err = db.ProcessABlockMultiBatch(aBlock)
+	}
+	if err == nil && fBlock != nil {
+		err = db.ProcessFBlockMultiBatch(fBlock)
+	}
+	for _, eBlock := range eBlocks {
+		if err == nil {
+			err = db.ProcessEBlockMultiBatch(eBlock)
+		}
+	}
+	if err == nil {
+		err = db.ProcessDBlockMultiBatch(b)
+	}
+	if err != nil {
+		db.CancelBatch()
+		return err
+	}
+	err = db.EndBatch()
 	if err != nil {
 		return err
 	}
 
+	// Update the in-memory state only once the blocks are stored
+	if ecBlock != nil {
+		// needs to be improved??
+		initializeECreditMap(ecBlock)
+	}
+	if fBlock != nil {
+		// Initialize the Factoid State
+		err = common.FactoidState.AddTransactionBlock(fBlock)
+		FactoshisPerCredit = fBlock.GetExchRate()
+		if err != nil {
+			return err
+		}
+	}
+	for _, chain := range chains {
+		chainIDMap[chain.ChainID.String()] = chain
+	}
+	pruneBlocks(b.Header.DBHeight)
+
 	lastDirBlockTimestamp = b.Header.Timestamp
 
 	// Update dir block height cache in db
 	commonHash, _ := common.CreateHash(b)
 	db.UpdateBlockHeightCache(b.Header.DBHeight, commonHash)
 
-	// for debugging
-	exportDBlock(b)
-
 	// this means, there's syncup breakage happened, and let's renew syncup.
 	if uint32(dbHeight) < b.Header.DBHeight-1 {
 		startHash, _ := wire.NewShaHash(dbhash.Bytes())
@@ -438,8 +462,16 @@ func validateDBSignature(aBlock *common.AdminBlock, dchain *common.DChain) bool
 		if serverPubKey.String() != dbSig.PubKey.String() {
 			return false
 		} else {
-			// obtain the previous directory block
-			dblk := dchain.Blocks[aBlock.Header.DBHeight-1]
+			// obtain the previous directory block, from db if it was
+			// stored before the node started
+			var dblk *common.DirectoryBlock
+			prevHeight := aBlock.Header.DBHeight - 1
+			if prevHeight < uint32(len(dchain.Blocks)) {
+				dblk = dchain.Blocks[prevHeight]
+			}
+			if dblk == nil {
+				dblk, _ = db.FetchDBlockByHeight(prevHeight)
+			}
 			if dblk == nil {
 				return false
 			} else {
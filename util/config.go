@@ -15,6 +15,9 @@ type FactomdConfig struct {
 		HomeDir                 string
 		LdbPath                 string
 		BoltDBPath              string
+		DBType                  string
+		LdbCompression          string
+		PruneDepth              int
 		DataStorePath           string
 		DirectoryBlockInSeconds int
 		NodeMode                string
@@ -51,6 +54,12 @@ type FactomdConfig struct {
 		PortNumber      int
 		ApplicationName string
 	}
+	DBCache struct {
+		DBlocks    int
+		EBlocks    int
+		Entries    int
+		ChainHeads int
+	}
 	Log struct {
 		LogPath  string
 		LogLevel string
@@ -88,6 +97,12 @@ PortNumber				      		= 8088
 HomeDir								= ""
 LdbPath					        	= "ldb"
 BoltDBPath							= ""
+; --------------- DBType: LDB | BOLT ----------------
+DBType								= LDB
+; --------------- LdbCompression: NONE | SNAPPY, for either DBType ----------------
+LdbCompression							= NONE
+; --------------- PruneDepth: 0 keeps everything, N keeps the entries of the last N directory blocks ----------------
+PruneDepth							= 0
 DataStorePath			      		= "data/export/"
 DirectoryBlockInSeconds				= 60
 ; --------------- NodeMode: FULL | SERVER | LIGHT ----------------
@@ -118,6 +133,15 @@ RpcPass								= notarychain
 ApplicationName						= "Factom/wsapi"
 PortNumber				  			= 8088
 
+; ------------------------------------------------------------------------------
+; Number of recently fetched objects cached in memory, 0 disables a cache
+; ------------------------------------------------------------------------------
+[DBCache]
+DBlocks								= 1000
+EBlocks								= 1000
+Entries								= 10000
+ChainHeads							= 1000
+
 ; ------------------------------------------------------------------------------
 ; logLevel - allowed values are: debug, info, notice, warning, error, critical, alert, emergency and none
 ; ------------------------------------------------------------------------------
@@ -9,6 +9,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math"
+	"strconv"
 
 	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/FactomCode/database"
@@ -57,11 +59,18 @@ func Start(db database.Db, inMsgQ chan wire.FtmInternalMsg) {
 	server.Get("/v1/get-raw-data/([^/]+)", handleGetRaw)
 	server.Get("/v1/directory-block-by-keymr/([^/]+)", handleDirectoryBlock)
 	server.Get("/v1/directory-block-height/?", handleDirectoryBlockHeight)
+	server.Get("/v1/directory-block-by-time/([^/]+)", handleDirectoryBlockByTime)
 	server.Get("/v1/entry-block-by-keymr/([^/]+)", handleEntryBlock)
+	server.Get("/v1/entry-block-by-sequence/([^/]+)/([^/]+)", handleEntryBlockBySequence)
 	server.Get("/v1/entry-by-hash/([^/]+)", handleEntry)
+	server.Get("/v1/receipt/([^/]+)", handleReceipt)
 	server.Get("/v1/chain-head/([^/]+)", handleChainHead)
+	server.Get("/v1/chains/?", handleChains)
+	server.Get("/v1/chain-stats/([^/]+)", handleChainStats)
 	server.Get("/v1/entry-credit-balance/([^/]+)", handleEntryCreditBalance)
+	server.Get("/v1/entry-credit-balance-at/([^/]+)/([^/]+)", handleEntryCreditBalanceAt)
 	server.Get("/v1/factoid-balance/([^/]+)", handleFactoidBalance)
+	server.Get("/v1/factoid-balance-at/([^/]+)/([^/]+)", handleFactoidBalanceAt)
 	server.Get("/v1/factoid-get-fee/", handleGetFee)
 	server.Get("/v1/properties/", handleProperties)
 
@@ -279,12 +288,36 @@ func handleDirectoryBlockHeight(ctx *web.Context) {
 }
 
 func handleDirectoryBlock(ctx *web.Context, keymr string) {
+	block, err := factomapi.DBlockByKeyMR(keymr)
+	writeDirectoryBlock(ctx, block, err)
+}
+
+// handleDirectoryBlockByTime returns the directory block covering a Unix
+// time in seconds. The minutes of the time have to fit the uint32
+// timestamps of the directory blocks.
+func handleDirectoryBlockByTime(ctx *web.Context, unix string) {
+	t, err := strconv.ParseUint(unix, 10, 64)
+	if err == nil && t > math.MaxUint32*60 {
+		err = fmt.Errorf("Time %v is past the last directory block timestamp", t)
+	}
+	if err != nil {
+		writeDirectoryBlock(ctx, nil, err)
+		return
+	}
+	block, err := factomapi.DBlockByTime(uint32(t / 60))
+	writeDirectoryBlock(ctx, block, err)
+}
+
+// writeDirectoryBlock writes a directory block fetched by one of the
+// directory block handlers, or the error fetching it.
+func writeDirectoryBlock(ctx *web.Context, block *common.DirectoryBlock, err error) {
 	type eblockaddr struct {
 		ChainID string
 		KeyMR   string
 	}
 
 	type dblock struct {
+		KeyMR  string
 		Header struct {
 			PrevBlockKeyMR string
 			SequenceNumber uint32
@@ -294,12 +327,16 @@ func handleDirectoryBlock(ctx *web.Context, keymr string) {
 	}
 
 	d := new(dblock)
-	if block, err := factomapi.DBlockByKeyMR(keymr); err != nil {
+	if err != nil {
 		wsLog.Error(err)
 		ctx.WriteHeader(httpBad)
 		ctx.Write([]byte(err.Error()))
 		return
 	} else {
+		if block.KeyMR == nil {
+			block.BuildKeyMerkleRoot()
+		}
+		d.KeyMR = block.KeyMR.String()
 		d.Header.PrevBlockKeyMR = block.Header.PrevKeyMR.String()
 		d.Header.SequenceNumber = block.Header.DBHeight
 		d.Header.Timestamp = block.Header.Timestamp * 60
@@ -319,11 +356,28 @@ func handleDirectoryBlock(ctx *web.Context, keymr string) {
 	} else {
 		ctx.Write(p)
 	}
-
-	//	ctx.WriteHeader(httpOK)
 }
 
 func handleEntryBlock(ctx *web.Context, keymr string) {
+	block, err := factomapi.EBlockByKeyMR(keymr)
+	writeEntryBlock(ctx, block, err)
+}
+
+// handleEntryBlockBySequence returns the entry block of a chain by its
+// sequence number.
+func handleEntryBlockBySequence(ctx *web.Context, chainid string, seq string) {
+	n, err := strconv.ParseUint(seq, 10, 32)
+	if err != nil {
+		writeEntryBlock(ctx, nil, err)
+		return
+	}
+	block, err := factomapi.EBlockBySequence(chainid, uint32(n))
+	writeEntryBlock(ctx, block, err)
+}
+
+// writeEntryBlock writes an entry block fetched by one of the entry block
+// handlers, or the error fetching it.
+func writeEntryBlock(ctx *web.Context, block *common.EBlock, err error) {
 	type entryaddr struct {
 		EntryHash string
 		Timestamp uint32
@@ -340,7 +394,7 @@ func handleEntryBlock(ctx *web.Context, keymr string) {
 	}
 
 	e := new(eblock)
-	if block, err := factomapi.EBlockByKeyMR(keymr); err != nil {
+	if err != nil {
 		wsLog.Error(err)
 		ctx.WriteHeader(httpBad)
 		ctx.Write([]byte(err.Error()))
@@ -423,6 +477,24 @@ func handleEntry(ctx *web.Context, hash string) {
 	}
 }
 
+// handleReceipt writes the receipt of an entry in the JSON encoding of
+// common.Receipt, which Receipt.Verify checks without a node.
+func handleReceipt(ctx *web.Context, hash string) {
+	if receipt, err := factomapi.Receipt(hash); err != nil {
+		wsLog.Error(err)
+		ctx.WriteHeader(httpBad)
+		ctx.Write([]byte(err.Error()))
+		return
+	} else if p, err := json.Marshal(receipt); err != nil {
+		wsLog.Error(err)
+		ctx.WriteHeader(httpBad)
+		ctx.Write([]byte(err.Error()))
+		return
+	} else {
+		ctx.Write(p)
+	}
+}
+
 func handleChainHead(ctx *web.Context, chainid string) {
 	type chead struct {
 		ChainHead string
@@ -448,6 +520,89 @@ func handleChainHead(ctx *web.Context, chainid string) {
 	}
 }
 
+// chainstats is the JSON form of database.ChainStats.
+type chainstats struct {
+	ChainID          string
+	FirstEntry       string
+	FirstEntryExtIDs []string
+	EBlockCount      uint32
+	EntryCount       uint32
+	TotalBytes       uint64
+	FirstHeight      uint32
+	LastHeight       uint32
+}
+
+func newChainStats(s *database.ChainStats) *chainstats {
+	c := new(chainstats)
+	c.ChainID = s.ChainID.String()
+	if s.FirstEntry != nil {
+		c.FirstEntry = s.FirstEntry.String()
+	}
+	for _, v := range s.FirstEntryExtIDs {
+		c.FirstEntryExtIDs = append(c.FirstEntryExtIDs, hex.EncodeToString(v))
+	}
+	c.EBlockCount = s.EBlockCount
+	c.EntryCount = s.EntryCount
+	c.TotalBytes = s.TotalBytes
+	c.FirstHeight = s.FirstHeight
+	c.LastHeight = s.LastHeight
+	return c
+}
+
+// handleChains lists the entry chains with their statistics, a page at a
+// time. The cursor query parameter, from the Next field of the previous
+// page, fetches the following page.
+func handleChains(ctx *web.Context) {
+	type chains struct {
+		Chains []*chainstats
+		Next   string
+	}
+
+	c := new(chains)
+	c.Chains = make([]*chainstats, 0)
+	if stats, next, err := factomapi.Chains(ctx.Params["cursor"]); err != nil {
+		wsLog.Error(err)
+		ctx.WriteHeader(httpBad)
+		ctx.Write([]byte(err.Error()))
+		return
+	} else {
+		for _, s := range stats {
+			c.Chains = append(c.Chains, newChainStats(s))
+		}
+		c.Next = next
+	}
+
+	if p, err := json.Marshal(c); err != nil {
+		wsLog.Error(err)
+		ctx.WriteHeader(httpBad)
+		ctx.Write([]byte(err.Error()))
+		return
+	} else {
+		ctx.Write(p)
+	}
+}
+
+func handleChainStats(ctx *web.Context, chainid string) {
+	var c *chainstats
+	if stats, err := factomapi.ChainStats(chainid); err != nil {
+		wsLog.Error(err)
+		ctx.WriteHeader(httpBad)
+		ctx.Write([]byte(err.Error()))
+		return
+	} else {
+		c = newChainStats(stats)
+	}
+
+	if p, err := json.Marshal(c); err != nil {
+		wsLog.Error(err)
+		ctx.WriteHeader(httpBad)
+		ctx.Write([]byte(err.Error()))
+		return
+	} else {
+		ctx.Write(p)
+	}
+}
+
 type ecbal struct {
 	Balance uint32
 }
@@ -483,6 +638,41 @@ func handleEntryCreditBalance(ctx *web.Context, eckey string) {
 
 }
 
+// handleEntryCreditBalanceAt returns the balance of an entry credit key as
+// of the entry credit block at a directory block height.
+func handleEntryCreditBalanceAt(ctx *web.Context, eckey string, height string) {
+	type ecbal struct {
+		Response string
+		Success  bool
+	}
+	var b ecbal
+	adr, err := hex.DecodeString(eckey)
+	if err == nil && len(adr) != common.HASH_LENGTH {
+		err = fmt.Errorf("Invalid Address")
+	}
+	var h uint64
+	if err == nil {
+		h, err = strconv.ParseUint(height, 10, 32)
+	}
+	if err == nil {
+		if bal, err := factomapi.ECBalanceAt(eckey, uint32(h)); err != nil {
+			b = ecbal{Response: err.Error(), Success: false}
+		} else {
+			str := fmt.Sprintf("%d", bal)
+			b = ecbal{Response: str, Success: true}
+		}
+	} else {
+		b = ecbal{Response: err.Error(), Success: false}
+	}
+
+	if p, err := json.Marshal(b); err != nil {
+		wsLog.Error(err)
+		return
+	} else {
+		ctx.Write(p)
+	}
+}
+
 func handleFactoidBalance(ctx *web.Context, eckey string) {
 	type fbal struct {
 		Response string
@@ -510,6 +700,39 @@ func handleFactoidBalance(ctx *web.Context, eckey string) {
 
 }
 
+func handleFactoidBalanceAt(ctx *web.Context, eckey string, height string) {
+	type fbal struct {
+		Response string
+		Success  bool
+	}
+	var b fbal
+	adr, err := hex.DecodeString(eckey)
+	if err == nil && len(adr) != common.HASH_LENGTH {
+		err = fmt.Errorf("Invalid Address")
+	}
+	var h uint64
+	if err == nil {
+		h, err = strconv.ParseUint(height, 10, 32)
+	}
+	if err == nil {
+		if bal, err := factomapi.FactoidBalanceAt(eckey, uint32(h)); err != nil {
+			b = fbal{Response: err.Error(), Success: false}
+		} else {
+			str := fmt.Sprintf("%d", bal)
+			b = fbal{Response: str, Success: true}
+		}
+	} else {
+		b = fbal{Response: err.Error(), Success: false}
+	}
+
+	if p, err := json.Marshal(b); err != nil {
+		wsLog.Error(err)
+		return
+	} else {
+		ctx.Write(p)
+	}
+}
+
 func returnMsg(ctx *web.Context, msg string, success bool) {
 	type rtn struct {
 		Response string
@@ -609,10 +832,10 @@ func handleGetRaw(ctx *web.Context, hashkey string) {
 	} else if block, _ := dbase.FetchDBlockByMR(h); block != nil {
 		bytes, _ := block.MarshalBinary()
 		d.Data = hex.EncodeToString(bytes[:])
-	} else if block, _ := dbase.FetchEBlockByHash(h); block != nil {
+	} else if block, err := dbase.FetchEBlockByHash(h); block != nil && err == nil {
 		bytes, _ := block.MarshalBinary()
 		d.Data = hex.EncodeToString(bytes[:])
-	} else if block, _ := dbase.FetchEBlockByMR(h); block != nil {
+	} else if block, err := dbase.FetchEBlockByMR(h); block != nil && err == nil {
 		bytes, _ := block.MarshalBinary()
 		d.Data = hex.EncodeToString(bytes[:])
 	} else if block, _ := dbase.FetchECBlockByHash(h); block != nil {